@@ -20,6 +20,12 @@ type Map struct {
 	Sentry    SentryMap    `hcl:"sentry,block"`
 	JWT       JWTMap       `hcl:"jwt,block"`
 	Recaptcha RecaptchaMap `hcl:"recaptcha,block"`
+	Jobs      JobsMap      `hcl:"jobs,block"`
+	Users     UsersMap     `hcl:"users,block"`
+	Uploads   UploadsMap   `hcl:"uploads,block"`
+	Probe     ProbeMap     `hcl:"probe,block"`
+	Metadata  MetadataMap  `hcl:"metadata,block"`
+	MediaURIs MediaURIsMap `hcl:"media_uris,block"`
 }
 
 type RedisMap struct {
@@ -55,10 +61,24 @@ type OauthMap struct {
 	Spotify             OauthClient `hcl:"spotify,block"`
 }
 
+type BucketsMap struct {
+	Avatars   string `hcl:"avatars"`
+	Banners   string `hcl:"banners"`
+	Posters   string `hcl:"posters"`
+	Subtitles string `hcl:"subtitles"`
+}
+
 type S3Map struct {
-	Endpoint  string `hcl:"endpoint"`
-	AccessKey string `hcl:"access_key"`
-	SecretKey string `hcl:"secret_key"`
+	// Driver is one of minio, fs or memory
+	Driver            string     `hcl:"driver"`
+	Endpoint          string     `hcl:"endpoint"`
+	AccessKey         string     `hcl:"access_key"`
+	SecretKey         string     `hcl:"secret_key"`
+	UseTLS            bool       `hcl:"use_tls"`
+	Region            string     `hcl:"region"`
+	Path              string     `hcl:"path"`
+	AutoCreateBuckets bool       `hcl:"auto_create_buckets"`
+	Buckets           BucketsMap `hcl:"buckets,block"`
 }
 
 type SentryMap struct {
@@ -108,6 +128,152 @@ type RecaptchaMap struct {
 	Secret  string `hcl:"secret"`
 }
 
+type JobMap struct {
+	Enabled  bool   `hcl:"enabled"`
+	Interval string `hcl:"interval"`
+}
+
+// parseDuration parses a duration string like "1h" or "720h", falling back
+// to the given default duration when the value is empty or invalid.
+func parseDuration(value string, fallback time.Duration) time.Duration {
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return fallback
+	}
+	return duration
+}
+
+func (j JobMap) GetInterval(fallback time.Duration) time.Duration {
+	return parseDuration(j.Interval, fallback)
+}
+
+type StorageGCJobMap struct {
+	JobMap      `hcl:",squash"`
+	GracePeriod string `hcl:"grace_period"`
+	DryRun      bool   `hcl:"dry_run"`
+}
+
+func (j StorageGCJobMap) GetGracePeriod() time.Duration {
+	return parseDuration(j.GracePeriod, 24*time.Hour)
+}
+
+// MediaJobMap configures a job that processes the media_jobs queue.
+type MediaJobMap struct {
+	JobMap      `hcl:",squash"`
+	Timeout     string `hcl:"timeout"`
+	MaxAttempts int    `hcl:"max_attempts"`
+}
+
+func (j MediaJobMap) GetTimeout() time.Duration {
+	return parseDuration(j.Timeout, 30*time.Minute)
+}
+
+func (j MediaJobMap) GetMaxAttempts() int {
+	if j.MaxAttempts <= 0 {
+		return 3
+	}
+	return j.MaxAttempts
+}
+
+type JobsMap struct {
+	FriendSuggestions JobMap          `hcl:"friend_suggestions,block"`
+	StorageGC         StorageGCJobMap `hcl:"storage_gc,block"`
+	TrackExtraction   MediaJobMap     `hcl:"track_extraction,block"`
+	Thumbnails        MediaJobMap     `hcl:"thumbnails,block"`
+}
+
+type UsersMap struct {
+	UsernameChangeCooldown string `hcl:"username_change_cooldown"`
+	UsernameReclaimAfter   string `hcl:"username_reclaim_after"`
+}
+
+func (u UsersMap) GetUsernameChangeCooldown() time.Duration {
+	return parseDuration(u.UsernameChangeCooldown, 30*24*time.Hour)
+}
+
+func (u UsersMap) GetUsernameReclaimAfter() time.Duration {
+	return parseDuration(u.UsernameReclaimAfter, 90*24*time.Hour)
+}
+
+type UploadsMap struct {
+	Bucket        string `hcl:"bucket"`
+	MaxFileSizeMB int64  `hcl:"max_file_size_mb"`
+	UserQuotaMB   int64  `hcl:"user_quota_mb"`
+	URLExpiry     string `hcl:"url_expiry"`
+}
+
+func (u UploadsMap) GetBucket() string {
+	if u.Bucket == "" {
+		return "uploads"
+	}
+	return u.Bucket
+}
+
+func (u UploadsMap) GetMaxFileSize() int64 {
+	if u.MaxFileSizeMB <= 0 {
+		return 2 << 30
+	}
+	return u.MaxFileSizeMB << 20
+}
+
+func (u UploadsMap) GetUserQuota() int64 {
+	if u.UserQuotaMB <= 0 {
+		return 10 << 30
+	}
+	return u.UserQuotaMB << 20
+}
+
+func (u UploadsMap) GetURLExpiry() time.Duration {
+	return parseDuration(u.URLExpiry, time.Hour)
+}
+
+type ProbeMap struct {
+	FFprobePath      string `hcl:"ffprobe_path"`
+	FFmpegPath       string `hcl:"ffmpeg_path"`
+	Timeout          string `hcl:"timeout"`
+	RejectUnplayable bool   `hcl:"reject_unplayable"`
+}
+
+func (p ProbeMap) GetTimeout() time.Duration {
+	return parseDuration(p.Timeout, 30*time.Second)
+}
+
+type MetadataMap struct {
+	Enabled bool `hcl:"enabled"`
+	// Provider is either tmdb or omdb
+	Provider     string `hcl:"provider"`
+	BaseURL      string `hcl:"base_url"`
+	ImageBaseURL string `hcl:"image_base_url"`
+	APIKey       string `hcl:"api_key"`
+	Language     string `hcl:"language"`
+	Timeout      string `hcl:"timeout"`
+	CacheTTL     string `hcl:"cache_ttl"`
+}
+
+func (m MetadataMap) GetTimeout() time.Duration {
+	return parseDuration(m.Timeout, 10*time.Second)
+}
+
+func (m MetadataMap) GetCacheTTL() time.Duration {
+	return parseDuration(m.CacheTTL, 7*24*time.Hour)
+}
+
+type MediaURIsMap struct {
+	// AllowedHosts and DeniedHosts match the hosts of download and stream uris and
+	// their subdomains, every public host is allowed when AllowedHosts is empty
+	AllowedHosts      []string `hcl:"allowed_hosts"`
+	DeniedHosts       []string `hcl:"denied_hosts"`
+	CheckReachability bool     `hcl:"check_reachability"`
+	Timeout           string   `hcl:"timeout"`
+	RequireRanges     bool     `hcl:"require_ranges"`
+	// CORSOrigin is the origin of the web player, it's sent with the reachability checks
+	CORSOrigin string `hcl:"cors_origin"`
+}
+
+func (m MediaURIsMap) GetTimeout() time.Duration {
+	return parseDuration(m.Timeout, 10*time.Second)
+}
+
 func LoadFile(filename string) (c *Map, err error) {
 
 	d, err := ioutil.ReadFile(filename)
@@ -84,9 +84,29 @@ oauth {
 
 # S3 bucket config
 s3 {
+
+  # Storage driver, it can be minio, fs or memory
+  driver = "minio"
+
   endpoint = "127.0.0.1:9000"
   access_key = "secret-access-key"
   secret_key = "secret-key"
+  use_tls = false
+  region = ""
+
+  # Root directory of the fs driver
+  path = "./storage"
+
+  # Create the buckets on startup if they don't exist
+  auto_create_buckets = true
+
+  buckets {
+    avatars   = "avatars"
+    banners   = "banners"
+    posters   = "posters"
+    subtitles = "subtitles"
+  }
+
 }
 
 # Sentry config
@@ -101,3 +121,117 @@ recaptcha {
   type    = "hcaptcha"
   secret  = "hcaptcha-secret-token"
 }
+
+# Background jobs
+jobs {
+
+  # Precompute "people you may know" suggestions into redis
+  friend_suggestions {
+    enabled  = true
+    interval = "1h"
+  }
+
+  # Delete objects that are not referenced anymore from the storage buckets,
+  # dry_run only reports what would be deleted
+  storage_gc {
+    enabled      = true
+    interval     = "6h"
+    grace_period = "24h"
+    dry_run      = true
+  }
+
+  # Extract embedded subtitles and list the audio tracks of uploaded media with ffmpeg,
+  # jobs that run longer than timeout are retried up to max_attempts times
+  track_extraction {
+    enabled      = true
+    interval     = "30s"
+    timeout      = "30m"
+    max_attempts = 3
+  }
+
+  # Generate poster frames and seek preview sprites of media sources with ffmpeg
+  thumbnails {
+    enabled      = true
+    interval     = "30s"
+    timeout      = "1h"
+    max_attempts = 3
+  }
+
+}
+
+# Users config
+users {
+
+  # How long a user has to wait between two username changes
+  username_change_cooldown = "720h"
+
+  # Old usernames keep redirecting to their owner and can not be taken
+  # by anyone else until this period is passed
+  username_reclaim_after = "2160h"
+
+}
+
+# Direct uploads of media files and subtitles
+uploads {
+
+  # Bucket that the uploaded files are stored in
+  bucket = "uploads"
+
+  # Max size of a single uploaded file
+  max_file_size_mb = 2048
+
+  # Total size of the files that a user can upload
+  user_quota_mb = 10240
+
+  # How long a presigned upload url stays valid
+  url_expiry = "1h"
+
+}
+
+# Media probing of new media sources with ffprobe
+probe {
+
+  ffprobe_path = "ffprobe"
+  ffmpeg_path  = "ffmpeg"
+  timeout = "30s"
+
+  # Reject media sources with containers or codecs that the player can't play
+  reject_unplayable = true
+
+}
+
+# Movie and tv show metadata of media sources, provider can be tmdb or omdb
+metadata {
+
+  enabled        = false
+  provider       = "tmdb"
+  base_url       = "https://api.themoviedb.org/3"
+  image_base_url = "https://image.tmdb.org/t/p/w500"
+  api_key        = ""
+  language       = "en-US"
+  timeout        = "10s"
+
+  # How long the results of the provider are cached in mongodb
+  cache_ttl = "168h"
+
+}
+
+# Validation and reachability checks of the uris of new media sources
+media_uris {
+
+  # Hosts of download and stream uris, subdomains included.
+  # Every public host is allowed when allowed_hosts is empty
+  allowed_hosts = []
+  denied_hosts  = []
+
+  # Request the first byte of download and stream uris before they are accepted
+  check_reachability = true
+  timeout            = "10s"
+
+  # Reject files whose server does not support byte ranges, they can't be seeked
+  require_ranges = false
+
+  # Origin of the web player, streams that it can't read are rejected
+  cors_origin = "https://casty.ir"
+
+}
@@ -0,0 +1,347 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	DefaultTimeout      = 10 * time.Second
+	DefaultMaxBytes     = 10 << 20
+	DefaultMaxRedirects = 3
+)
+
+var (
+	ErrInvalidURL        = errors.New("fetcher: url is invalid")
+	ErrBlockedAddress    = errors.New("fetcher: address is not allowed")
+	ErrTooManyRedirects  = errors.New("fetcher: too many redirects")
+	ErrBadStatus         = errors.New("fetcher: unexpected response status")
+	ErrTooLarge          = errors.New("fetcher: response body is too large")
+	ErrContentNotAllowed = errors.New("fetcher: content type is not allowed")
+	ErrRequestTimedOut   = errors.New("fetcher: request timed out")
+)
+
+// blockedNetworks are the ranges that remote urls are never allowed to
+// resolve to, so clients can not make us talk to our own infrastructure.
+var blockedNetworks = mustParseCIDRs(
+	"0.0.0.0/8",      // this network
+	"10.0.0.0/8",     // private
+	"100.64.0.0/10",  // carrier-grade nat
+	"127.0.0.0/8",    // loopback
+	"169.254.0.0/16", // link-local, cloud metadata endpoints
+	"172.16.0.0/12",  // private
+	"192.0.0.0/24",   // ietf protocol assignments
+	"192.168.0.0/16", // private
+	"198.18.0.0/15",  // benchmarking
+	"224.0.0.0/4",    // multicast
+	"240.0.0.0/4",    // reserved, broadcast
+	"::/128",         // unspecified
+	"::1/128",        // loopback
+	"64:ff9b::/96",   // ipv4/ipv6 translation
+	"fc00::/7",       // unique local
+	"fe80::/10",      // link-local
+	"ff00::/8",       // multicast
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// IsBlockedIP reports whether the ip is in one of the private, loopback,
+// link-local or otherwise non-public ranges.
+func IsBlockedIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+type Options struct {
+	Timeout      time.Duration
+	MaxBytes     int64
+	MaxRedirects int
+	// ContentTypes are the allowed media types of the response,
+	// every content type is allowed when it's empty.
+	ContentTypes []string
+}
+
+var (
+	Images = Options{
+		ContentTypes: []string{"image/png", "image/jpeg", "image/gif", "image/webp"},
+	}
+)
+
+type Response struct {
+	ContentType string
+	Data        []byte
+}
+
+type Fetcher struct {
+	options Options
+	client  *http.Client
+}
+
+// control runs after the address is resolved and right before connecting,
+// checking it here also covers redirects and dns rebinding.
+func control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return ErrBlockedAddress
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || IsBlockedIP(ip) {
+		return ErrBlockedAddress
+	}
+	return nil
+}
+
+func New(options Options) *Fetcher {
+
+	if options.Timeout <= 0 {
+		options.Timeout = DefaultTimeout
+	}
+
+	if options.MaxBytes <= 0 {
+		options.MaxBytes = DefaultMaxBytes
+	}
+
+	if options.MaxRedirects <= 0 {
+		options.MaxRedirects = DefaultMaxRedirects
+	}
+
+	dialer := &net.Dialer{
+		Timeout: options.Timeout,
+		Control: control,
+	}
+
+	transport := &http.Transport{
+		// proxies are never used, they would connect on our behalf without the address checks
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   options.Timeout,
+		ResponseHeaderTimeout: options.Timeout,
+		DisableKeepAlives:     true,
+	}
+
+	client := &http.Client{
+		Timeout:   options.Timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > options.MaxRedirects {
+				return ErrTooManyRedirects
+			}
+			return checkURL(req.URL)
+		},
+	}
+
+	return &Fetcher{options: options, client: client}
+}
+
+func checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ErrInvalidURL
+	}
+	if u.Hostname() == "" || u.User != nil {
+		return ErrInvalidURL
+	}
+	return nil
+}
+
+func (f *Fetcher) contentTypeAllowed(contentType string) bool {
+	if len(f.options.ContentTypes) == 0 {
+		return true
+	}
+	for _, allowed := range f.options.ContentTypes {
+		if allowed == contentType {
+			return true
+		}
+	}
+	return false
+}
+
+// unwrap maps the errors of the http client back to the fetcher errors.
+func unwrap(err error) error {
+	for _, target := range []error{ErrBlockedAddress, ErrTooManyRedirects, ErrInvalidURL} {
+		if errors.Is(err, target) {
+			return target
+		}
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrRequestTimedOut
+	}
+	return err
+}
+
+// Fetch gets the remote url and returns its body, the content type of the
+// response is sniffed when the server does not send a specific one.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (*Response, error) {
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, ErrInvalidURL
+	}
+
+	if err := checkURL(u); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, ErrInvalidURL
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, unwrap(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s", ErrBadStatus, resp.Status)
+	}
+
+	if resp.ContentLength > f.options.MaxBytes {
+		return nil, ErrTooLarge
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, f.options.MaxBytes+1))
+	if err != nil {
+		return nil, unwrap(err)
+	}
+
+	if int64(len(data)) > f.options.MaxBytes {
+		return nil, ErrTooLarge
+	}
+
+	contentType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if contentType == "" || contentType == "application/octet-stream" {
+		contentType, _, _ = mime.ParseMediaType(http.DetectContentType(data))
+	}
+
+	if !f.contentTypeAllowed(contentType) {
+		return nil, ErrContentNotAllowed
+	}
+
+	return &Response{ContentType: contentType, Data: data}, nil
+}
+
+// CheckURL resolves the host of the url and checks that none of its addresses
+// are blocked, it's for urls that are fetched by other programs like ffprobe.
+func CheckURL(ctx context.Context, rawURL string) error {
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ErrInvalidURL
+	}
+
+	if err := checkURL(u); err != nil {
+		return err
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil || len(addrs) == 0 {
+		return ErrInvalidURL
+	}
+
+	for _, addr := range addrs {
+		if IsBlockedIP(addr.IP) {
+			return ErrBlockedAddress
+		}
+	}
+
+	return nil
+}
+
+// HeadResponse is the status and the headers of a remote url, without its body.
+type HeadResponse struct {
+	StatusCode  int
+	Header      http.Header
+	ContentType string
+	// Size is the full length of the content, it's -1 when the server does not send it
+	Size int64
+	// Ranges is true when the server answered the range request with partial content
+	Ranges bool
+}
+
+// Head requests the first byte of the remote url. A ranged GET tells both the length of
+// the content and if the server supports byte ranges, unlike HEAD requests that many
+// media hosts don't allow. The body of the response is never read.
+func (f *Fetcher) Head(ctx context.Context, rawURL string, header http.Header) (*HeadResponse, error) {
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, ErrInvalidURL
+	}
+
+	if err := checkURL(u); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, ErrInvalidURL
+	}
+
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Range", "bytes=0-0")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, unwrap(err)
+	}
+	resp.Body.Close()
+
+	head := &HeadResponse{StatusCode: resp.StatusCode, Header: resp.Header, Size: resp.ContentLength}
+	head.ContentType, _, _ = mime.ParseMediaType(resp.Header.Get("Content-Type"))
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusPartialContent:
+		head.Ranges = true
+		head.Size = parseContentRangeSize(resp.Header.Get("Content-Range"))
+	default:
+		return head, fmt.Errorf("%w: %s", ErrBadStatus, resp.Status)
+	}
+
+	return head, nil
+}
+
+// parseContentRangeSize returns the full length of a content range like "bytes 0-0/1234".
+func parseContentRangeSize(contentRange string) int64 {
+	i := strings.LastIndex(contentRange, "/")
+	if i < 0 {
+		return -1
+	}
+	size, err := strconv.ParseInt(contentRange[i+1:], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return size
+}
@@ -0,0 +1,180 @@
+package fetcher
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// hopHeaders are only meant for the connection they are sent on, they are not forwarded.
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// Proxy is a forward http proxy on the loopback interface that connects with the same
+// address checks as the fetcher. Programs that fetch urls on their own, like ffprobe and
+// ffmpeg, are pointed at it so every connection they make is checked, the redirects they
+// follow and the segments of the manifests they read included.
+type Proxy struct {
+	listener  net.Listener
+	server    *http.Server
+	dialer    *net.Dialer
+	transport *http.Transport
+	tunnels   sync.WaitGroup
+	mu        sync.Mutex
+	conns     map[net.Conn]bool
+}
+
+// StartProxy listens on a random loopback port until the proxy is closed.
+func StartProxy(timeout time.Duration) (*Proxy, error) {
+
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Proxy{
+		listener: listener,
+		dialer:   &net.Dialer{Timeout: timeout, Control: control},
+		conns:    make(map[net.Conn]bool),
+	}
+
+	p.transport = &http.Transport{
+		Proxy:                 nil,
+		DialContext:           p.dialer.DialContext,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+		DisableKeepAlives:     true,
+	}
+
+	p.server = &http.Server{Handler: p, ReadHeaderTimeout: timeout}
+	go p.server.Serve(listener)
+
+	return p, nil
+}
+
+// URL is the address that programs are given as their http proxy.
+func (p *Proxy) URL() string {
+	return "http://" + p.listener.Addr().String()
+}
+
+// Close stops the proxy along with its open tunnels.
+func (p *Proxy) Close() error {
+	err := p.server.Close()
+	p.mu.Lock()
+	for conn := range p.conns {
+		conn.Close()
+	}
+	p.mu.Unlock()
+	p.tunnels.Wait()
+	return err
+}
+
+func (p *Proxy) track(conns ...net.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, conn := range conns {
+		p.conns[conn] = true
+	}
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		p.tunnel(w, r)
+		return
+	}
+	p.forward(w, r)
+}
+
+// tunnel connects the client to the host of a CONNECT request, it's how https urls are fetched.
+func (p *Proxy) tunnel(w http.ResponseWriter, r *http.Request) {
+
+	upstream, err := p.dialer.DialContext(r.Context(), "tcp", r.Host)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "tunnels are not supported", http.StatusInternalServerError)
+		return
+	}
+
+	client, buffered, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+
+	if _, err := client.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n")); err != nil {
+		client.Close()
+		upstream.Close()
+		return
+	}
+
+	p.track(client, upstream)
+	p.tunnels.Add(2)
+	go func() {
+		defer p.tunnels.Done()
+		// bytes that the client sent right after the request are still buffered
+		io.Copy(upstream, buffered)
+		upstream.Close()
+	}()
+	go func() {
+		defer p.tunnels.Done()
+		io.Copy(client, upstream)
+		client.Close()
+	}()
+}
+
+// forward sends a plain http request upstream, redirects are returned to the client
+// which sends them through the proxy again.
+func (p *Proxy) forward(w http.ResponseWriter, r *http.Request) {
+
+	if !r.URL.IsAbs() || checkURL(r.URL) != nil || r.URL.Scheme != "http" {
+		http.Error(w, ErrInvalidURL.Error(), http.StatusBadRequest)
+		return
+	}
+
+	outgoing := r.Clone(r.Context())
+	outgoing.RequestURI = ""
+	for _, header := range hopHeaders {
+		outgoing.Header.Del(header)
+	}
+
+	resp, err := p.transport.RoundTrip(outgoing)
+	if err != nil {
+		http.Error(w, unwrap(err).Error(), http.StatusForbidden)
+		return
+	}
+	defer resp.Body.Close()
+
+	for _, header := range hopHeaders {
+		resp.Header.Del(header)
+	}
+
+	for key, values := range resp.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
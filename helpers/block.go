@@ -0,0 +1,89 @@
+package helpers
+
+import (
+	"context"
+
+	"github.com/castyapp/grpc.server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// IsBlocked reports whether either of the given users has blocked the other one.
+func IsBlocked(ctx context.Context, db *mongo.Database, userID, otherUserID *primitive.ObjectID) (bool, error) {
+	filter := bson.M{
+		"$or": []interface{}{
+			bson.M{
+				"user_id":         userID,
+				"blocked_user_id": otherUserID,
+			},
+			bson.M{
+				"user_id":         otherUserID,
+				"blocked_user_id": userID,
+			},
+		},
+	}
+	count, err := db.Collection("blocks").CountDocuments(ctx, filter)
+	if err != nil {
+		return false, err
+	}
+	return count != 0, nil
+}
+
+// GetBlockedUserIDs returns ids of the users that the given user has blocked
+// and the users who blocked the given user.
+func GetBlockedUserIDs(ctx context.Context, db *mongo.Database, userID *primitive.ObjectID) ([]*primitive.ObjectID, error) {
+
+	filter := bson.M{
+		"$or": []interface{}{
+			bson.M{"user_id": userID},
+			bson.M{"blocked_user_id": userID},
+		},
+	}
+
+	cursor, err := db.Collection("blocks").Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	ids := make([]*primitive.ObjectID, 0)
+	for cursor.Next(ctx) {
+		block := new(models.Block)
+		if err := cursor.Decode(block); err != nil {
+			continue
+		}
+		if block.UserID.Hex() == userID.Hex() {
+			ids = append(ids, block.BlockedUserID)
+		} else {
+			ids = append(ids, block.UserID)
+		}
+	}
+
+	return ids, nil
+}
+
+// CreateBlockIndexes makes a user block another user only once, blocks that were made twice
+// before are deduplicated first and the oldest block is kept.
+func CreateBlockIndexes(ctx context.Context, db *mongo.Database) error {
+
+	var (
+		collection = db.Collection("blocks")
+		keep       = bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}
+		group      = bson.M{"user_id": "$user_id", "blocked_user_id": "$blocked_user_id"}
+	)
+
+	if err := deleteDuplicates(ctx, collection, group, keep); err != nil {
+		return err
+	}
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "blocked_user_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "blocked_user_id", Value: 1}}},
+	})
+	return err
+}
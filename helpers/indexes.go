@@ -0,0 +1,70 @@
+package helpers
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// deleteDuplicates deletes the documents that have the same group as another one, so a unique
+// index can be created on the fields of the group. The first document in the keep order is kept.
+func deleteDuplicates(ctx context.Context, collection *mongo.Collection, group interface{}, keep bson.D) error {
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$sort", Value: keep}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   group,
+			"ids":   bson.M{"$push": "$_id"},
+			"count": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		duplicate := new(struct {
+			IDs []primitive.ObjectID `bson:"ids"`
+		})
+		if err := cursor.Decode(duplicate); err != nil {
+			return err
+		}
+		if _, err := collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": duplicate.IDs[1:]}}); err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
+
+// dropNonUniqueIndex drops the index when it exists and is not unique, so it can be created again as unique.
+func dropNonUniqueIndex(ctx context.Context, collection *mongo.Collection, name string) error {
+
+	cursor, err := collection.Indexes().List(ctx)
+	if err != nil {
+		return err
+	}
+
+	var indexes []struct {
+		Name   string `bson:"name"`
+		Unique bool   `bson:"unique"`
+	}
+	if err := cursor.All(ctx, &indexes); err != nil {
+		return err
+	}
+
+	for _, index := range indexes {
+		if index.Name == name && !index.Unique {
+			_, err := collection.Indexes().DropOne(ctx, name)
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/castyapp/grpc.server/core"
+	"github.com/castyapp/grpc.server/models"
+	"github.com/castyapp/grpc.server/storage"
+	"github.com/castyapp/libcasty-protocol-go/proto"
+	"github.com/castyapp/libcasty-protocol-go/protocol"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TheaterMediaChange is a theater whose current media source was removed,
+// MediaSource is the replacement or nil when the theater has no media anymore.
+type TheaterMediaChange struct {
+	Theater     *models.Theater
+	MediaSource *models.MediaSource
+}
+
+type MediaSourceRemoval struct {
+	MediaSources []*models.MediaSource
+	Subtitles    []*models.Subtitle
+	Theaters     []*TheaterMediaChange
+}
+
+func findMediaSources(ctx context.Context, collection *mongo.Collection, filter bson.M, opts ...*options.FindOptions) ([]*models.MediaSource, error) {
+	cursor, err := collection.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	mediaSources := make([]*models.MediaSource, 0)
+	for cursor.Next(ctx) {
+		mediaSource := new(models.MediaSource)
+		if err := cursor.Decode(mediaSource); err != nil {
+			return nil, err
+		}
+		mediaSources = append(mediaSources, mediaSource)
+	}
+	return mediaSources, nil
+}
+
+func findSubtitles(ctx context.Context, collection *mongo.Collection, filter bson.M) ([]*models.Subtitle, error) {
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	subtitles := make([]*models.Subtitle, 0)
+	for cursor.Next(ctx) {
+		subtitle := new(models.Subtitle)
+		if err := cursor.Decode(subtitle); err != nil {
+			return nil, err
+		}
+		subtitles = append(subtitles, subtitle)
+	}
+	return subtitles, nil
+}
+
+// replaceTheaterMedia points the theaters that are playing one of the removed media
+// sources to the latest other media source of their owner, or clears their media.
+func replaceTheaterMedia(ctx context.Context, db *mongo.Database, removedIDs []*primitive.ObjectID) ([]*TheaterMediaChange, error) {
+
+	var (
+		collection = db.Collection("theaters")
+		changes    = make([]*TheaterMediaChange, 0)
+		latest     = options.Find().SetSort(bson.M{"created_at": -1}).SetLimit(1)
+	)
+
+	cursor, err := collection.Find(ctx, bson.M{"media_source_id": bson.M{"$in": removedIDs}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+
+		theater := new(models.Theater)
+		if err := cursor.Decode(theater); err != nil {
+			return nil, err
+		}
+
+		replacements, err := findMediaSources(ctx, db.Collection("media_sources"), bson.M{
+			"user_id": theater.UserID,
+			"_id":     bson.M{"$nin": removedIDs},
+		}, latest)
+		if err != nil {
+			return nil, err
+		}
+
+		change := &TheaterMediaChange{Theater: theater}
+		update := bson.M{"$unset": bson.M{"media_source_id": ""}}
+		if len(replacements) > 0 {
+			change.MediaSource = replacements[0]
+			update = bson.M{"$set": bson.M{"media_source_id": change.MediaSource.ID}}
+		}
+
+		if _, err := collection.UpdateOne(ctx, bson.M{"_id": theater.ID}, update); err != nil {
+			return nil, err
+		}
+
+		changes = append(changes, change)
+	}
+
+	return changes, nil
+}
+
+// RemoveMediaSources removes the media sources that match the filter along with
+// their subtitles, uploads and media jobs in a single transaction, theaters that are playing
+// one of them get another media source of their owner or none.
+// Without transactions the media sources are deleted last, so a failed removal is
+// found and finished by the next one.
+// Stored files are not touched, they are removed with RemoveMediaSourceFiles
+// once the transaction is committed.
+func RemoveMediaSources(ctx context.Context, db *mongo.Database, filter bson.M) (*MediaSourceRemoval, error) {
+
+	result, err := WithTransaction(ctx, db, func(sc context.Context) (interface{}, error) {
+
+		mediaSources, err := findMediaSources(sc, db.Collection("media_sources"), filter)
+		if err != nil {
+			return nil, err
+		}
+
+		removal := &MediaSourceRemoval{MediaSources: mediaSources}
+		if len(mediaSources) == 0 {
+			return removal, nil
+		}
+
+		ids := make([]*primitive.ObjectID, 0, len(mediaSources))
+		for _, mediaSource := range mediaSources {
+			ids = append(ids, mediaSource.ID)
+		}
+
+		byMediaSource := bson.M{"media_source_id": bson.M{"$in": ids}}
+		if removal.Subtitles, err = findSubtitles(sc, db.Collection("subtitles"), byMediaSource); err != nil {
+			return nil, err
+		}
+
+		if _, err := db.Collection("subtitles").DeleteMany(sc, byMediaSource); err != nil {
+			return nil, err
+		}
+
+		// uploads of the media sources and of their subtitles do not count toward the quota anymore
+		if _, err := db.Collection("uploads").DeleteMany(sc, byMediaSource); err != nil {
+			return nil, err
+		}
+
+		if _, err := db.Collection("media_jobs").DeleteMany(sc, byMediaSource); err != nil {
+			return nil, err
+		}
+
+		if removal.Theaters, err = replaceTheaterMedia(sc, db, ids); err != nil {
+			return nil, err
+		}
+
+		if _, err := db.Collection("media_sources").DeleteMany(sc, bson.M{"_id": bson.M{"$in": ids}}); err != nil {
+			return nil, err
+		}
+
+		return removal, nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("could not remove media sources: %v", err)
+	}
+
+	return result.(*MediaSourceRemoval), nil
+}
+
+// RemoveMediaSourceFiles removes the posters, seek previews and uploaded files of the removed media sources and subtitles.
+func RemoveMediaSourceFiles(removal *MediaSourceRemoval, uploadsBucket string) {
+
+	remove := func(bucket, key string) {
+		if err := storage.Client.Delete(bucket, key); err != nil {
+			log.Printf("could not remove object [%s/%s]: %v", bucket, key, err)
+		}
+	}
+
+	for _, mediaSource := range removal.MediaSources {
+		if mediaSource.Banner != "" && mediaSource.Banner != "default" {
+			remove(storage.Buckets.Posters, fmt.Sprintf("%s.png", mediaSource.Banner))
+		}
+		if mediaSource.ObjectKey != "" {
+			remove(uploadsBucket, mediaSource.ObjectKey)
+		}
+		if mediaSource.Thumbnails != nil {
+			remove(uploadsBucket, mediaSource.Thumbnails.Track)
+			for _, sprite := range mediaSource.Thumbnails.Sprites {
+				remove(uploadsBucket, sprite)
+			}
+		}
+	}
+
+	for _, subtitle := range removal.Subtitles {
+		if subtitle.ObjectKey != "" {
+			remove(storage.Buckets.Subtitles, subtitle.ObjectKey)
+		}
+	}
+}
+
+// SendTheaterMediaChangedEvents tells the members of the theaters about their new media source,
+// an empty media source is sent to the theaters that have no media anymore.
+func SendTheaterMediaChangedEvents(ctx *core.Context, changes []*TheaterMediaChange) {
+	for _, change := range changes {
+		mediaSourceProto := new(proto.MediaSource)
+		if change.MediaSource != nil {
+			mediaSourceProto = NewMediaSourceProto(change.MediaSource)
+		}
+		event, err := protocol.NewMsgProtobuf(proto.EMSG_THEATER_MEDIA_SOURCE_CHANGED, mediaSourceProto)
+		if err != nil {
+			continue
+		}
+		if err := SendEventToTheaterMembers(ctx, event.Bytes(), change.Theater); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// SendMediaSourceChangedEvents lets the members of the theaters that are playing the
+// media source know that it or its subtitles changed, so players reload them.
+func SendMediaSourceChangedEvents(ctx *core.Context, db *mongo.Database, mediaSource *models.MediaSource) {
+
+	cursor, err := db.Collection("theaters").Find(ctx, bson.M{"media_source_id": mediaSource.ID})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	theaters := make([]*models.Theater, 0)
+	if err := cursor.All(ctx, &theaters); err != nil || len(theaters) == 0 {
+		return
+	}
+
+	mediaSourceProto := NewMediaSourceProto(mediaSource)
+	if cursor, err := db.Collection("subtitles").Find(ctx, bson.M{"media_source_id": mediaSource.ID}); err == nil {
+		for cursor.Next(ctx) {
+			subtitle := new(models.Subtitle)
+			if err := cursor.Decode(subtitle); err != nil {
+				continue
+			}
+			if protoMsg, err := NewSubtitleProto(subtitle); err == nil {
+				mediaSourceProto.Subtitles = append(mediaSourceProto.Subtitles, protoMsg)
+			}
+		}
+	}
+
+	event, err := protocol.NewMsgProtobuf(proto.EMSG_THEATER_MEDIA_SOURCE_CHANGED, mediaSourceProto)
+	if err != nil {
+		return
+	}
+
+	for _, theater := range theaters {
+		if err := SendEventToTheaterMembers(ctx, event.Bytes(), theater); err != nil {
+			log.Println(err)
+		}
+	}
+}
@@ -2,18 +2,30 @@ package helpers
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"time"
 
 	"github.com/castyapp/grpc.server/core"
 	"github.com/castyapp/grpc.server/models"
 	"github.com/castyapp/libcasty-protocol-go/proto"
+	"github.com/castyapp/libcasty-protocol-go/protocol"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
-func NewMemberProto(ctx *core.Context, member *models.TheaterMember) (*proto.User, error) {
+var (
+	ErrTheaterBanned     = errors.New("user is banned from the theater")
+	ErrTheaterNotAllowed = errors.New("theater privacy does not let the user in")
+)
+
+// NewMemberProto returns the member of a theater for the viewer.
+func NewMemberProto(ctx *core.Context, viewerID *primitive.ObjectID, member *models.TheaterMember) (*proto.User, error) {
 
 	dbConn, err := ctx.Get("db.mongo")
 	if err != nil {
@@ -29,10 +41,10 @@ func NewMemberProto(ctx *core.Context, member *models.TheaterMember) (*proto.Use
 	if err := decoder.Decode(dbmember); err != nil {
 		return nil, fmt.Errorf("could not decode theater member: %v", err)
 	}
-	return NewProtoUser(dbmember), nil
+	return NewProtoUser(dbmember, GetRelation(ctx, db, viewerID, dbmember.ID)), nil
 }
 
-func GetTheaterMembers(ctx *core.Context, theater *models.Theater) ([]*proto.User, error) {
+func GetTheaterMembers(ctx *core.Context, viewerID *primitive.ObjectID, theater *models.Theater) ([]*proto.User, error) {
 
 	dbConn, err := ctx.Get("db.mongo")
 	if err != nil {
@@ -54,7 +66,7 @@ func GetTheaterMembers(ctx *core.Context, theater *models.Theater) ([]*proto.Use
 		if err := cursor.Decode(member); err != nil {
 			continue
 		}
-		protoMember, err := NewMemberProto(ctx, member)
+		protoMember, err := NewMemberProto(ctx, viewerID, member)
 		if err != nil {
 			continue
 		}
@@ -63,3 +75,173 @@ func GetTheaterMembers(ctx *core.Context, theater *models.Theater) ([]*proto.Use
 
 	return members, nil
 }
+
+// CreateMemberIndexes creates the indexes of theater members and bans, members are unique
+// per theater and bans with an expiry are removed by mongodb once they expire.
+func CreateMemberIndexes(ctx context.Context, db *mongo.Database) error {
+
+	// users could join a theater more than once before memberships were unique, their first membership is kept
+	keep := bson.D{{Key: "joined_at", Value: 1}, {Key: "_id", Value: 1}}
+	group := bson.M{"theater_id": "$theater_id", "user_id": "$user_id"}
+	if err := deleteDuplicates(ctx, db.Collection("theater_members"), group, keep); err != nil {
+		return err
+	}
+
+	_, err := db.Collection("theater_members").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "theater_id", Value: 1}, {Key: "user_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Collection("theater_bans").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "theater_id", Value: 1}, {Key: "user_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	return err
+}
+
+// FindTheaterBan returns the active ban of the user in the theater, it's nil when the user is not banned.
+// Expired bans are checked here too since mongodb removes them only once a minute.
+func FindTheaterBan(ctx context.Context, db *mongo.Database, theater *models.Theater, userID *primitive.ObjectID) (*models.TheaterBan, error) {
+	ban := new(models.TheaterBan)
+	err := db.Collection("theater_bans").FindOne(ctx, bson.M{"theater_id": theater.ID, "user_id": userID}).Decode(ban)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !ban.IsActive(time.Now()) {
+		return nil, nil
+	}
+	return ban, nil
+}
+
+// isInvitedToTheater reports whether the owner of the theater invited the user to it.
+func isInvitedToTheater(ctx context.Context, db *mongo.Database, theater *models.Theater, userID *primitive.ObjectID) (bool, error) {
+	count, err := db.Collection("notifications").CountDocuments(ctx, bson.M{
+		"type":         int32(proto.Notification_NEW_THEATER_INVITE),
+		"from_user_id": theater.UserID,
+		"to_user_id":   userID,
+		"extra":        theater.ID,
+	})
+	return count > 0, err
+}
+
+// CheckTheaterJoin returns ErrTheaterBanned or ErrTheaterNotAllowed when the user can't join the theater.
+// Public theaters let everyone in, friends theaters the friends of the owner and theaters of chosen
+// friends the users that the owner invited, private theaters are only for their owners.
+func CheckTheaterJoin(ctx context.Context, db *mongo.Database, theater *models.Theater, user *models.User) error {
+
+	if theater.UserID.Hex() == user.ID.Hex() {
+		return nil
+	}
+
+	blocked, err := IsBlocked(ctx, db, user.ID, theater.UserID)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return ErrTheaterNotAllowed
+	}
+
+	ban, err := FindTheaterBan(ctx, db, theater, user.ID)
+	if err != nil {
+		return err
+	}
+	if ban != nil {
+		return ErrTheaterBanned
+	}
+
+	switch theater.Privacy {
+	case proto.PRIVACY_PRIVATE:
+		return ErrTheaterNotAllowed
+	case proto.PRIVACY_FRIENDS:
+		if GetRelation(ctx, db, user.ID, theater.UserID) != models.RelationFriend {
+			return ErrTheaterNotAllowed
+		}
+	case proto.PRIVACY_CHOOSEN_FRIENDS:
+		invited, err := isInvitedToTheater(ctx, db, theater, user.ID)
+		if err != nil {
+			return err
+		}
+		if !invited {
+			return ErrTheaterNotAllowed
+		}
+	}
+
+	return nil
+}
+
+// JoinTheater makes the user a member of the theater and tells the other members, joining
+// again changes nothing. Both the join requests of the users and the presence that the
+// websocket gateway reports come through here, so they are checked the same way.
+func JoinTheater(ctx *core.Context, db *mongo.Database, theater *models.Theater, user *models.User) (bool, error) {
+
+	if err := CheckTheaterJoin(ctx, db, theater, user); err != nil {
+		return false, err
+	}
+
+	var (
+		filter = bson.M{"theater_id": theater.ID, "user_id": user.ID}
+		update = bson.M{"$setOnInsert": bson.M{"joined_at": time.Now()}}
+	)
+
+	result, err := db.Collection("theater_members").UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		// a concurrent join of the same user already added them
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	joined := result.UpsertedCount > 0
+	if joined {
+		SendMembershipEvent(ctx, theater, proto.EMSG_JOIN_THEATER, user)
+	}
+
+	return joined, nil
+}
+
+// LeaveTheater removes the user from the members of the theater and tells the other members.
+func LeaveTheater(ctx *core.Context, db *mongo.Database, theater *models.Theater, user *models.User) (bool, error) {
+
+	result, err := db.Collection("theater_members").DeleteOne(ctx, bson.M{"theater_id": theater.ID, "user_id": user.ID})
+	if err != nil {
+		return false, err
+	}
+
+	left := result.DeletedCount > 0
+	if left {
+		SendMembershipEvent(ctx, theater, proto.EMSG_LEAVE_THEATER, user)
+	}
+
+	return left, nil
+}
+
+// SendMembershipEvent sends the member that joined or left to the theater channel. Every member
+// of the theater gets the same event, so the member is sent as strangers see them.
+func SendMembershipEvent(ctx *core.Context, theater *models.Theater, emsg proto.EMSG, user *models.User) {
+	event, err := protocol.NewMsgProtobuf(emsg, &proto.TheaterMembers{
+		Members: []*proto.User{NewProtoUser(user, models.RelationStranger)},
+	})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if err := SendEventToTheaterMembers(ctx, event.Bytes(), theater); err != nil {
+		log.Println(err)
+	}
+}
@@ -10,7 +10,8 @@ import (
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
-func NewProtoMessage(ctx context.Context, db *mongo.Database, message *models.Message) (*proto.Message, error) {
+// NewProtoMessage returns the message for a viewer, relation is how the viewer relates to its sender.
+func NewProtoMessage(ctx context.Context, db *mongo.Database, message *models.Message, relation models.Relation) (*proto.Message, error) {
 
 	var (
 		sender     = new(models.User)
@@ -24,7 +25,7 @@ func NewProtoMessage(ctx context.Context, db *mongo.Database, message *models.Me
 	protoMessage := &proto.Message{
 		Id:        message.ID.Hex(),
 		Content:   message.Content,
-		Sender:    sender.ToProto(),
+		Sender:    NewProtoUser(sender, relation),
 		Edited:    message.Edited,
 		Deleted:   message.Deleted,
 		CreatedAt: timestamppb.New(message.CreatedAt),
@@ -33,7 +33,7 @@ func NewNotificationProto(db *mongo.Database, n *models.Notification) (*proto.No
 		ReadAt:    timestamppb.New(n.ReadAt),
 		CreatedAt: timestamppb.New(n.ReadAt),
 		UpdatedAt: timestamppb.New(n.UpdatedAt),
-		FromUser:  NewProtoUser(fromUser),
+		FromUser:  NewProtoUser(fromUser, GetRelation(mCtx, db, n.ToUserID, fromUser.ID)),
 	}
 
 	switch n.Type {
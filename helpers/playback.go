@@ -0,0 +1,235 @@
+package helpers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/castyapp/grpc.server/core"
+	"github.com/castyapp/grpc.server/models"
+	"github.com/castyapp/libcasty-protocol-go/proto"
+	"github.com/castyapp/libcasty-protocol-go/protocol"
+	"github.com/go-redis/redis/v8"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// playbackStateTTL keeps the states of idle theaters out of redis, they are loaded
+	// back from their snapshots when they are used again
+	playbackStateTTL = 24 * time.Hour
+	// maxPlaybackRetries is how many times a change is retried when another change
+	// of the same theater was written at the same time
+	maxPlaybackRetries = 5
+)
+
+var ErrPlaybackConflict = errors.New("playback state kept changing, could not update it")
+
+func playbackStateKey(theaterID *primitive.ObjectID) string {
+	return fmt.Sprintf("theater:playback:%s", theaterID.Hex())
+}
+
+// newTheaterPlaybackState returns the state of the selected media of the theater.
+func newTheaterPlaybackState(ctx context.Context, db *mongo.Database, theater *models.Theater) *models.PlaybackState {
+	var length float64
+	if theater.MediaSourceID != nil {
+		mediaSource := new(models.MediaSource)
+		if err := db.Collection("media_sources").FindOne(ctx, bson.M{"_id": theater.MediaSourceID}).Decode(mediaSource); err == nil {
+			length = float64(mediaSource.Length)
+		}
+	}
+	return models.NewPlaybackState(theater.ID, theater.MediaSourceID, length, time.Now())
+}
+
+// loadPlaybackState reads the state from redis, or from its snapshot when redis lost it.
+// The state starts over when the theater selected another media since it was saved.
+func loadPlaybackState(ctx context.Context, db *mongo.Database, getter redis.Cmdable, theater *models.Theater) (*models.PlaybackState, error) {
+
+	state := new(models.PlaybackState)
+
+	data, err := getter.Get(ctx, playbackStateKey(theater.ID)).Bytes()
+	switch err {
+	case nil:
+		if err := json.Unmarshal(data, state); err != nil {
+			return nil, err
+		}
+	case redis.Nil:
+		err := db.Collection("playback_states").FindOne(ctx, bson.M{"_id": theater.ID}).Decode(state)
+		if err == mongo.ErrNoDocuments {
+			return newTheaterPlaybackState(ctx, db, theater), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	if !sameObjectID(state.MediaSourceID, theater.MediaSourceID) {
+		next := newTheaterPlaybackState(ctx, db, theater)
+		next.Version = state.Version
+		return next, nil
+	}
+
+	return state, nil
+}
+
+func sameObjectID(a, b *primitive.ObjectID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// GetPlaybackState returns the playback state of the theater.
+func GetPlaybackState(ctx *core.Context, db *mongo.Database, theater *models.Theater) (*models.PlaybackState, error) {
+
+	redisConn, err := ctx.Get("redis.conn")
+	if err != nil {
+		return nil, err
+	}
+
+	return loadPlaybackState(ctx, db, redisConn.(*redis.Client), theater)
+}
+
+// UpdatePlaybackState changes the playback state of the theater with the change function,
+// concurrent changes of the same theater are applied one after another. The new state is
+// saved in redis and snapshotted to mongodb so it survives the loss of redis.
+func UpdatePlaybackState(ctx *core.Context, db *mongo.Database, theater *models.Theater, change func(*models.PlaybackState) error) (*models.PlaybackState, error) {
+
+	redisConn, err := ctx.Get("redis.conn")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		client = redisConn.(*redis.Client)
+		key    = playbackStateKey(theater.ID)
+		state  *models.PlaybackState
+	)
+
+	update := func(tx *redis.Tx) error {
+
+		current, err := loadPlaybackState(ctx, db, tx, theater)
+		if err != nil {
+			return err
+		}
+
+		if err := change(current); err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(current)
+		if err != nil {
+			return err
+		}
+
+		// the transaction fails when the key changed since it was watched
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, data, playbackStateTTL)
+			return nil
+		})
+		if err == nil {
+			state = current
+		}
+		return err
+	}
+
+	for i := 0; i < maxPlaybackRetries; i++ {
+		err = client.Watch(ctx, update, key)
+		if err == redis.TxFailedErr {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		snapshotPlaybackState(ctx, db, state)
+		return state, nil
+	}
+
+	return nil, ErrPlaybackConflict
+}
+
+// UpdatePlaybackLength sets the length of the media source in the playback states of the
+// theaters that are playing it and sends them the updated states.
+func UpdatePlaybackLength(ctx *core.Context, db *mongo.Database, mediaSource *models.MediaSource) {
+
+	cursor, err := db.Collection("theaters").Find(ctx, bson.M{"media_source_id": mediaSource.ID})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		theater := new(models.Theater)
+		if err := cursor.Decode(theater); err != nil {
+			continue
+		}
+		state, err := UpdatePlaybackState(ctx, db, theater, func(state *models.PlaybackState) error {
+			state.SetLength(float64(mediaSource.Length), time.Now())
+			return nil
+		})
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		SendPlaybackStateEvent(ctx, theater, state)
+	}
+}
+
+// snapshotPlaybackState writes the state to mongodb unless a newer version is already there.
+func snapshotPlaybackState(ctx context.Context, db *mongo.Database, state *models.PlaybackState) {
+	var (
+		filter = bson.M{"_id": state.TheaterID, "version": bson.M{"$lt": state.Version}}
+		opts   = options.Replace().SetUpsert(true)
+	)
+	_, err := db.Collection("playback_states").ReplaceOne(ctx, filter, state, opts)
+	// the upsert of an older version runs into the newer snapshot
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		log.Println(err)
+	}
+}
+
+// NewTheaterVideoPlayerProto returns the state as the video player event of the theater,
+// the current time is the position at the time the event is sent.
+func NewTheaterVideoPlayerProto(state *models.PlaybackState) *proto.TheaterVideoPlayer {
+	var (
+		now    = time.Now()
+		player = &proto.TheaterVideoPlayer{
+			TheaterId:   state.TheaterID.Hex(),
+			CurrentTime: float32(state.PositionAt(now)),
+			State:       proto.TheaterVideoPlayer_PLAYING,
+			SentAt:      timestamppb.New(now),
+		}
+	)
+	if state.Paused {
+		player.State = proto.TheaterVideoPlayer_PAUSED
+	}
+	if state.UpdatedBy != nil {
+		player.UserId = state.UpdatedBy.Hex()
+	}
+	return player
+}
+
+// SendPlaybackStateEvent sends the playback state to the members of the theater.
+func SendPlaybackStateEvent(ctx *core.Context, theater *models.Theater, state *models.PlaybackState) {
+	emsg := proto.EMSG_THEATER_PLAY
+	if state.Paused {
+		emsg = proto.EMSG_THEATER_PAUSE
+	}
+	event, err := protocol.NewMsgProtobuf(emsg, NewTheaterVideoPlayerProto(state))
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if err := SendEventToTheaterMembers(ctx, event.Bytes(), theater); err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,284 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/castyapp/grpc.server/core"
+	"github.com/castyapp/grpc.server/models"
+	"github.com/go-redis/redis/v8"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// MaxFriendSuggestions is the number of suggestions kept per user
+	MaxFriendSuggestions = 50
+
+	mutualFriendScore  = 3
+	sharedFollowScore  = 2
+	sharedTheaterScore = 1
+)
+
+type FriendSuggestion struct {
+	UserID *primitive.ObjectID
+	Score  float64
+}
+
+// noFriendSuggestions is the member cached for users that have no suggestions,
+// redis drops empty sorted sets so the empty result is kept with a placeholder.
+const noFriendSuggestions = "none"
+
+func friendSuggestionsKey(userID *primitive.ObjectID) string {
+	return fmt.Sprintf("user:suggestions:%s", userID.Hex())
+}
+
+// GetFriendIDs returns ids of the accepted friends of the user with a single query.
+func GetFriendIDs(ctx context.Context, db *mongo.Database, userID *primitive.ObjectID) ([]*primitive.ObjectID, error) {
+	return getRelatedUserIDs(ctx, db, userID, bson.M{"accepted": true})
+}
+
+// getRelatedUserIDs returns the other side of every friends row of the user
+// matching the given filter.
+func getRelatedUserIDs(ctx context.Context, db *mongo.Database, userID *primitive.ObjectID, filter bson.M) ([]*primitive.ObjectID, error) {
+
+	filter["$or"] = []interface{}{
+		bson.M{"friend_id": userID},
+		bson.M{"user_id": userID},
+	}
+
+	cursor, err := db.Collection("friends").Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	ids := make([]*primitive.ObjectID, 0)
+	for cursor.Next(ctx) {
+		friend := new(models.Friend)
+		if err := cursor.Decode(friend); err != nil {
+			continue
+		}
+		if friend.UserID.Hex() == userID.Hex() {
+			ids = append(ids, friend.FriendID)
+		} else {
+			ids = append(ids, friend.UserID)
+		}
+	}
+
+	return ids, nil
+}
+
+// GetFriendSuggestionExclusions returns ids of the users that should never be
+// suggested to the user: the user itself, friends, pending requests in both
+// directions and blocked users.
+func GetFriendSuggestionExclusions(ctx context.Context, db *mongo.Database, userID *primitive.ObjectID) (map[string]bool, error) {
+
+	excluded := map[string]bool{userID.Hex(): true}
+
+	relatedIDs, err := getRelatedUserIDs(ctx, db, userID, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	blockedIDs, err := GetBlockedUserIDs(ctx, db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range append(relatedIDs, blockedIDs...) {
+		excluded[id.Hex()] = true
+	}
+
+	return excluded, nil
+}
+
+// scoreUsersSharingTheaters adds the given score to every user that shares a
+// theater with the user in the given collection, following or membership.
+func scoreUsersSharingTheaters(ctx context.Context, collection *mongo.Collection, userID *primitive.ObjectID, score float64, scores map[string]float64) error {
+
+	theaterIDs, err := collection.Distinct(ctx, "theater_id", bson.M{"user_id": userID})
+	if err != nil {
+		return err
+	}
+
+	if len(theaterIDs) == 0 {
+		return nil
+	}
+
+	filter := bson.M{
+		"theater_id": bson.M{"$in": theaterIDs},
+		"user_id":    bson.M{"$ne": userID},
+	}
+
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		row := new(models.TheaterMember)
+		if err := cursor.Decode(row); err != nil || row.UserID == nil {
+			continue
+		}
+		scores[row.UserID.Hex()] += score
+	}
+
+	return nil
+}
+
+// ComputeFriendSuggestions ranks candidates for the user by mutual accepted
+// friends, theaters both users follow and theaters both users are members of.
+func ComputeFriendSuggestions(ctx context.Context, db *mongo.Database, userID *primitive.ObjectID) ([]*FriendSuggestion, error) {
+
+	scores := make(map[string]float64)
+
+	friendIDs, err := GetFriendIDs(ctx, db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(friendIDs) > 0 {
+
+		filter := bson.M{
+			"accepted": true,
+			"$or": []interface{}{
+				bson.M{"friend_id": bson.M{"$in": friendIDs}},
+				bson.M{"user_id": bson.M{"$in": friendIDs}},
+			},
+		}
+
+		cursor, err := db.Collection("friends").Find(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+
+		isFriend := make(map[string]bool, len(friendIDs))
+		for _, id := range friendIDs {
+			isFriend[id.Hex()] = true
+		}
+
+		for cursor.Next(ctx) {
+			friend := new(models.Friend)
+			if err := cursor.Decode(friend); err != nil {
+				continue
+			}
+			if isFriend[friend.UserID.Hex()] {
+				scores[friend.FriendID.Hex()] += mutualFriendScore
+			}
+			if isFriend[friend.FriendID.Hex()] {
+				scores[friend.UserID.Hex()] += mutualFriendScore
+			}
+		}
+
+		_ = cursor.Close(ctx)
+	}
+
+	if err := scoreUsersSharingTheaters(ctx, db.Collection("follows"), userID, sharedFollowScore, scores); err != nil {
+		return nil, err
+	}
+
+	if err := scoreUsersSharingTheaters(ctx, db.Collection("theater_members"), userID, sharedTheaterScore, scores); err != nil {
+		return nil, err
+	}
+
+	excluded, err := GetFriendSuggestionExclusions(ctx, db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	suggestions := make([]*FriendSuggestion, 0)
+	for hexID, score := range scores {
+		if excluded[hexID] {
+			continue
+		}
+		candidateID, err := primitive.ObjectIDFromHex(hexID)
+		if err != nil {
+			continue
+		}
+		suggestions = append(suggestions, &FriendSuggestion{UserID: &candidateID, Score: score})
+	}
+
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Score == suggestions[j].Score {
+			return suggestions[i].UserID.Hex() < suggestions[j].UserID.Hex()
+		}
+		return suggestions[i].Score > suggestions[j].Score
+	})
+
+	if len(suggestions) > MaxFriendSuggestions {
+		suggestions = suggestions[:MaxFriendSuggestions]
+	}
+
+	return suggestions, nil
+}
+
+// StoreFriendSuggestions replaces the cached suggestions of the user in redis.
+func StoreFriendSuggestions(ctx *core.Context, userID *primitive.ObjectID, suggestions []*FriendSuggestion, ttl time.Duration) error {
+
+	redisConn, err := ctx.Get("redis.conn")
+	if err != nil {
+		return err
+	}
+
+	var (
+		key      = friendSuggestionsKey(userID)
+		pipeline = redisConn.(*redis.Client).TxPipeline()
+		members  = make([]*redis.Z, 0, len(suggestions))
+	)
+
+	for _, suggestion := range suggestions {
+		members = append(members, &redis.Z{
+			Score:  suggestion.Score,
+			Member: suggestion.UserID.Hex(),
+		})
+	}
+
+	if len(members) == 0 {
+		members = append(members, &redis.Z{Member: noFriendSuggestions})
+	}
+
+	pipeline.Del(ctx, key)
+	pipeline.ZAdd(ctx, key, members...)
+	pipeline.Expire(ctx, key, ttl)
+
+	_, err = pipeline.Exec(ctx)
+	return err
+}
+
+// GetCachedFriendSuggestions returns the ranked user ids cached for the user,
+// the second return value is false when nothing is cached yet.
+func GetCachedFriendSuggestions(ctx *core.Context, userID *primitive.ObjectID, limit int64) ([]*primitive.ObjectID, bool, error) {
+
+	redisConn, err := ctx.Get("redis.conn")
+	if err != nil {
+		return nil, false, err
+	}
+
+	hexIDs, err := redisConn.(*redis.Client).ZRevRange(ctx, friendSuggestionsKey(userID), 0, limit-1).Result()
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(hexIDs) == 0 {
+		return nil, false, nil
+	}
+
+	ids := make([]*primitive.ObjectID, 0, len(hexIDs))
+	for _, hexID := range hexIDs {
+		if hexID == noFriendSuggestions {
+			continue
+		}
+		id, err := primitive.ObjectIDFromHex(hexID)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, &id)
+	}
+
+	return ids, true, nil
+}
@@ -2,15 +2,20 @@ package helpers
 
 import (
 	"context"
+	"strings"
 
 	"github.com/castyapp/grpc.server/models"
+	"github.com/castyapp/grpc.server/storage"
+	"github.com/castyapp/grpc.server/uploads"
 	"github.com/castyapp/libcasty-protocol-go/proto"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
-func NewTheaterProto(ctx context.Context, db *mongo.Database, theater *models.Theater) (*proto.Theater, error) {
+// NewTheaterProto returns the theater for the viewer, the viewer is nil for guests.
+func NewTheaterProto(ctx context.Context, db *mongo.Database, viewerID *primitive.ObjectID, theater *models.Theater) (*proto.Theater, error) {
 
 	var (
 		thUser                  = new(models.User)
@@ -35,13 +40,27 @@ func NewTheaterProto(ctx context.Context, db *mongo.Database, theater *models.Th
 	return &proto.Theater{
 		Id:                theater.ID.Hex(),
 		Description:       theater.Description,
-		User:              NewProtoUser(thUser),
+		User:              NewProtoUser(thUser, GetRelation(ctx, db, viewerID, theater.UserID)),
 		MediaSource:       mediaSourceProtoMessage,
 		Privacy:           theater.Privacy,
 		VideoPlayerAccess: theater.VideoPlayerAccess,
 	}, nil
 }
 
+// mediaSourceReadURL returns the url that clients play the media source with. Only the upload of
+// the media source itself is presigned, an object uri that is not one of the uploads of its
+// owner has no url.
+func mediaSourceReadURL(ms *models.MediaSource) string {
+	_, key, ok := storage.ParseObjectURI(ms.URI)
+	if !ok {
+		return ms.URI
+	}
+	if ms.UserID == nil || ms.ObjectKey == "" || key != ms.ObjectKey || !strings.HasPrefix(key, uploads.UserPrefix(ms.UserID)) {
+		return ""
+	}
+	return storage.ReadURL(ms.URI)
+}
+
 func NewMediaSourceProto(ms *models.MediaSource) *proto.MediaSource {
 	createdAt := timestamppb.New(ms.CreatedAt)
 	updatedAt := timestamppb.New(ms.UpdatedAt)
@@ -50,7 +69,7 @@ func NewMediaSourceProto(ms *models.MediaSource) *proto.MediaSource {
 		Title:     ms.Title,
 		Type:      ms.Type,
 		Banner:    ms.Banner,
-		Uri:       ms.URI,
+		Uri:       mediaSourceReadURL(ms),
 		Length:    ms.Length,
 		Artist:    ms.Artist,
 		Subtitles: make([]*proto.Subtitle, 0),
@@ -59,6 +78,9 @@ func NewMediaSourceProto(ms *models.MediaSource) *proto.MediaSource {
 	}
 }
 
+// NewSubtitleProto returns the subtitle for clients. The label, flags, default selection and
+// offset of subtitles have no fields in proto.Subtitle yet, UpdateSubtitle and SyncSubtitle
+// return them next to it.
 func NewSubtitleProto(s *models.Subtitle) (*proto.Subtitle, error) {
 	createdAt := timestamppb.New(s.CreatedAt)
 	updatedAt := timestamppb.New(s.UpdatedAt)
@@ -66,8 +88,68 @@ func NewSubtitleProto(s *models.Subtitle) (*proto.Subtitle, error) {
 		Id:            s.ID.Hex(),
 		Lang:          s.Lang,
 		MediaSourceId: s.MediaSourceID.Hex(),
-		File:          s.File,
+		File:          storage.ReadURL(s.File),
 		CreatedAt:     createdAt,
 		UpdatedAt:     updatedAt,
 	}, nil
 }
+
+// IsTheaterMember reports whether the user has joined the theater.
+func IsTheaterMember(ctx context.Context, db *mongo.Database, theater *models.Theater, userID *primitive.ObjectID) (bool, error) {
+	count, err := db.Collection("theater_members").CountDocuments(ctx, bson.M{"theater_id": theater.ID, "user_id": userID})
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// HasVideoPlayerAccess reports whether the access mode of the theater lets the user control
+// its video player, which is selecting its media, changing its subtitles and its playback.
+// The owner always can.
+func HasVideoPlayerAccess(ctx context.Context, db *mongo.Database, theater *models.Theater, user *models.User) (bool, error) {
+
+	if theater.UserID.Hex() == user.ID.Hex() {
+		return true, nil
+	}
+
+	switch theater.VideoPlayerAccess {
+	case proto.VIDEO_PLAYER_ACCESS_ACCESS_BY_EVERYONE:
+	case proto.VIDEO_PLAYER_ACCESS_ACCESS_BY_FRIENDS:
+		if GetRelation(ctx, db, user.ID, theater.UserID) != models.RelationFriend {
+			return false, nil
+		}
+	case proto.VIDEO_PLAYER_ACCESS_ACCESS_BY_CHOOSEN_FRIENDS:
+		chosen := false
+		for _, userID := range theater.VideoPlayerUserIDs {
+			if userID.Hex() == user.ID.Hex() {
+				chosen = true
+				break
+			}
+		}
+		if !chosen {
+			return false, nil
+		}
+	default:
+		// ACCESS_BY_USER leaves the video player to the owner
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// CanControlVideoPlayer reports whether the user can control the video player of the theater,
+// besides the access mode the users other than the owner have to be members of the theater,
+// which they become by joining it.
+func CanControlVideoPlayer(ctx context.Context, db *mongo.Database, theater *models.Theater, user *models.User) (bool, error) {
+
+	allowed, err := HasVideoPlayerAccess(ctx, db, theater, user)
+	if err != nil || !allowed {
+		return false, err
+	}
+
+	if theater.UserID.Hex() == user.ID.Hex() {
+		return true, nil
+	}
+
+	return IsTheaterMember(ctx, db, theater, user.ID)
+}
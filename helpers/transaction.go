@@ -0,0 +1,59 @@
+package helpers
+
+import (
+	"context"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// transactionSupport caches whether the mongodb server of a client supports transactions.
+var transactionSupport sync.Map
+
+// supportsTransactions tells if the server is a replica set or a sharded cluster,
+// standalone servers, like the one of the docker setup, have no transactions.
+func supportsTransactions(ctx context.Context, db *mongo.Database) (bool, error) {
+
+	if supported, ok := transactionSupport.Load(db.Client()); ok {
+		return supported.(bool), nil
+	}
+
+	reply := struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}{}
+
+	if err := db.RunCommand(ctx, bson.D{{Key: "isMaster", Value: 1}}).Decode(&reply); err != nil {
+		return false, err
+	}
+
+	supported := reply.SetName != "" || reply.Msg == "isdbgrid"
+	transactionSupport.Store(db.Client(), supported)
+	return supported, nil
+}
+
+// WithTransaction runs fn in a transaction when the server supports them, otherwise fn runs
+// on its own. fn should make its writes in an order that is safe to run again after a failure,
+// since a standalone server keeps the writes that were made before it failed.
+func WithTransaction(ctx context.Context, db *mongo.Database, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+
+	supported, err := supportsTransactions(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	if !supported {
+		return fn(ctx)
+	}
+
+	session, err := db.Client().StartSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.EndSession(ctx)
+
+	return session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return fn(sc)
+	})
+}
@@ -1,6 +1,7 @@
 package helpers
 
 import (
+	"context"
 	"fmt"
 	"log"
 
@@ -9,6 +10,7 @@ import (
 	"github.com/castyapp/libcasty-protocol-go/proto"
 	"github.com/go-redis/redis/v8"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -55,7 +57,7 @@ func GetFriendsFromDatabase(ctx *core.Context, user *models.User) ([]*proto.User
 			continue
 		}
 
-		friends = append(friends, NewProtoUserWithState(friendUserObject))
+		friends = append(friends, NewProtoUserWithState(friendUserObject, models.RelationFriend))
 	}
 
 	return friends, nil
@@ -101,27 +103,87 @@ func SendEventToTheaterMembers(ctx *core.Context, event []byte, theater *models.
 	return
 }
 
-func NewProtoUser(u *models.User) *proto.User {
-	return &proto.User{
-		Id:            u.ID.Hex(),
-		Fullname:      u.Fullname,
-		Username:      u.Username,
-		Hash:          u.Hash,
-		Email:         u.Email,
-		IsActive:      u.IsActive,
-		IsStaff:       u.IsStaff,
-		Verified:      u.Verified,
-		EmailVerified: u.EmailVerified,
-		Avatar:        u.Avatar,
-		TwoFaEnabled:  u.TwoFactorAuthEnabled,
-		LastLogin:     timestamppb.New(u.LastLogin),
-		JoinedAt:      timestamppb.New(u.JoinedAt),
-		UpdatedAt:     timestamppb.New(u.UpdatedAt),
+// GetRelation returns how the viewer relates to the user.
+func GetRelation(ctx context.Context, db *mongo.Database, viewerID, userID *primitive.ObjectID) models.Relation {
+	if viewerID == nil || userID == nil {
+		return models.RelationStranger
 	}
+	if viewerID.Hex() == userID.Hex() {
+		return models.RelationSelf
+	}
+	filter := bson.M{
+		"accepted": true,
+		"$or": []interface{}{
+			bson.M{
+				"friend_id": viewerID,
+				"user_id":   userID,
+			},
+			bson.M{
+				"user_id":   viewerID,
+				"friend_id": userID,
+			},
+		},
+	}
+	count, err := db.Collection("friends").CountDocuments(ctx, filter)
+	if err != nil || count == 0 {
+		return models.RelationStranger
+	}
+	return models.RelationFriend
+}
+
+// NewProtoUser converts the user to protobuf as it should be seen by a viewer
+// with the given relation. Account details are only shown to the user itself.
+func NewProtoUser(u *models.User, relation models.Relation) *proto.User {
+	protoUser := &proto.User{
+		Id:        u.ID.Hex(),
+		Fullname:  u.Fullname,
+		Username:  u.Username,
+		IsActive:  u.IsActive,
+		IsStaff:   u.IsStaff,
+		Verified:  u.Verified,
+		Avatar:    u.Avatar,
+		JoinedAt:  timestamppb.New(u.JoinedAt),
+		UpdatedAt: timestamppb.New(u.UpdatedAt),
+	}
+	if u.Visibility.Email.Allows(relation, models.VisibilityOnlyMe) {
+		protoUser.Email = u.Email
+	}
+	if relation == models.RelationSelf {
+		protoUser.Hash = u.Hash
+		protoUser.EmailVerified = u.EmailVerified
+		protoUser.TwoFaEnabled = u.TwoFactorAuthEnabled
+		protoUser.LastLogin = timestamppb.New(u.LastLogin)
+	}
+	return protoUser
 }
 
-func NewProtoUserWithState(user *models.User) *proto.User {
-	protoUser := NewProtoUser(user)
+func NewProtoUserWithState(user *models.User, relation models.Relation) *proto.User {
+	protoUser := NewProtoUser(user, relation)
 	protoUser.State = user.State
 	return protoUser
 }
+
+// NewVisibleProfile returns the profile of the user with the fields that
+// a viewer with the given relation is not allowed to see left empty.
+func NewVisibleProfile(u *models.User, relation models.Relation) models.Profile {
+	var (
+		v       = u.Visibility
+		profile = models.Profile{Banner: u.Profile.Banner}
+	)
+	if v.Bio.Allows(relation, models.VisibilityPublic) {
+		profile.Bio = u.Profile.Bio
+	}
+	if v.Location.Allows(relation, models.VisibilityPublic) {
+		profile.Location = u.Profile.Location
+	}
+	if v.Links.Allows(relation, models.VisibilityPublic) {
+		profile.Links = u.Profile.Links
+	}
+	if v.FavouriteMedia.Allows(relation, models.VisibilityPublic) {
+		profile.FavouriteMedia = u.Profile.FavouriteMedia
+	}
+	if v.Timezone.Allows(relation, models.VisibilityPublic) {
+		profile.Timezone = u.Profile.Timezone
+	}
+	return profile
+}
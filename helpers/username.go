@@ -0,0 +1,110 @@
+package helpers
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/castyapp/grpc.server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FindUserByUsername finds a user by the current username, or by an old
+// username that has not been reclaimed yet.
+func FindUserByUsername(ctx context.Context, db *mongo.Database, username string) (*models.User, error) {
+
+	var (
+		user            = new(models.User)
+		history         = new(models.UsernameHistory)
+		usersCollection = db.Collection("users")
+	)
+
+	username = strings.ToLower(username)
+
+	err := usersCollection.FindOne(ctx, bson.M{"username": username}).Decode(user)
+	if err == nil {
+		return user, nil
+	}
+
+	if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	filter := bson.M{
+		"username":       username,
+		"reclaimable_at": bson.M{"$gt": time.Now()},
+	}
+
+	if err := db.Collection("username_history").FindOne(ctx, filter).Decode(history); err != nil {
+		return nil, err
+	}
+
+	if err := usersCollection.FindOne(ctx, bson.M{"_id": history.UserID}).Decode(user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// IsUsernameReserved reports whether the username is an old handle of another
+// user that can not be reclaimed yet.
+func IsUsernameReserved(ctx context.Context, db *mongo.Database, username string, userID *primitive.ObjectID) (bool, error) {
+	filter := bson.M{
+		"username":       strings.ToLower(username),
+		"reclaimable_at": bson.M{"$gt": time.Now()},
+	}
+	if userID != nil {
+		filter["user_id"] = bson.M{"$ne": userID}
+	}
+	count, err := db.Collection("username_history").CountDocuments(ctx, filter)
+	if err != nil {
+		return false, err
+	}
+	return count != 0, nil
+}
+
+// CreateUsernameIndexes makes usernames unique, both the current usernames of users and the old
+// usernames that are kept in the history. Old usernames are unique since a handle is held by one
+// user at a time, history rows of a handle that were reclaimed are removed before it's kept again.
+func CreateUsernameIndexes(ctx context.Context, db *mongo.Database) error {
+
+	if err := dropNonUniqueIndex(ctx, db.Collection("users"), "username_1"); err != nil {
+		return err
+	}
+
+	_, err := db.Collection("users").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "username", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		if !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+		// the usernames that were taken twice can not be fixed here, the users have to be renamed first
+		log.Printf("usernames are not unique, users with a duplicate username have to be renamed: %v", err)
+	}
+
+	historyCollection := db.Collection("username_history")
+	if err := dropNonUniqueIndex(ctx, historyCollection, "username_1"); err != nil {
+		return err
+	}
+
+	// the latest row of every old username is kept, the older rows were reclaimed
+	keep := bson.D{{Key: "changed_at", Value: -1}, {Key: "_id", Value: -1}}
+	if err := deleteDuplicates(ctx, historyCollection, "$username", keep); err != nil {
+		return err
+	}
+
+	_, err = historyCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "username", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+	})
+	return err
+}
@@ -0,0 +1,247 @@
+package images
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+// maxPixels guards against decompression bombs, images are rejected before
+// they are decoded if their dimensions are larger than this.
+const maxPixels = 40 * 1000 * 1000
+
+var (
+	ErrTooLarge          = errors.New("image is too large")
+	ErrUnsupportedFormat = errors.New("image format is not supported")
+	ErrInvalidImage      = errors.New("image is invalid")
+)
+
+type Format int
+
+const (
+	PNG Format = iota
+	JPEG
+)
+
+func (f Format) Extension() string {
+	if f == JPEG {
+		return "jpg"
+	}
+	return "png"
+}
+
+func (f Format) ContentType() string {
+	if f == JPEG {
+		return "image/jpeg"
+	}
+	return "image/png"
+}
+
+type Size struct {
+	Width  int
+	Height int
+}
+
+func (s Size) String() string {
+	return fmt.Sprintf("%dx%d", s.Width, s.Height)
+}
+
+// Spec describes how an uploaded image is processed, every size is cropped
+// to the aspect ratio of the first size. The first size is the original one.
+type Spec struct {
+	MaxBytes int64
+	Format   Format
+	Sizes    []Size
+}
+
+var (
+	Avatar = Spec{
+		MaxBytes: 5 << 20,
+		Format:   PNG,
+		Sizes: []Size{
+			{Width: 512, Height: 512},
+			{Width: 256, Height: 256},
+			{Width: 128, Height: 128},
+			{Width: 64, Height: 64},
+		},
+	}
+	Banner = Spec{
+		MaxBytes: 10 << 20,
+		Format:   PNG,
+		Sizes: []Size{
+			{Width: 1500, Height: 500},
+			{Width: 600, Height: 200},
+		},
+	}
+)
+
+type Variant struct {
+	Size Size
+	Data []byte
+}
+
+// Sniff detects the content type of the image from its content, whatever
+// the client claims it to be.
+func Sniff(data []byte) (string, error) {
+	contentType := http.DetectContentType(data)
+	switch contentType {
+	case "image/png", "image/jpeg", "image/gif", "image/webp":
+		return contentType, nil
+	}
+	return contentType, ErrUnsupportedFormat
+}
+
+func Decode(data []byte) (image.Image, error) {
+
+	contentType, err := Sniff(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		config image.Config
+		reader = bytes.NewReader(data)
+		decode func([]byte) (image.Image, error)
+	)
+
+	switch contentType {
+	case "image/png":
+		config, err = png.DecodeConfig(reader)
+		decode = func(b []byte) (image.Image, error) { return png.Decode(bytes.NewReader(b)) }
+	case "image/jpeg":
+		config, err = jpeg.DecodeConfig(reader)
+		decode = func(b []byte) (image.Image, error) { return jpeg.Decode(bytes.NewReader(b)) }
+	case "image/gif":
+		// only the first frame of animated gifs is used
+		config, err = gif.DecodeConfig(reader)
+		decode = func(b []byte) (image.Image, error) { return gif.Decode(bytes.NewReader(b)) }
+	case "image/webp":
+		config, err = webp.DecodeConfig(reader)
+		decode = func(b []byte) (image.Image, error) { return webp.Decode(bytes.NewReader(b)) }
+	}
+
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, ErrInvalidImage
+	}
+
+	if config.Width*config.Height > maxPixels {
+		return nil, ErrTooLarge
+	}
+
+	img, err := decode(data)
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	return img, nil
+}
+
+// CenterCrop crops the largest centered area of the image with the given aspect ratio.
+func CenterCrop(img image.Image, aspectWidth, aspectHeight int) image.Image {
+
+	var (
+		bounds = img.Bounds()
+		width  = bounds.Dx()
+		height = bounds.Dy()
+	)
+
+	cropWidth, cropHeight := width, width*aspectHeight/aspectWidth
+	if cropHeight > height {
+		cropWidth, cropHeight = height*aspectWidth/aspectHeight, height
+	}
+
+	var (
+		x0   = bounds.Min.X + (width-cropWidth)/2
+		y0   = bounds.Min.Y + (height-cropHeight)/2
+		rect = image.Rect(0, 0, cropWidth, cropHeight)
+		dst  = image.NewRGBA(rect)
+	)
+
+	draw.Draw(dst, rect, img, image.Pt(x0, y0), draw.Src)
+	return dst
+}
+
+func Resize(img image.Image, size Size) image.Image {
+	dst := image.NewRGBA(image.Rect(0, 0, size.Width, size.Height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Src, nil)
+	return dst
+}
+
+func Encode(img image.Image, format Format) ([]byte, error) {
+	buffer := new(bytes.Buffer)
+	var err error
+	switch format {
+	case JPEG:
+		err = jpeg.Encode(buffer, img, &jpeg.Options{Quality: 85})
+	default:
+		err = png.Encode(buffer, img)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// Process decodes the image, center-crops and resizes it to every size of the
+// spec and re-encodes the results. Nothing of the original file is kept, so
+// metadata like exif is dropped.
+func Process(data []byte, spec Spec) ([]*Variant, error) {
+
+	if int64(len(data)) > spec.MaxBytes {
+		return nil, ErrTooLarge
+	}
+
+	if len(spec.Sizes) == 0 {
+		return nil, errors.New("image spec has no sizes")
+	}
+
+	img, err := Decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		aspect   = spec.Sizes[0]
+		cropped  = CenterCrop(img, aspect.Width, aspect.Height)
+		variants = make([]*Variant, 0, len(spec.Sizes))
+	)
+
+	for _, size := range spec.Sizes {
+		encoded, err := Encode(Resize(cropped, size), spec.Format)
+		if err != nil {
+			return nil, err
+		}
+		variants = append(variants, &Variant{Size: size, Data: encoded})
+	}
+
+	return variants, nil
+}
+
+// Convert decodes the image and re-encodes it in the format without resizing it, so the
+// stored image always is what its name and content type say. Like Process, nothing of the
+// original file is kept.
+func Convert(data []byte, maxBytes int64, format Format) ([]byte, error) {
+
+	if int64(len(data)) > maxBytes {
+		return nil, ErrTooLarge
+	}
+
+	img, err := Decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return Encode(img, format)
+}
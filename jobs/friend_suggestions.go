@@ -0,0 +1,102 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/castyapp/grpc.server/config"
+	"github.com/castyapp/grpc.server/core"
+	"github.com/castyapp/grpc.server/helpers"
+	"github.com/castyapp/grpc.server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const defaultFriendSuggestionsInterval = time.Hour
+
+// FriendSuggestions periodically precomputes "people you may know"
+// suggestions of every active user into redis.
+type FriendSuggestions struct {
+	interval time.Duration
+	stop     chan struct{}
+}
+
+func (j *FriendSuggestions) Register(ctx *core.Context) error {
+	cm := ctx.MustGet("config.map").(*config.Map)
+	if !cm.Jobs.FriendSuggestions.Enabled {
+		return nil
+	}
+	j.interval = cm.Jobs.FriendSuggestions.GetInterval(defaultFriendSuggestionsInterval)
+	j.stop = make(chan struct{})
+	go j.run(ctx)
+	return nil
+}
+
+func (j *FriendSuggestions) Close(ctx *core.Context) error {
+	if j.stop != nil {
+		close(j.stop)
+	}
+	return nil
+}
+
+func (j *FriendSuggestions) run(ctx *core.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	for {
+		if err := j.computeAll(ctx); err != nil {
+			log.Printf("could not compute friend suggestions: %v", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-j.stop:
+			return
+		}
+	}
+}
+
+func (j *FriendSuggestions) computeAll(ctx *core.Context) error {
+
+	dbConn, err := ctx.Get("db.mongo")
+	if err != nil {
+		return err
+	}
+
+	var (
+		db   = dbConn.(*mongo.Database)
+		opts = options.Find().SetProjection(bson.M{"_id": 1})
+		// keep suggestions around until the next run has surely finished
+		ttl = 2 * j.interval
+	)
+
+	cursor, err := db.Collection("users").Find(ctx, bson.M{"is_active": true}, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		select {
+		case <-j.stop:
+			return nil
+		default:
+		}
+		user := new(models.User)
+		if err := cursor.Decode(user); err != nil {
+			continue
+		}
+		mCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		suggestions, err := helpers.ComputeFriendSuggestions(mCtx, db, user.ID)
+		cancel()
+		if err != nil {
+			log.Printf("could not compute friend suggestions of user [%s]: %v", user.ID.Hex(), err)
+			continue
+		}
+		if err := helpers.StoreFriendSuggestions(ctx, user.ID, suggestions, ttl); err != nil {
+			log.Printf("could not store friend suggestions of user [%s]: %v", user.ID.Hex(), err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,260 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/castyapp/grpc.server/core"
+	"github.com/castyapp/grpc.server/fetcher"
+	"github.com/castyapp/grpc.server/models"
+	"github.com/castyapp/grpc.server/probe"
+	"github.com/castyapp/grpc.server/storage"
+	"github.com/castyapp/libcasty-protocol-go/proto"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// permanentError fails a media job right away, retrying it would not help.
+type permanentError struct {
+	message string
+}
+
+func (e *permanentError) Error() string {
+	return e.message
+}
+
+// mediaJobRunner claims the media jobs of a kind from the media_jobs collection
+// and runs them one at a time, failed jobs are retried up to maxAttempts times.
+type mediaJobRunner struct {
+	kind        models.MediaJobKind
+	interval    time.Duration
+	timeout     time.Duration
+	maxAttempts int
+	// handle runs a job and returns the problems that did not fail the whole job
+	handle func(ctx context.Context, db *mongo.Database, job *models.MediaJob) ([]string, error)
+	app    *core.Context
+	stop   chan struct{}
+}
+
+func (r *mediaJobRunner) start(ctx *core.Context) {
+	r.app = ctx
+	r.stop = make(chan struct{})
+	go r.run()
+}
+
+func (r *mediaJobRunner) close() {
+	if r.stop != nil {
+		close(r.stop)
+	}
+}
+
+func (r *mediaJobRunner) run() {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		if err := r.runPending(); err != nil {
+			log.Printf("could not run %s media jobs: %v", r.kind, err)
+		}
+		select {
+		case <-ticker.C:
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+func (r *mediaJobRunner) stopped() bool {
+	select {
+	case <-r.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// runPending runs the pending jobs one by one until there are none left.
+func (r *mediaJobRunner) runPending() error {
+
+	dbConn, err := r.app.Get("db.mongo")
+	if err != nil {
+		return err
+	}
+
+	db := dbConn.(*mongo.Database)
+	if err := r.failAbandoned(r.app, db); err != nil {
+		return err
+	}
+
+	for !r.stopped() {
+		job, err := r.claim(r.app, db)
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		r.process(db, job)
+	}
+
+	return nil
+}
+
+// failAbandoned fails the jobs that timed out on their last attempt.
+func (r *mediaJobRunner) failAbandoned(ctx context.Context, db *mongo.Database) error {
+	var (
+		now    = time.Now()
+		filter = bson.M{
+			"kind":       r.kind,
+			"status":     models.MediaJobRunning,
+			"started_at": bson.M{"$lt": now.Add(-r.timeout)},
+			"attempts":   bson.M{"$gte": r.maxAttempts},
+		}
+		update = bson.M{
+			"$set": bson.M{
+				"status":      models.MediaJobFailed,
+				"error":       "Job timed out",
+				"finished_at": now,
+				"updated_at":  now,
+			},
+		}
+	)
+	_, err := db.Collection("media_jobs").UpdateMany(ctx, filter, update)
+	return err
+}
+
+// claim marks the oldest pending job as running, jobs that were left running
+// by a stopped server are claimed again once they time out.
+func (r *mediaJobRunner) claim(ctx context.Context, db *mongo.Database) (*models.MediaJob, error) {
+
+	var (
+		job    = new(models.MediaJob)
+		now    = time.Now()
+		filter = bson.M{
+			"kind":     r.kind,
+			"attempts": bson.M{"$lt": r.maxAttempts},
+			"$or": []interface{}{
+				bson.M{"status": models.MediaJobPending},
+				bson.M{"status": models.MediaJobRunning, "started_at": bson.M{"$lt": now.Add(-r.timeout)}},
+			},
+		}
+		update = bson.M{
+			"$set": bson.M{
+				"status":     models.MediaJobRunning,
+				"progress":   0,
+				"step":       "starting",
+				"started_at": now,
+				"updated_at": now,
+			},
+			"$inc":   bson.M{"attempts": 1},
+			"$unset": bson.M{"error": "", "warnings": ""},
+		}
+		opts = options.FindOneAndUpdate().
+			SetSort(bson.M{"created_at": 1}).
+			SetReturnDocument(options.After)
+	)
+
+	if err := db.Collection("media_jobs").FindOneAndUpdate(ctx, filter, update, opts).Decode(job); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+func (r *mediaJobRunner) process(db *mongo.Database, job *models.MediaJob) {
+
+	ctx, cancel := context.WithTimeout(r.app, r.timeout)
+	defer cancel()
+
+	warnings, err := r.handle(ctx, db, job)
+
+	var (
+		now = time.Now()
+		set = bson.M{"updated_at": now}
+	)
+
+	var permanent *permanentError
+	switch {
+	case err == nil:
+		set["status"] = models.MediaJobCompleted
+		set["progress"] = 100
+		set["step"] = ""
+		set["finished_at"] = now
+	case errors.As(err, &permanent) || job.Attempts >= r.maxAttempts:
+		set["status"] = models.MediaJobFailed
+		set["error"] = err.Error()
+		set["finished_at"] = now
+	default:
+		// retried on the next run
+		set["status"] = models.MediaJobPending
+		set["error"] = err.Error()
+	}
+
+	if len(warnings) > 0 {
+		set["warnings"] = warnings
+	}
+
+	if _, err := db.Collection("media_jobs").UpdateOne(r.app, bson.M{"_id": job.ID}, bson.M{"$set": set}); err != nil {
+		log.Println(err)
+	}
+}
+
+func setMediaJobProgress(ctx context.Context, db *mongo.Database, job *models.MediaJob, progress int, step string) {
+	update := bson.M{
+		"$set": bson.M{
+			"progress":   progress,
+			"step":       step,
+			"updated_at": time.Now(),
+		},
+	}
+	if _, err := db.Collection("media_jobs").UpdateOne(ctx, bson.M{"_id": job.ID}, update); err != nil {
+		log.Println(err)
+	}
+}
+
+// findJobMediaSource finds the media source of the job, the job fails when it was removed.
+func findJobMediaSource(ctx context.Context, db *mongo.Database, job *models.MediaJob) (*models.MediaSource, error) {
+	mediaSource := new(models.MediaSource)
+	if err := db.Collection("media_sources").FindOne(ctx, bson.M{"_id": job.MediaSourceID}).Decode(mediaSource); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, &permanentError{"Media source was removed"}
+		}
+		return nil, err
+	}
+	return mediaSource, nil
+}
+
+// mediaSourceURI returns an uri of the media source that ffmpeg can read, uploaded
+// media is read with a short-lived url and remote media is checked against internal addresses.
+// The uri is trusted when it's a url of our own storage.
+func mediaSourceURI(ctx context.Context, mediaSource *models.MediaSource, uploadsBucket string, ttl time.Duration) (string, bool, error) {
+
+	if mediaSource.ObjectKey != "" {
+		uri, err := storage.Client.Presign(http.MethodGet, uploadsBucket, mediaSource.ObjectKey, ttl)
+		if err == storage.ErrPresignNotSupported {
+			return "", false, &permanentError{"Storage backend can not share media files with ffmpeg"}
+		}
+		return uri, true, err
+	}
+
+	switch mediaSource.Type {
+	case proto.MediaSource_DOWNLOAD_URI, proto.MediaSource_M3U8:
+		if err := fetcher.CheckURL(ctx, mediaSource.URI); err != nil {
+			return "", false, &permanentError{"Media source uri is not allowed"}
+		}
+		return mediaSource.URI, false, nil
+	}
+
+	return "", false, &permanentError{"Media source can not be read by ffmpeg"}
+}
+
+// mediaReaders returns the prober and the extractor that read the uri, only trusted uris
+// are read without the address checking proxy.
+func mediaReaders(prober *probe.Prober, extractor *probe.Extractor, trusted bool) (*probe.Prober, *probe.Extractor) {
+	p, e := *prober, *extractor
+	p.Trusted, e.Trusted = trusted, trusted
+	return &p, &e
+}
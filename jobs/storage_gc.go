@@ -0,0 +1,486 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/castyapp/grpc.server/config"
+	"github.com/castyapp/grpc.server/core"
+	"github.com/castyapp/grpc.server/models"
+	"github.com/castyapp/grpc.server/services"
+	"github.com/castyapp/grpc.server/storage"
+	"github.com/go-redis/redis/v8"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	defaultStorageGCInterval = 6 * time.Hour
+
+	storageGCMetricsKey    = "storage:gc:metrics"
+	storageGCLastReportKey = "storage:gc:last_report"
+	// storageGCLockKey lets a single replica collect at a time
+	storageGCLockKey = "storage:gc:lock"
+
+	// maxReportedKeys bounds the orphan keys that are kept in a report
+	maxReportedKeys = 100
+)
+
+type BucketReport struct {
+	Bucket         string   `json:"bucket"`
+	Scanned        int      `json:"scanned"`
+	Orphans        int      `json:"orphans"`
+	Deleted        int      `json:"deleted"`
+	Failed         int      `json:"failed"`
+	ReclaimedBytes int64    `json:"reclaimed_bytes"`
+	Keys           []string `json:"keys,omitempty"`
+}
+
+type StorageGCReport struct {
+	DryRun            bool            `json:"dry_run"`
+	StartedAt         time.Time       `json:"started_at"`
+	FinishedAt        time.Time       `json:"finished_at"`
+	OrphanedSubtitles int64           `json:"orphaned_subtitles"`
+	StaleUploads      int64           `json:"stale_uploads"`
+	Buckets           []*BucketReport `json:"buckets"`
+}
+
+func (r *StorageGCReport) ReclaimedBytes() (total int64) {
+	for _, bucket := range r.Buckets {
+		total += bucket.ReclaimedBytes
+	}
+	return
+}
+
+// StorageGC deletes the objects of the storage buckets that are not referenced
+// by any document anymore, like posters of removed media sources or replaced avatars.
+type StorageGC struct {
+	interval time.Duration
+	grace    time.Duration
+	dryRun   bool
+	stop     chan struct{}
+}
+
+// bucketReferences tells which objects of a bucket are still in use.
+type bucketReferences struct {
+	bucket     string
+	referenced func(key string) bool
+}
+
+// NewStorageGC returns a collection that can be reconciled on its own, the job that runs
+// on an interval is registered as a provider instead.
+func NewStorageGC(grace time.Duration, dryRun bool) *StorageGC {
+	return &StorageGC{grace: grace, dryRun: dryRun, stop: make(chan struct{})}
+}
+
+func (j *StorageGC) Register(ctx *core.Context) error {
+	cm := ctx.MustGet("config.map").(*config.Map)
+	if !cm.Jobs.StorageGC.Enabled {
+		return nil
+	}
+	j.interval = cm.Jobs.StorageGC.GetInterval(defaultStorageGCInterval)
+	j.grace = cm.Jobs.StorageGC.GetGracePeriod()
+	j.dryRun = cm.Jobs.StorageGC.DryRun
+	j.stop = make(chan struct{})
+	go j.run(ctx)
+	return nil
+}
+
+func (j *StorageGC) Close(ctx *core.Context) error {
+	if j.stop != nil {
+		close(j.stop)
+	}
+	return nil
+}
+
+// unlockScript releases the lock only when it's still held by the same run.
+var unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// lock takes the lock of the collection for an interval, it returns false when another
+// replica holds it. The lock expires on its own when the replica that holds it stops.
+func (j *StorageGC) lock(ctx *core.Context) (string, bool) {
+	redisConn, err := ctx.Get("redis.conn")
+	if err != nil {
+		log.Printf("could not lock storage gc: %v", err)
+		return "", false
+	}
+	token := primitive.NewObjectID().Hex()
+	locked, err := redisConn.(*redis.Client).SetNX(ctx, storageGCLockKey, token, j.interval).Result()
+	if err != nil {
+		log.Printf("could not lock storage gc: %v", err)
+		return "", false
+	}
+	return token, locked
+}
+
+func (j *StorageGC) unlock(ctx *core.Context, token string) {
+	redisConn, err := ctx.Get("redis.conn")
+	if err != nil {
+		return
+	}
+	if err := unlockScript.Run(ctx, redisConn.(*redis.Client), []string{storageGCLockKey}, token).Err(); err != nil {
+		log.Printf("could not unlock storage gc: %v", err)
+	}
+}
+
+func (j *StorageGC) run(ctx *core.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	for {
+		if token, locked := j.lock(ctx); locked {
+			report, err := j.Reconcile(ctx)
+			if err != nil {
+				log.Printf("could not collect orphaned storage objects: %v", err)
+			} else {
+				j.record(ctx, report)
+			}
+			j.unlock(ctx, token)
+		}
+		select {
+		case <-ticker.C:
+		case <-j.stop:
+			return
+		}
+	}
+}
+
+// distinctStrings returns the values of the field, they are grouped with a cursor instead
+// of distinct, whose single reply would outgrow the document size limit on large collections.
+// Array fields are unwound so every element of them is a value, like distinct does.
+func distinctStrings(ctx context.Context, collection *mongo.Collection, field string, filter bson.M) (map[string]bool, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$unwind", Value: "$" + field}},
+		{{Key: "$group", Value: bson.M{"_id": "$" + field}}},
+	}
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	result := make(map[string]bool)
+	for cursor.Next(ctx) {
+		value := struct {
+			ID interface{} `bson:"_id"`
+		}{}
+		if err := cursor.Decode(&value); err != nil {
+			return nil, err
+		}
+		if str, ok := value.ID.(string); ok && str != "" {
+			result[str] = true
+		}
+	}
+	return result, cursor.Err()
+}
+
+func (j *StorageGC) references(ctx context.Context, db *mongo.Database, cm *config.Map) ([]*bucketReferences, error) {
+
+	avatars, err := distinctStrings(ctx, db.Collection("users"), "avatar", bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	banners, err := distinctStrings(ctx, db.Collection("users"), "profile.banner", bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	posters, err := distinctStrings(ctx, db.Collection("media_sources"), "banner", bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	uploads := make(map[string]bool)
+	for _, field := range []string{"object_key", "thumbnails.track", "thumbnails.sprites"} {
+		keys, err := distinctStrings(ctx, db.Collection("media_sources"), field, bson.M{})
+		if err != nil {
+			return nil, err
+		}
+		for key := range keys {
+			uploads[key] = true
+		}
+	}
+
+	subtitles, err := distinctStrings(ctx, db.Collection("subtitles"), "object_key", bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	// unfinished uploads are still waiting for the client to put their objects, or being completed
+	pending, err := distinctStrings(ctx, db.Collection("uploads"), "object_key", bson.M{
+		"status": bson.M{"$in": models.UnfinishedUploadStatuses},
+	})
+	if err != nil {
+		return nil, err
+	}
+	for key := range pending {
+		uploads[key] = true
+	}
+
+	imageReferenced := func(names map[string]bool) func(string) bool {
+		return func(key string) bool {
+			return names[services.ImageNameFromObject(key)]
+		}
+	}
+
+	return []*bucketReferences{
+		{bucket: storage.Buckets.Avatars, referenced: imageReferenced(avatars)},
+		{bucket: storage.Buckets.Banners, referenced: imageReferenced(banners)},
+		{bucket: storage.Buckets.Posters, referenced: imageReferenced(posters)},
+		{bucket: storage.Buckets.Subtitles, referenced: func(key string) bool { return subtitles[key] }},
+		{bucket: cm.Uploads.GetBucket(), referenced: func(key string) bool { return uploads[key] }},
+	}, nil
+}
+
+// orphanBatchSize is how many orphaned rows are deleted at a time
+const orphanBatchSize = 1000
+
+// deleteOrphans deletes the rows of the collection that match the filter and whose field points
+// at no document of the foreign collection, the rows are joined in the database and deleted in
+// batches so the size of the collections never matters. In dry-run mode they are only counted.
+func (j *StorageGC) deleteOrphans(ctx context.Context, db *mongo.Database, collection string, match bson.M, field, foreign string) (int64, error) {
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         foreign,
+			"localField":   field,
+			"foreignField": "_id",
+			"as":           "referenced",
+		}}},
+		{{Key: "$match", Value: bson.M{"referenced": bson.M{"$size": 0}}}},
+		{{Key: "$project", Value: bson.M{"_id": 1}}},
+	}
+
+	cursor, err := db.Collection(collection).Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var (
+		total int64
+		batch = make([]interface{}, 0, orphanBatchSize)
+	)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if j.dryRun {
+			total += int64(len(batch))
+		} else {
+			result, err := db.Collection(collection).DeleteMany(ctx, bson.M{"_id": bson.M{"$in": batch}})
+			if err != nil {
+				return err
+			}
+			total += result.DeletedCount
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	for cursor.Next(ctx) {
+		row := struct {
+			ID interface{} `bson:"_id"`
+		}{}
+		if err := cursor.Decode(&row); err != nil {
+			return total, err
+		}
+		batch = append(batch, row.ID)
+		if len(batch) == orphanBatchSize {
+			if err := flush(); err != nil {
+				return total, err
+			}
+		}
+	}
+
+	if err := cursor.Err(); err != nil {
+		return total, err
+	}
+
+	return total, flush()
+}
+
+// cleanupRows deletes the subtitles of removed media sources and uploads that
+// expired or whose media source or subtitle is removed, so their objects become orphans.
+func (j *StorageGC) cleanupRows(ctx context.Context, db *mongo.Database, report *StorageGCReport) (err error) {
+
+	report.OrphanedSubtitles, err = j.deleteOrphans(ctx, db, "subtitles", bson.M{}, "media_source_id", "media_sources")
+	if err != nil {
+		return err
+	}
+
+	expired := bson.M{
+		"status":     bson.M{"$in": models.UnfinishedUploadStatuses},
+		"expires_at": bson.M{"$lt": time.Now().Add(-j.grace)},
+	}
+
+	if j.dryRun {
+		report.StaleUploads, err = db.Collection("uploads").CountDocuments(ctx, expired)
+	} else {
+		var result *mongo.DeleteResult
+		if result, err = db.Collection("uploads").DeleteMany(ctx, expired); err == nil {
+			report.StaleUploads = result.DeletedCount
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	removedMedia, err := j.deleteOrphans(ctx, db, "uploads", bson.M{
+		"status":          models.UploadStatusCompleted,
+		"media_source_id": bson.M{"$exists": true},
+		"subtitle_id":     bson.M{"$exists": false},
+	}, "media_source_id", "media_sources")
+	if err != nil {
+		return err
+	}
+
+	removedSubtitles, err := j.deleteOrphans(ctx, db, "uploads", bson.M{
+		"status":      models.UploadStatusCompleted,
+		"subtitle_id": bson.M{"$exists": true},
+	}, "subtitle_id", "subtitles")
+	if err != nil {
+		return err
+	}
+
+	report.StaleUploads += removedMedia + removedSubtitles
+	return nil
+}
+
+func (j *StorageGC) collectBucket(refs *bucketReferences, cutoff time.Time) (*BucketReport, error) {
+
+	objects, err := storage.Client.List(refs.bucket, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		orphans = storage.Orphans(objects, refs.referenced, cutoff)
+		report  = &BucketReport{
+			Bucket:  refs.bucket,
+			Scanned: len(objects),
+			Orphans: len(orphans),
+		}
+	)
+
+	for _, orphan := range orphans {
+		if len(report.Keys) < maxReportedKeys {
+			report.Keys = append(report.Keys, orphan.Key)
+		}
+		if j.dryRun {
+			report.ReclaimedBytes += orphan.Size
+			continue
+		}
+		if err := storage.Client.Delete(refs.bucket, orphan.Key); err != nil {
+			log.Printf("could not delete orphaned object [%s/%s]: %v", refs.bucket, orphan.Key, err)
+			report.Failed++
+			continue
+		}
+		report.Deleted++
+		report.ReclaimedBytes += orphan.Size
+	}
+
+	return report, nil
+}
+
+// Reconcile runs a single collection, in dry-run mode nothing is deleted and
+// the report holds what would have been deleted.
+func (j *StorageGC) Reconcile(ctx *core.Context) (*StorageGCReport, error) {
+
+	dbConn, err := ctx.Get("db.mongo")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		db     = dbConn.(*mongo.Database)
+		cm     = ctx.MustGet("config.map").(*config.Map)
+		report = &StorageGCReport{DryRun: j.dryRun, StartedAt: time.Now()}
+		// objects are compared to the references that are read before listing them,
+		// so the grace period also covers objects put while collecting
+		cutoff = report.StartedAt.Add(-j.grace)
+	)
+
+	if err := j.cleanupRows(ctx, db, report); err != nil {
+		return nil, fmt.Errorf("could not cleanup orphaned rows: %v", err)
+	}
+
+	buckets, err := j.references(ctx, db, cm)
+	if err != nil {
+		return nil, fmt.Errorf("could not load storage references: %v", err)
+	}
+
+	for _, refs := range buckets {
+		select {
+		case <-j.stop:
+			return report, nil
+		default:
+		}
+		bucketReport, err := j.collectBucket(refs, cutoff)
+		if err != nil {
+			log.Printf("could not collect orphaned objects of bucket [%s]: %v", refs.bucket, err)
+			continue
+		}
+		report.Buckets = append(report.Buckets, bucketReport)
+	}
+
+	report.FinishedAt = time.Now()
+	return report, nil
+}
+
+// record logs the report and keeps the metrics of the collections in redis.
+func (j *StorageGC) record(ctx *core.Context, report *StorageGCReport) {
+
+	mode := "deleted"
+	if report.DryRun {
+		mode = "would delete"
+	}
+
+	for _, bucket := range report.Buckets {
+		log.Printf("storage gc: [%s] scanned %d objects, %s %d orphans (%d bytes)",
+			bucket.Bucket, bucket.Scanned, mode, bucket.Orphans, bucket.ReclaimedBytes)
+	}
+
+	redisConn, err := ctx.Get("redis.conn")
+	if err != nil {
+		return
+	}
+
+	var (
+		pipeline = redisConn.(*redis.Client).TxPipeline()
+		encoded  []byte
+	)
+
+	if encoded, err = json.Marshal(report); err == nil {
+		pipeline.Set(ctx, storageGCLastReportKey, encoded, 0)
+	}
+
+	pipeline.HIncrBy(ctx, storageGCMetricsKey, "runs", 1)
+	pipeline.HSet(ctx, storageGCMetricsKey, "last_run_at", report.FinishedAt.Unix())
+
+	if !report.DryRun {
+		deleted := 0
+		for _, bucket := range report.Buckets {
+			deleted += bucket.Deleted
+		}
+		pipeline.HIncrBy(ctx, storageGCMetricsKey, "deleted_objects", int64(deleted))
+		pipeline.HIncrBy(ctx, storageGCMetricsKey, "reclaimed_bytes", report.ReclaimedBytes())
+		pipeline.HIncrBy(ctx, storageGCMetricsKey, "deleted_subtitles", report.OrphanedSubtitles)
+		pipeline.HIncrBy(ctx, storageGCMetricsKey, "deleted_uploads", report.StaleUploads)
+	}
+
+	if _, err := pipeline.Exec(ctx); err != nil {
+		log.Printf("could not record storage gc metrics: %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/castyapp/grpc.server/config"
+	"github.com/castyapp/grpc.server/core"
+	"github.com/castyapp/grpc.server/helpers"
+	"github.com/castyapp/grpc.server/models"
+	"github.com/castyapp/grpc.server/probe"
+	"github.com/castyapp/grpc.server/services"
+	"github.com/castyapp/grpc.server/storage"
+	"github.com/castyapp/grpc.server/thumbnails"
+	"github.com/castyapp/grpc.server/uploads"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const defaultThumbnailsInterval = 30 * time.Second
+
+// Thumbnails generates a poster frame for media sources without a banner and
+// the seek preview sprites with their WebVTT thumbnail track.
+type Thumbnails struct {
+	mediaJobRunner
+	bucket    string
+	prober    *probe.Prober
+	extractor *probe.Extractor
+}
+
+func (j *Thumbnails) Register(ctx *core.Context) error {
+	cm := ctx.MustGet("config.map").(*config.Map)
+	if !cm.Jobs.Thumbnails.Enabled {
+		return nil
+	}
+	j.mediaJobRunner = mediaJobRunner{
+		kind:        models.MediaJobThumbnails,
+		interval:    cm.Jobs.Thumbnails.GetInterval(defaultThumbnailsInterval),
+		timeout:     cm.Jobs.Thumbnails.GetTimeout(),
+		maxAttempts: cm.Jobs.Thumbnails.GetMaxAttempts(),
+		handle:      j.generate,
+	}
+	j.bucket = cm.Uploads.GetBucket()
+	j.prober = &probe.Prober{Path: cm.Probe.FFprobePath, Timeout: cm.Probe.GetTimeout()}
+	j.extractor = &probe.Extractor{Path: cm.Probe.FFmpegPath, Timeout: j.timeout, MaxBytes: 10 << 20}
+	j.start(ctx)
+	return nil
+}
+
+func (j *Thumbnails) Close(ctx *core.Context) error {
+	j.close()
+	return nil
+}
+
+func (j *Thumbnails) put(key string, data []byte, contentType string) error {
+	return storage.Client.Put(j.bucket, key, bytes.NewReader(data), int64(len(data)), contentType)
+}
+
+func (j *Thumbnails) generate(ctx context.Context, db *mongo.Database, job *models.MediaJob) ([]string, error) {
+
+	mediaSource, err := findJobMediaSource(ctx, db, job)
+	if err != nil {
+		return nil, err
+	}
+
+	uri, trusted, err := mediaSourceURI(ctx, mediaSource, j.bucket, j.timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	prober, extractor := mediaReaders(j.prober, j.extractor, trusted)
+
+	mediaProbe := mediaSource.Probe
+	if mediaProbe == nil {
+		if mediaProbe, err = prober.Probe(ctx, uri); err != nil {
+			if err == probe.ErrNotInstalled || err == probe.ErrNoStreams {
+				return nil, &permanentError{err.Error()}
+			}
+			return nil, err
+		}
+	}
+
+	if mediaProbe.VideoCodec == "" {
+		return nil, &permanentError{"Media source has no video"}
+	}
+
+	var (
+		warnings = make([]string, 0)
+		duration = time.Duration(mediaProbe.Duration * float64(time.Second))
+		set      = bson.M{"updated_at": time.Now()}
+	)
+
+	if mediaSource.Banner == "" || mediaSource.Banner == "default" {
+		setMediaJobProgress(ctx, db, job, 5, "generating poster")
+		poster, err := extractor.Frame(ctx, uri, thumbnails.PosterOffset(duration), thumbnails.PosterWidth)
+		switch err {
+		case nil:
+			name := services.RandomNumber(20)
+			if err := storage.Client.Put(storage.Buckets.Posters, fmt.Sprintf("%s.png", name), bytes.NewReader(poster), int64(len(poster)), "image/png"); err != nil {
+				return nil, err
+			}
+			set["banner"] = name
+			mediaSource.Banner = name
+		case probe.ErrFFmpegNotInstalled:
+			return nil, &permanentError{err.Error()}
+		default:
+			warnings = append(warnings, fmt.Sprintf("Poster: %v", err))
+		}
+	}
+
+	// live streams have no duration to preview
+	if duration > 0 {
+		setMediaJobProgress(ctx, db, job, 20, "generating seek previews")
+		previews, err := j.generatePreviews(ctx, extractor, mediaSource, uri, duration)
+		switch err {
+		case nil:
+			set["thumbnails"] = previews
+			mediaSource.Thumbnails = previews
+		case probe.ErrFFmpegNotInstalled:
+			return nil, &permanentError{err.Error()}
+		default:
+			warnings = append(warnings, fmt.Sprintf("Seek previews: %v", err))
+		}
+	}
+
+	if _, err := db.Collection("media_sources").UpdateOne(ctx, bson.M{"_id": mediaSource.ID}, bson.M{"$set": set}); err != nil {
+		return nil, err
+	}
+
+	helpers.SendMediaSourceChangedEvents(j.app, db, mediaSource)
+
+	return warnings, nil
+}
+
+// generatePreviews renders the sprite sheets and stores them with their thumbnail
+// track, sheets of an earlier run that are not overwritten are removed.
+func (j *Thumbnails) generatePreviews(ctx context.Context, extractor *probe.Extractor, mediaSource *models.MediaSource, uri string, duration time.Duration) (*models.MediaThumbnails, error) {
+
+	layout := thumbnails.NewLayout(duration)
+	sheets, err := extractor.Sprites(ctx, uri, layout.Interval, layout.Width, layout.Height, layout.Columns, layout.Rows)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		prefix  = uploads.MediaAssetsPrefix(mediaSource.UserID, mediaSource.ID)
+		written = make(map[string]bool, len(sheets))
+		result  = &models.MediaThumbnails{
+			Interval:    layout.Interval.Seconds(),
+			Width:       layout.Width,
+			Height:      layout.Height,
+			Track:       prefix + thumbnails.TrackName,
+			Sprites:     make([]string, 0, len(sheets)),
+			GeneratedAt: time.Now(),
+		}
+	)
+
+	// ffmpeg may render one sheet less or more than the layout expects when the
+	// probed duration is off, the track only points at the sheets that exist
+	if len(sheets) < layout.Sheets() {
+		layout.Count = len(sheets) * layout.Columns * layout.Rows
+	}
+
+	for i, sheet := range sheets {
+		key := prefix + thumbnails.SpriteName(i)
+		if err := j.put(key, sheet, "image/jpeg"); err != nil {
+			return nil, err
+		}
+		result.Sprites = append(result.Sprites, key)
+		written[key] = true
+	}
+
+	if err := j.put(result.Track, thumbnails.WebVTT(layout, duration), "text/vtt"); err != nil {
+		return nil, err
+	}
+
+	if mediaSource.Thumbnails != nil {
+		for _, key := range mediaSource.Thumbnails.Sprites {
+			if !written[key] {
+				if err := storage.Client.Delete(j.bucket, key); err != nil {
+					log.Println(err)
+				}
+			}
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,199 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/castyapp/grpc.server/config"
+	"github.com/castyapp/grpc.server/core"
+	"github.com/castyapp/grpc.server/helpers"
+	"github.com/castyapp/grpc.server/models"
+	"github.com/castyapp/grpc.server/probe"
+	"github.com/castyapp/grpc.server/storage"
+	"github.com/castyapp/grpc.server/subtitles"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const defaultTrackExtractionInterval = 30 * time.Second
+
+// TrackExtraction lists the audio tracks of uploaded media files on their
+// media sources and extracts their embedded text subtitles as WebVTT subtitles.
+type TrackExtraction struct {
+	mediaJobRunner
+	bucket    string
+	prober    *probe.Prober
+	extractor *probe.Extractor
+}
+
+func (j *TrackExtraction) Register(ctx *core.Context) error {
+	cm := ctx.MustGet("config.map").(*config.Map)
+	if !cm.Jobs.TrackExtraction.Enabled {
+		return nil
+	}
+	j.mediaJobRunner = mediaJobRunner{
+		kind:        models.MediaJobExtractTracks,
+		interval:    cm.Jobs.TrackExtraction.GetInterval(defaultTrackExtractionInterval),
+		timeout:     cm.Jobs.TrackExtraction.GetTimeout(),
+		maxAttempts: cm.Jobs.TrackExtraction.GetMaxAttempts(),
+		handle:      j.extract,
+	}
+	j.bucket = cm.Uploads.GetBucket()
+	j.prober = &probe.Prober{Path: cm.Probe.FFprobePath, Timeout: cm.Probe.GetTimeout()}
+	j.extractor = &probe.Extractor{Path: cm.Probe.FFmpegPath, Timeout: j.timeout, MaxBytes: subtitles.MaxSize}
+	j.start(ctx)
+	return nil
+}
+
+func (j *TrackExtraction) Close(ctx *core.Context) error {
+	j.close()
+	return nil
+}
+
+func (j *TrackExtraction) extract(ctx context.Context, db *mongo.Database, job *models.MediaJob) ([]string, error) {
+
+	mediaSource, err := findJobMediaSource(ctx, db, job)
+	if err != nil {
+		return nil, err
+	}
+
+	uri, trusted, err := mediaSourceURI(ctx, mediaSource, j.bucket, j.timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	prober, extractor := mediaReaders(j.prober, j.extractor, trusted)
+
+	result, err := prober.Probe(ctx, uri)
+	switch err {
+	case nil:
+	case probe.ErrNotInstalled, probe.ErrNoStreams:
+		return nil, &permanentError{err.Error()}
+	default:
+		return nil, err
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"probe":        result,
+			"audio_tracks": result.AudioTracks,
+			"updated_at":   time.Now(),
+		},
+	}
+	if _, err := db.Collection("media_sources").UpdateOne(ctx, bson.M{"_id": mediaSource.ID}, update); err != nil {
+		return nil, err
+	}
+
+	setMediaJobProgress(ctx, db, job, 10, "extracting subtitles")
+
+	// subtitles that were extracted by an earlier attempt are kept
+	extracted, err := db.Collection("subtitles").Distinct(ctx, "track_index", bson.M{
+		"media_source_id": mediaSource.ID,
+		"track_index":     bson.M{"$exists": true},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	hasDefault, err := db.Collection("subtitles").CountDocuments(ctx, bson.M{"media_source_id": mediaSource.ID, "default": true})
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		added    = 0
+		warnings = make([]string, 0)
+		skip     = make(map[int]bool, len(extracted))
+	)
+
+	for _, index := range extracted {
+		switch n := index.(type) {
+		case int32:
+			skip[int(n)] = true
+		case int64:
+			skip[int(n)] = true
+		}
+	}
+
+	for i, track := range result.SubtitleTracks {
+		switch {
+		case skip[track.Index]:
+		case !probe.IsTextSubtitle(track):
+			warnings = append(warnings, fmt.Sprintf("Subtitle track %d: %s subtitles can not be converted to WebVTT", track.Index, track.Codec))
+		default:
+			isDefault := track.Default && hasDefault == 0 && added == 0
+			if err := j.extractTrack(ctx, db, extractor, mediaSource, uri, track, isDefault); err != nil {
+				warnings = append(warnings, fmt.Sprintf("Subtitle track %d: %v", track.Index, err))
+			} else {
+				added++
+			}
+		}
+		setMediaJobProgress(ctx, db, job, 10+90*(i+1)/len(result.SubtitleTracks), "extracting subtitles")
+	}
+
+	if added > 0 {
+		helpers.SendMediaSourceChangedEvents(j.app, db, mediaSource)
+	}
+
+	return warnings, nil
+}
+
+func (j *TrackExtraction) extractTrack(ctx context.Context, db *mongo.Database, extractor *probe.Extractor, mediaSource *models.MediaSource, uri string, track *models.MediaTrack, isDefault bool) error {
+
+	data, err := extractor.ExtractSubtitle(ctx, uri, track.Index)
+	if err != nil {
+		return err
+	}
+
+	lang := track.Language
+	if lang == "" {
+		lang = "und"
+	}
+
+	result, err := subtitles.Process(data, "track.vtt", lang)
+	if err != nil {
+		return err
+	}
+
+	var (
+		now        = time.Now()
+		trackIndex = track.Index
+		subtitleID = primitive.NewObjectID()
+		objectKey  = subtitles.ObjectKey(mediaSource.ID, &subtitleID, 1)
+		vtt        = subtitles.WebVTT(result.Cues)
+	)
+
+	if err := storage.Client.Put(storage.Buckets.Subtitles, objectKey, bytes.NewReader(vtt), int64(len(vtt)), "text/vtt"); err != nil {
+		return err
+	}
+
+	_, err = db.Collection("subtitles").InsertOne(ctx, bson.M{
+		"_id":             subtitleID,
+		"user_id":         mediaSource.UserID,
+		"media_source_id": mediaSource.ID,
+		"file":            storage.ObjectURI(storage.Buckets.Subtitles, objectKey),
+		"lang":            lang,
+		"label":           track.Title,
+		"forced":          track.Forced,
+		"sdh":             track.HearingImpaired,
+		"default":         isDefault,
+		"track_index":     trackIndex,
+		"object_key":      objectKey,
+		"size":            int64(len(vtt)),
+		"version":         1,
+		"created_at":      now,
+		"updated_at":      now,
+	})
+	if err != nil {
+		if err := storage.Client.Delete(storage.Buckets.Subtitles, objectKey); err != nil {
+			log.Println(err)
+		}
+		return err
+	}
+
+	return nil
+}
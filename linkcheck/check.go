@@ -0,0 +1,173 @@
+package linkcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/castyapp/grpc.server/config"
+	"github.com/castyapp/grpc.server/fetcher"
+	"github.com/castyapp/grpc.server/manifest"
+	"github.com/castyapp/grpc.server/models"
+	"github.com/castyapp/libcasty-protocol-go/proto"
+)
+
+var (
+	// streamContentTypes are the types that servers send for HLS and DASH manifests,
+	// plain text and binary are common misconfigurations that players still accept
+	streamContentTypes = map[string]bool{
+		"application/vnd.apple.mpegurl": true,
+		"application/x-mpegurl":         true,
+		"audio/mpegurl":                 true,
+		"audio/x-mpegurl":               true,
+		"application/dash+xml":          true,
+		"text/plain":                    true,
+		"application/octet-stream":      true,
+		"binary/octet-stream":           true,
+	}
+	mediaContentTypes = map[string]bool{
+		"application/octet-stream": true,
+		"binary/octet-stream":      true,
+		"application/mp4":          true,
+		"application/ogg":          true,
+		"application/x-matroska":   true,
+	}
+)
+
+// Checkable reports whether the reachability of the media source type is checked,
+// the other types are played by their own players.
+func Checkable(mediaType proto.MediaSource_Type) bool {
+	return mediaType == proto.MediaSource_DOWNLOAD_URI || mediaType == proto.MediaSource_M3U8
+}
+
+func isStream(uri string, mediaType proto.MediaSource_Type) bool {
+	return mediaType == proto.MediaSource_M3U8 || manifest.Detect(uri) != ""
+}
+
+// Checker requests download and stream uris to find broken links before they are accepted.
+type Checker struct {
+	fetcher       *fetcher.Fetcher
+	origin        string
+	requireRanges bool
+}
+
+func NewChecker(c config.MediaURIsMap) *Checker {
+	return &Checker{
+		fetcher:       fetcher.New(fetcher.Options{Timeout: c.GetTimeout()}),
+		origin:        c.CORSOrigin,
+		requireRanges: c.RequireRanges,
+	}
+}
+
+// Check requests the first byte of the uri, the link is returned even when it has violations.
+func (c *Checker) Check(ctx context.Context, uri string, mediaType proto.MediaSource_Type) (*models.MediaLink, []Violation) {
+
+	header := make(http.Header)
+	if c.origin != "" {
+		header.Set("Origin", c.origin)
+	}
+
+	head, err := c.fetcher.Head(ctx, uri, header)
+	if err != nil {
+		return nil, uriViolation(fetchErrorDescription(head, err))
+	}
+
+	return c.Report(uri, mediaType, head)
+}
+
+func fetchErrorDescription(head *fetcher.HeadResponse, err error) string {
+	switch {
+	case errors.Is(err, fetcher.ErrBadStatus):
+		switch head.StatusCode {
+		case http.StatusNotFound, http.StatusGone:
+			return "Uri was not found on its server!"
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return "Uri is not public, its server denied the access!"
+		}
+		return fmt.Sprintf("Uri is not reachable, its server answered with %d!", head.StatusCode)
+	case err == fetcher.ErrInvalidURL:
+		return "Uri must be a http or https url!"
+	case err == fetcher.ErrBlockedAddress:
+		return "Uri host is not allowed!"
+	case err == fetcher.ErrTooManyRedirects:
+		return "Uri redirects too many times!"
+	case err == fetcher.ErrRequestTimedOut:
+		return "Uri did not respond in time!"
+	}
+	return "Uri is not reachable!"
+}
+
+// Report checks the response of the server of the uri.
+func (c *Checker) Report(uri string, mediaType proto.MediaSource_Type, head *fetcher.HeadResponse) (*models.MediaLink, []Violation) {
+
+	var (
+		stream     = isStream(uri, mediaType)
+		violations = make([]Violation, 0)
+		link       = &models.MediaLink{
+			ContentType:  head.ContentType,
+			AcceptRanges: head.Ranges,
+			CORS:         c.cors(head.Header),
+			CheckedAt:    time.Now(),
+		}
+	)
+
+	if head.Size > 0 {
+		link.Size = head.Size
+	}
+
+	// servers that don't send a content type are given the benefit of the doubt
+	switch contentType := head.ContentType; {
+	case contentType == "":
+	case contentType == "text/html" || contentType == "application/xhtml+xml":
+		violations = append(violations, Violation{Field: "uri", Description: "Uri is a web page, not a media file!"})
+	case stream && !streamContentTypes[contentType]:
+		violations = append(violations, Violation{
+			Field:       "uri",
+			Description: fmt.Sprintf("Uri is not a stream, its content type is %s!", contentType),
+		})
+	case !stream && !mediaContentTypes[contentType] &&
+		!strings.HasPrefix(contentType, "video/") && !strings.HasPrefix(contentType, "audio/"):
+		violations = append(violations, Violation{
+			Field:       "uri",
+			Description: fmt.Sprintf("Uri is not a media file, its content type is %s!", contentType),
+		})
+	}
+
+	if !stream && c.requireRanges && !head.Ranges {
+		violations = append(violations, Violation{
+			Field:       "uri",
+			Description: "Uri server does not support byte ranges, the media could not be seeked!",
+		})
+	}
+
+	// the web player fetches the manifests and segments of streams, which browsers
+	// only allow when the server sends cors headers for our origin
+	if stream && c.origin != "" && !link.CORS.Allowed {
+		violations = append(violations, Violation{
+			Field:       "uri",
+			Description: "Uri server does not allow the web player to read the stream, it has to send CORS headers!",
+		})
+	}
+
+	return link, violations
+}
+
+func (c *Checker) cors(header http.Header) *models.MediaLinkCORS {
+	cors := &models.MediaLinkCORS{
+		AllowOrigin:      header.Get("Access-Control-Allow-Origin"),
+		AllowCredentials: strings.EqualFold(header.Get("Access-Control-Allow-Credentials"), "true"),
+		ExposeHeaders:    make([]string, 0),
+	}
+	for _, value := range header.Values("Access-Control-Expose-Headers") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				cors.ExposeHeaders = append(cors.ExposeHeaders, name)
+			}
+		}
+	}
+	cors.Allowed = cors.AllowOrigin == "*" || (c.origin != "" && cors.AllowOrigin == c.origin)
+	return cors
+}
@@ -0,0 +1,143 @@
+package linkcheck
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/castyapp/grpc.server/config"
+	"github.com/castyapp/grpc.server/fetcher"
+	"github.com/castyapp/libcasty-protocol-go/proto"
+)
+
+// Violation is a problem with one field of a media source, the description is shown to the user.
+type Violation struct {
+	Field       string
+	Description string
+}
+
+var (
+	youtubeHosts    = []string{"youtube.com", "youtu.be", "youtube-nocookie.com"}
+	soundCloudHosts = []string{"soundcloud.com", "snd.sc"}
+	spotifyHosts    = []string{"open.spotify.com"}
+)
+
+// Rules are the hosts that download and stream uris can point to.
+type Rules struct {
+	AllowedHosts []string
+	DeniedHosts  []string
+}
+
+func NewRules(c config.MediaURIsMap) Rules {
+	return Rules{AllowedHosts: c.AllowedHosts, DeniedHosts: c.DeniedHosts}
+}
+
+// matchHost reports whether the host is one of the domains or a subdomain of them.
+func matchHost(host string, domains []string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, domain := range domains {
+		domain = strings.TrimPrefix(strings.ToLower(domain), ".")
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+func uriViolation(description string) []Violation {
+	return []Violation{{Field: "uri", Description: description}}
+}
+
+// parseWebURL parses an absolute http or https url, urls with credentials are not accepted
+// since they would be shared with every member of the theater.
+func parseWebURL(uri string) (*url.URL, []Violation) {
+	u, err := url.Parse(strings.TrimSpace(uri))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return nil, uriViolation("Uri must be a http or https url!")
+	}
+	if u.User != nil {
+		return nil, uriViolation("Uri can not have a username or password!")
+	}
+	return u, nil
+}
+
+// Validate checks the uri of a media source for its type without connecting to it.
+func (r Rules) Validate(uri string, mediaType proto.MediaSource_Type) []Violation {
+
+	violations := make([]Violation, 0)
+
+	if strings.TrimSpace(uri) == "" {
+		violations = append(violations, Violation{Field: "uri", Description: "Uri is required!"})
+	}
+
+	if mediaType == proto.MediaSource_UNKNOWN {
+		violations = append(violations, Violation{Field: "type", Description: "Media source type can not be unknown!"})
+	}
+
+	if len(violations) > 0 {
+		return violations
+	}
+
+	switch mediaType {
+	case proto.MediaSource_YOUTUBE:
+		return validateHost(uri, youtubeHosts, "Uri must be a YouTube link!")
+	case proto.MediaSource_SOUND_CLOUD:
+		return validateHost(uri, soundCloudHosts, "Uri must be a SoundCloud link!")
+	case proto.MediaSource_SPOTIFY:
+		// the spotify app links like spotify:track:4uLU6hMCjMI75M1A2tKUQC are played by the client
+		if strings.HasPrefix(uri, "spotify:") {
+			return nil
+		}
+		return validateHost(uri, spotifyHosts, "Uri must be a Spotify link!")
+	case proto.MediaSource_TORRENT:
+		if strings.HasPrefix(strings.ToLower(uri), "magnet:") {
+			u, err := url.Parse(uri)
+			if err != nil || !strings.HasPrefix(strings.ToLower(u.Query().Get("xt")), "urn:btih:") {
+				return uriViolation("Uri is not a valid magnet link!")
+			}
+			return nil
+		}
+		return r.validateRemote(uri)
+	case proto.MediaSource_DOWNLOAD_URI, proto.MediaSource_M3U8:
+		return r.validateRemote(uri)
+	}
+
+	// local paths are played from the disk of the client
+	return nil
+}
+
+func validateHost(uri string, hosts []string, description string) []Violation {
+	u, violations := parseWebURL(uri)
+	if violations != nil {
+		return violations
+	}
+	if !matchHost(u.Hostname(), hosts) {
+		return uriViolation(description)
+	}
+	return nil
+}
+
+// validateRemote checks the uris that the members of a theater download from any host.
+// Hosts are resolved by the reachability check, only ip literals are checked here.
+func (r Rules) validateRemote(uri string) []Violation {
+
+	u, violations := parseWebURL(uri)
+	if violations != nil {
+		return violations
+	}
+
+	host := u.Hostname()
+	if ip := net.ParseIP(host); ip != nil && fetcher.IsBlockedIP(ip) {
+		return uriViolation("Uri host is not allowed!")
+	}
+
+	if matchHost(host, r.DeniedHosts) {
+		return uriViolation("Uri host is not allowed!")
+	}
+
+	if len(r.AllowedHosts) > 0 && !matchHost(host, r.AllowedHosts) {
+		return uriViolation("Uri host is not allowed!")
+	}
+
+	return nil
+}
@@ -0,0 +1,237 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/xml"
+	"math"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/castyapp/grpc.server/models"
+)
+
+type dashRepresentation struct {
+	ID        string `xml:"id,attr"`
+	Bandwidth int64  `xml:"bandwidth,attr"`
+	Width     int    `xml:"width,attr"`
+	Height    int    `xml:"height,attr"`
+	Codecs    string `xml:"codecs,attr"`
+	MimeType  string `xml:"mimeType,attr"`
+	FrameRate string `xml:"frameRate,attr"`
+	BaseURL   string `xml:"BaseURL"`
+}
+
+type dashRole struct {
+	SchemeIDURI string `xml:"schemeIdUri,attr"`
+	Value       string `xml:"value,attr"`
+}
+
+type dashAdaptationSet struct {
+	ID              string                `xml:"id,attr"`
+	ContentType     string                `xml:"contentType,attr"`
+	MimeType        string                `xml:"mimeType,attr"`
+	Codecs          string                `xml:"codecs,attr"`
+	Lang            string                `xml:"lang,attr"`
+	Label           string                `xml:"Label"`
+	Width           int                   `xml:"width,attr"`
+	Height          int                   `xml:"height,attr"`
+	FrameRate       string                `xml:"frameRate,attr"`
+	Roles           []*dashRole           `xml:"Role"`
+	Representations []*dashRepresentation `xml:"Representation"`
+}
+
+type dashPeriod struct {
+	Duration       string               `xml:"duration,attr"`
+	AdaptationSets []*dashAdaptationSet `xml:"AdaptationSet"`
+}
+
+type dashMPD struct {
+	XMLName                   xml.Name      `xml:"MPD"`
+	Type                      string        `xml:"type,attr"`
+	MediaPresentationDuration string        `xml:"mediaPresentationDuration,attr"`
+	BaseURL                   string        `xml:"BaseURL"`
+	Periods                   []*dashPeriod `xml:"Period"`
+}
+
+var isoDurationRegex = regexp.MustCompile(`^P(?:(\d+(?:\.\d+)?)D)?(?:T(?:(\d+(?:\.\d+)?)H)?(?:(\d+(?:\.\d+)?)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// parseISODuration parses the xs:duration values of DASH manifests to seconds,
+// durations in years or months are not used by manifests and are rejected.
+func parseISODuration(value string) (float64, error) {
+	matches := isoDurationRegex.FindStringSubmatch(strings.TrimSpace(value))
+	if matches == nil || value == "P" || strings.HasSuffix(value, "T") {
+		return 0, ErrInvalid
+	}
+	var (
+		seconds = 0.0
+		units   = []float64{86400, 3600, 60, 1}
+	)
+	for i, unit := range units {
+		if matches[i+1] == "" {
+			continue
+		}
+		n, err := strconv.ParseFloat(matches[i+1], 64)
+		if err != nil {
+			return 0, ErrInvalid
+		}
+		seconds += n * unit
+	}
+	return seconds, nil
+}
+
+// parseFrameRate parses frame rates like 25 and 30000/1001.
+func parseFrameRate(value string) float64 {
+	parts := strings.SplitN(value, "/", 2)
+	rate, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return 0
+	}
+	if len(parts) == 2 {
+		divisor, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil || divisor == 0 {
+			return 0
+		}
+		rate /= divisor
+	}
+	return math.Round(rate*1000) / 1000
+}
+
+// contentType returns video, audio or text for the adaptation set.
+func (a *dashAdaptationSet) contentType() string {
+	if a.ContentType != "" {
+		return a.ContentType
+	}
+	mimeType := a.MimeType
+	if mimeType == "" && len(a.Representations) > 0 {
+		mimeType = a.Representations[0].MimeType
+	}
+	switch {
+	case strings.HasPrefix(mimeType, "video/"):
+		return "video"
+	case strings.HasPrefix(mimeType, "audio/"):
+		return "audio"
+	case strings.HasPrefix(mimeType, "text/"), mimeType == "application/ttml+xml":
+		return "text"
+	case strings.HasPrefix(a.Codecs, "stpp"), strings.HasPrefix(a.Codecs, "wvtt"):
+		return "text"
+	}
+	return ""
+}
+
+func (a *dashAdaptationSet) hasRole(value string) bool {
+	for _, role := range a.Roles {
+		if role.Value == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *dashAdaptationSet) rendition(base *url.URL) *models.MediaRendition {
+	rendition := &models.MediaRendition{
+		GroupID:  a.ID,
+		Name:     a.Label,
+		Language: a.Lang,
+		Codecs:   a.Codecs,
+		Default:  a.hasRole("main"),
+		Forced:   a.hasRole("forced-subtitle"),
+	}
+	if len(a.Representations) > 0 {
+		representation := a.Representations[0]
+		if rendition.Codecs == "" {
+			rendition.Codecs = representation.Codecs
+		}
+		rendition.URI = resolve(base, representation.BaseURL)
+	}
+	if rendition.Name == "" {
+		rendition.Name = rendition.Language
+	}
+	return rendition
+}
+
+// parseDASH parses a DASH manifest, the renditions are listed from its first period.
+func parseDASH(data []byte, base *url.URL) (*models.MediaManifest, error) {
+
+	mpd := new(dashMPD)
+	if err := xml.NewDecoder(bytes.NewReader(data)).Decode(mpd); err != nil {
+		return nil, ErrInvalid
+	}
+
+	if len(mpd.Periods) == 0 {
+		return nil, ErrEmpty
+	}
+
+	if mpd.BaseURL != "" {
+		if u, err := url.Parse(resolve(base, mpd.BaseURL)); err == nil {
+			base = u
+		}
+	}
+
+	result := &models.MediaManifest{
+		Format:             FormatDASH,
+		Live:               mpd.Type == "dynamic",
+		Variants:           make([]*models.MediaVariant, 0),
+		AudioRenditions:    make([]*models.MediaRendition, 0),
+		SubtitleRenditions: make([]*models.MediaRendition, 0),
+	}
+
+	for _, adaptationSet := range mpd.Periods[0].AdaptationSets {
+		switch adaptationSet.contentType() {
+		case "video":
+			for _, representation := range adaptationSet.Representations {
+				variant := &models.MediaVariant{
+					Bandwidth: representation.Bandwidth,
+					Width:     representation.Width,
+					Height:    representation.Height,
+					Codecs:    representation.Codecs,
+					FrameRate: parseFrameRate(representation.FrameRate),
+					URI:       resolve(base, representation.BaseURL),
+				}
+				if variant.Width == 0 && variant.Height == 0 {
+					variant.Width, variant.Height = adaptationSet.Width, adaptationSet.Height
+				}
+				if variant.Codecs == "" {
+					variant.Codecs = adaptationSet.Codecs
+				}
+				if variant.FrameRate == 0 {
+					variant.FrameRate = parseFrameRate(adaptationSet.FrameRate)
+				}
+				result.Variants = append(result.Variants, variant)
+			}
+		case "audio":
+			result.AudioRenditions = append(result.AudioRenditions, adaptationSet.rendition(base))
+		case "text":
+			result.SubtitleRenditions = append(result.SubtitleRenditions, adaptationSet.rendition(base))
+		}
+	}
+
+	if len(result.Variants) == 0 && len(result.AudioRenditions) == 0 {
+		return nil, ErrEmpty
+	}
+
+	if result.Live {
+		return result, nil
+	}
+
+	if mpd.MediaPresentationDuration != "" {
+		duration, err := parseISODuration(mpd.MediaPresentationDuration)
+		if err != nil {
+			return nil, err
+		}
+		result.Duration = duration
+		return result, nil
+	}
+
+	// without a presentation duration every period has its own duration
+	for _, period := range mpd.Periods {
+		duration, err := parseISODuration(period.Duration)
+		if err != nil {
+			return nil, err
+		}
+		result.Duration += duration
+	}
+
+	return result, nil
+}
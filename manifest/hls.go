@@ -0,0 +1,160 @@
+package manifest
+
+import (
+	"bufio"
+	"bytes"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/castyapp/grpc.server/models"
+)
+
+// parseAttributes parses an HLS attribute list, quoted values may contain commas.
+func parseAttributes(list string) map[string]string {
+	attributes := make(map[string]string)
+	for len(list) > 0 {
+		eq := strings.IndexByte(list, '=')
+		if eq < 0 {
+			break
+		}
+		var (
+			key   = strings.TrimSpace(list[:eq])
+			value string
+		)
+		list = list[eq+1:]
+		if strings.HasPrefix(list, `"`) {
+			end := strings.IndexByte(list[1:], '"')
+			if end < 0 {
+				value, list = list[1:], ""
+			} else {
+				value, list = list[1:end+1], list[end+2:]
+			}
+			if comma := strings.IndexByte(list, ','); comma >= 0 {
+				list = list[comma+1:]
+			} else {
+				list = ""
+			}
+		} else if comma := strings.IndexByte(list, ','); comma >= 0 {
+			value, list = list[:comma], list[comma+1:]
+		} else {
+			value, list = list, ""
+		}
+		attributes[key] = strings.TrimSpace(value)
+	}
+	return attributes
+}
+
+func parseResolution(resolution string) (int, int) {
+	parts := strings.SplitN(strings.ToLower(resolution), "x", 2)
+	if len(parts) != 2 {
+		return 0, 0
+	}
+	width, _ := strconv.Atoi(parts[0])
+	height, _ := strconv.Atoi(parts[1])
+	return width, height
+}
+
+func newRendition(attributes map[string]string, base *url.URL) *models.MediaRendition {
+	return &models.MediaRendition{
+		GroupID:  attributes["GROUP-ID"],
+		Name:     attributes["NAME"],
+		Language: attributes["LANGUAGE"],
+		Default:  attributes["DEFAULT"] == "YES",
+		Forced:   attributes["FORCED"] == "YES",
+		URI:      resolve(base, attributes["URI"]),
+	}
+}
+
+// parseHLS parses a master or a media playlist, a media playlist has no variants.
+func parseHLS(data []byte, base *url.URL) (*models.MediaManifest, error) {
+
+	var (
+		result = &models.MediaManifest{
+			Format:             FormatHLS,
+			Variants:           make([]*models.MediaVariant, 0),
+			AudioRenditions:    make([]*models.MediaRendition, 0),
+			SubtitleRenditions: make([]*models.MediaRendition, 0),
+		}
+		scanner   = bufio.NewScanner(bytes.NewReader(data))
+		variant   *models.MediaVariant
+		segments  = 0
+		duration  = 0.0
+		ended     = false
+		inSegment = false
+	)
+
+	scanner.Buffer(make([]byte, 64*1024), MaxSize)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#EXT-X-STREAM-INF:"):
+			attributes := parseAttributes(strings.TrimPrefix(line, "#EXT-X-STREAM-INF:"))
+			bandwidth, _ := strconv.ParseInt(attributes["BANDWIDTH"], 10, 64)
+			frameRate, _ := strconv.ParseFloat(attributes["FRAME-RATE"], 64)
+			width, height := parseResolution(attributes["RESOLUTION"])
+			variant = &models.MediaVariant{
+				Bandwidth:     bandwidth,
+				Width:         width,
+				Height:        height,
+				Codecs:        attributes["CODECS"],
+				FrameRate:     frameRate,
+				AudioGroup:    attributes["AUDIO"],
+				SubtitleGroup: attributes["SUBTITLES"],
+			}
+		case strings.HasPrefix(line, "#EXT-X-MEDIA:"):
+			attributes := parseAttributes(strings.TrimPrefix(line, "#EXT-X-MEDIA:"))
+			switch attributes["TYPE"] {
+			case "AUDIO":
+				result.AudioRenditions = append(result.AudioRenditions, newRendition(attributes, base))
+			case "SUBTITLES":
+				result.SubtitleRenditions = append(result.SubtitleRenditions, newRendition(attributes, base))
+			}
+		case strings.HasPrefix(line, "#EXTINF:"):
+			value := strings.TrimPrefix(line, "#EXTINF:")
+			if comma := strings.IndexByte(value, ','); comma >= 0 {
+				value = value[:comma]
+			}
+			seconds, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || seconds < 0 {
+				return nil, ErrInvalid
+			}
+			duration += seconds
+			inSegment = true
+		case line == "#EXT-X-ENDLIST":
+			ended = true
+		case line == "#EXT-X-PLAYLIST-TYPE:VOD":
+			ended = true
+		case strings.HasPrefix(line, "#"):
+		case variant != nil:
+			variant.URI = resolve(base, line)
+			result.Variants = append(result.Variants, variant)
+			variant = nil
+		case inSegment:
+			segments++
+			inSegment = false
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, ErrInvalid
+	}
+
+	if len(result.Variants) > 0 {
+		return result, nil
+	}
+
+	if segments == 0 {
+		return nil, ErrEmpty
+	}
+
+	result.Live = !ended
+	if !result.Live {
+		result.Duration = math.Round(duration*1000) / 1000
+	}
+
+	return result, nil
+}
@@ -0,0 +1,132 @@
+package manifest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/castyapp/grpc.server/fetcher"
+	"github.com/castyapp/grpc.server/models"
+)
+
+const (
+	FormatHLS  = "hls"
+	FormatDASH = "dash"
+)
+
+// MaxSize is the largest manifest or playlist that is fetched.
+const MaxSize = 2 << 20
+
+var (
+	ErrNotManifest = errors.New("manifest: not an hls or dash manifest")
+	ErrInvalid     = errors.New("manifest: manifest is invalid")
+	ErrEmpty       = errors.New("manifest: manifest has no renditions")
+)
+
+// Detect returns the manifest format of the uri by its extension, it's empty
+// when the uri is not a manifest.
+func Detect(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return ""
+	}
+	switch strings.ToLower(path.Ext(u.Path)) {
+	case ".m3u8", ".m3u":
+		return FormatHLS
+	case ".mpd":
+		return FormatDASH
+	}
+	return ""
+}
+
+// Parse parses an HLS playlist or a DASH manifest, the uris of the renditions
+// are resolved against base.
+// A parsed HLS master playlist has no duration, the duration is in the media playlists of its variants.
+func Parse(data []byte, base *url.URL) (*models.MediaManifest, error) {
+	data = bytes.TrimPrefix(data, []byte{0xEF, 0xBB, 0xBF})
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("#EXTM3U")):
+		return parseHLS(data, base)
+	case bytes.HasPrefix(trimmed, []byte("<")) && bytes.Contains(trimmed, []byte("<MPD")):
+		return parseDASH(data, base)
+	}
+	return nil, ErrNotManifest
+}
+
+// Inspector fetches and parses the manifests of stream media sources.
+type Inspector struct {
+	fetcher *fetcher.Fetcher
+}
+
+func NewInspector(timeout time.Duration) *Inspector {
+	return &Inspector{
+		fetcher: fetcher.New(fetcher.Options{Timeout: timeout, MaxBytes: MaxSize}),
+	}
+}
+
+// Inspect fetches the manifest of the uri, for an HLS master playlist the media
+// playlist of its first variant is fetched as well to find out the duration.
+func (i *Inspector) Inspect(ctx context.Context, uri string) (*models.MediaManifest, error) {
+
+	base, data, err := i.fetch(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := Parse(data, base)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Format == FormatHLS && len(result.Variants) > 0 {
+		base, data, err := i.fetch(ctx, result.Variants[0].URI)
+		if err != nil {
+			return nil, err
+		}
+		playlist, err := parseHLS(data, base)
+		if err != nil {
+			return nil, err
+		}
+		if len(playlist.Variants) > 0 {
+			// a master playlist that points at another master playlist
+			return nil, ErrInvalid
+		}
+		result.Live = playlist.Live
+		result.Duration = playlist.Duration
+	}
+
+	result.InspectedAt = time.Now()
+
+	return result, nil
+}
+
+func (i *Inspector) fetch(ctx context.Context, uri string) (*url.URL, []byte, error) {
+	base, err := url.Parse(uri)
+	if err != nil {
+		return nil, nil, fetcher.ErrInvalidURL
+	}
+	resp, err := i.fetcher.Fetch(ctx, uri)
+	if err != nil {
+		return nil, nil, err
+	}
+	return base, resp.Data, nil
+}
+
+func resolve(base *url.URL, ref string) string {
+	if ref == "" {
+		return ""
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	if base == nil {
+		return u.String()
+	}
+	return base.ResolveReference(u).String()
+}
@@ -0,0 +1,99 @@
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/castyapp/grpc.server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type cacheEntry struct {
+	Key       string                  `bson:"_id"`
+	Results   []*models.MediaMetadata `bson:"results"`
+	ExpiresAt time.Time               `bson:"expires_at"`
+}
+
+// Cache keeps the results of a provider in the metadata_cache collection, so
+// repeated lookups of the same title or id don't hit its api.
+type Cache struct {
+	provider   Provider
+	collection *mongo.Collection
+	ttl        time.Duration
+}
+
+func NewCache(provider Provider, db *mongo.Database, ttl time.Duration) *Cache {
+	return &Cache{provider: provider, collection: db.Collection("metadata_cache"), ttl: ttl}
+}
+
+// CreateIndexes creates the ttl index that removes the expired entries.
+func (c *Cache) CreateIndexes(ctx context.Context) error {
+	_, err := c.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+func (c *Cache) Name() string {
+	return c.provider.Name()
+}
+
+// load returns the cached results of the key, expired entries are ignored since
+// mongodb removes them only once a minute.
+func (c *Cache) load(ctx context.Context, key string) ([]*models.MediaMetadata, bool) {
+	entry := new(cacheEntry)
+	filter := bson.M{"_id": key, "expires_at": bson.M{"$gt": time.Now()}}
+	if err := c.collection.FindOne(ctx, filter).Decode(entry); err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Println(err)
+		}
+		return nil, false
+	}
+	return entry.Results, true
+}
+
+func (c *Cache) store(ctx context.Context, key string, results []*models.MediaMetadata) {
+	entry := &cacheEntry{Key: key, Results: results, ExpiresAt: time.Now().Add(c.ttl)}
+	opts := options.Replace().SetUpsert(true)
+	if _, err := c.collection.ReplaceOne(ctx, bson.M{"_id": key}, entry, opts); err != nil {
+		log.Println(err)
+	}
+}
+
+func (c *Cache) Search(ctx context.Context, q Query) ([]*models.MediaMetadata, error) {
+
+	key := fmt.Sprintf("%s:search:%s:%d:%d:%d", c.Name(), strings.ToLower(strings.TrimSpace(q.Title)), q.Year, q.Season, q.Episode)
+	if results, ok := c.load(ctx, key); ok {
+		return results, nil
+	}
+
+	results, err := c.provider.Search(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	c.store(ctx, key, results)
+	return results, nil
+}
+
+func (c *Cache) Get(ctx context.Context, id string) (*models.MediaMetadata, error) {
+
+	key := fmt.Sprintf("%s:get:%s", c.Name(), id)
+	if results, ok := c.load(ctx, key); ok && len(results) == 1 {
+		return results[0], nil
+	}
+
+	result, err := c.provider.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	c.store(ctx, key, []*models.MediaMetadata{result})
+	return result, nil
+}
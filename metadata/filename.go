@@ -0,0 +1,77 @@
+package metadata
+
+import (
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// bracketsRegex matches the release group and site tags like [YTS] and {Group}
+	bracketsRegex = regexp.MustCompile(`\[[^\]]*\]|\{[^}]*\}`)
+	// episodeRegex matches S01E02, s1e2, S01.E02 and 1x02
+	episodeRegex = regexp.MustCompile(`(?i)\bs(\d{1,2})[ .]?e(\d{1,3})\b|\b(\d{1,2})x(\d{2,3})\b`)
+	yearRegex    = regexp.MustCompile(`\(?\b(19\d{2}|20\d{2})\b\)?`)
+	// tagsRegex matches the quality, source and codec tags that come after the title
+	tagsRegex  = regexp.MustCompile(`(?i)\b(2160p|1080p|720p|576p|480p|4k|uhd|hdr|bluray|blu-ray|brrip|bdrip|webrip|web-dl|webdl|web|hdtv|dvdrip|hdrip|remux|x264|x265|h264|h265|hevc|xvid|aac|ac3|dts|proper|repack|extended|unrated|remastered)\b`)
+	spaceRegex = regexp.MustCompile(`\s+`)
+)
+
+// mediaExtensions are the extensions that are removed from file names before they are parsed.
+var mediaExtensions = map[string]bool{
+	".mp4": true, ".mkv": true, ".avi": true, ".mov": true, ".webm": true, ".m4v": true,
+	".wmv": true, ".flv": true, ".ts": true, ".m3u8": true, ".mpd": true, ".mp3": true,
+	".srt": true, ".vtt": true, ".ass": true, ".sub": true,
+}
+
+// ParseFilename guesses the title, year, season and episode of a media file
+// from its name, like "Show.S01E02.1080p.WEB-DL.mkv" or "Movie (2010) [1080p].mp4".
+func ParseFilename(name string) Query {
+
+	var q Query
+
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	if ext := path.Ext(name); mediaExtensions[strings.ToLower(ext)] {
+		name = strings.TrimSuffix(name, ext)
+	}
+
+	name = bracketsRegex.ReplaceAllString(name, " ")
+	// dots and underscores separate the words of release names
+	if !strings.Contains(name, " ") || strings.Count(name, ".")+strings.Count(name, "_") > 1 {
+		name = strings.NewReplacer(".", " ", "_", " ").Replace(name)
+	}
+
+	title := name
+	if loc := episodeRegex.FindStringSubmatchIndex(name); loc != nil {
+		matches := episodeRegex.FindStringSubmatch(name)
+		if matches[1] != "" {
+			q.Season, _ = strconv.Atoi(matches[1])
+			q.Episode, _ = strconv.Atoi(matches[2])
+		} else {
+			q.Season, _ = strconv.Atoi(matches[3])
+			q.Episode, _ = strconv.Atoi(matches[4])
+		}
+		title = name[:loc[0]]
+	}
+
+	// the last year is taken, so titles like "2001 A Space Odyssey 1968" keep their first number
+	years := yearRegex.FindAllStringSubmatchIndex(title, -1)
+	for i := len(years) - 1; i >= 0; i-- {
+		if years[i][0] == 0 {
+			continue
+		}
+		q.Year, _ = strconv.Atoi(title[years[i][2]:years[i][3]])
+		title = title[:years[i][0]]
+		break
+	}
+
+	if loc := tagsRegex.FindStringIndex(title); loc != nil && loc[0] > 0 {
+		title = title[:loc[0]]
+	}
+
+	title = strings.Trim(spaceRegex.ReplaceAllString(title, " "), " -([")
+	q.Title = title
+
+	return q
+}
@@ -0,0 +1,151 @@
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/castyapp/grpc.server/config"
+	"github.com/castyapp/grpc.server/models"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrNotFound     = errors.New("metadata: nothing was found")
+	ErrInvalidID    = errors.New("metadata: id is invalid")
+	ErrUnauthorized = errors.New("metadata: api key was rejected by the provider")
+	ErrUnavailable  = errors.New("metadata: provider is unavailable")
+)
+
+// maxResults bounds the search results of a provider
+const maxResults = 10
+
+// maxResponseSize bounds the responses that are read from a provider
+const maxResponseSize = 2 << 20
+
+// Query is a search for a movie or a tv show, it's an episode search when
+// season and episode are set.
+type Query struct {
+	Title   string
+	Year    int
+	Season  int
+	Episode int
+}
+
+func (q Query) IsEpisode() bool {
+	return q.Season > 0 && q.Episode > 0
+}
+
+// Provider is a movie and tv show database. The ids of the search results are
+// passed to Get to find the details of a result.
+type Provider interface {
+	Name() string
+	Search(ctx context.Context, q Query) ([]*models.MediaMetadata, error)
+	Get(ctx context.Context, id string) (*models.MediaMetadata, error)
+}
+
+// Client is the configured provider, it's nil when metadata lookups are disabled.
+var Client Provider
+
+func NewProvider(c config.MetadataMap) (Provider, error) {
+	client := &http.Client{Timeout: c.GetTimeout()}
+	switch c.Provider {
+	case "", "tmdb":
+		return NewTMDB(c, client), nil
+	case "omdb":
+		return NewOMDb(c, client), nil
+	}
+	return nil, fmt.Errorf("metadata provider [%s] is not supported", c.Provider)
+}
+
+// Configure sets up the client with the configured provider, the results of the
+// provider are cached in the database.
+func Configure(ctx context.Context, c *config.Map, db *mongo.Database) error {
+
+	if !c.Metadata.Enabled {
+		Client = nil
+		return nil
+	}
+
+	provider, err := NewProvider(c.Metadata)
+	if err != nil {
+		return err
+	}
+
+	cache := NewCache(provider, db, c.Metadata.GetCacheTTL())
+	if err := cache.CreateIndexes(ctx); err != nil {
+		return err
+	}
+
+	Client = cache
+	return nil
+}
+
+// DisplayTitle is the title that media sources are renamed to when the metadata is confirmed.
+func DisplayTitle(m *models.MediaMetadata) string {
+	switch {
+	case m.Kind == models.MediaMetadataEpisode && m.EpisodeTitle != "":
+		return fmt.Sprintf("%s S%02dE%02d - %s", m.Title, m.Season, m.Episode, m.EpisodeTitle)
+	case m.Kind == models.MediaMetadataEpisode:
+		return fmt.Sprintf("%s S%02dE%02d", m.Title, m.Season, m.Episode)
+	case m.Year > 0:
+		return fmt.Sprintf("%s (%d)", m.Title, m.Year)
+	}
+	return m.Title
+}
+
+// getJSON gets the url and decodes its json response into v.
+func getJSON(ctx context.Context, client *http.Client, u string, v interface{}) error {
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return ErrUnavailable
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return ErrUnauthorized
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case resp.StatusCode != http.StatusOK:
+		return ErrUnavailable
+	}
+
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(v); err != nil {
+		return ErrUnavailable
+	}
+
+	return nil
+}
+
+// endpoint joins the base url of a provider with the path and the query params.
+func endpoint(baseURL, path string, params url.Values) string {
+	return strings.TrimRight(baseURL, "/") + path + "?" + params.Encode()
+}
+
+// parseYear parses the year out of dates like 2010-07-16 and ranges like 2011–2019.
+func parseYear(value string) int {
+	if len(value) < 4 {
+		return 0
+	}
+	year := 0
+	for _, r := range value[:4] {
+		if r < '0' || r > '9' {
+			return 0
+		}
+		year = year*10 + int(r-'0')
+	}
+	return year
+}
@@ -0,0 +1,194 @@
+package metadata
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/castyapp/grpc.server/config"
+	"github.com/castyapp/grpc.server/models"
+)
+
+const omdbBaseURL = "https://www.omdbapi.com"
+
+var imdbIDRegex = regexp.MustCompile(`^tt\d+$`)
+
+type omdbResult struct {
+	Response string `json:"Response"`
+	Error    string `json:"Error"`
+	Title    string `json:"Title"`
+	Year     string `json:"Year"`
+	Runtime  string `json:"Runtime"`
+	Genre    string `json:"Genre"`
+	Plot     string `json:"Plot"`
+	Poster   string `json:"Poster"`
+	Type     string `json:"Type"`
+	ImdbID   string `json:"imdbID"`
+}
+
+type omdbSearchResponse struct {
+	Response string        `json:"Response"`
+	Error    string        `json:"Error"`
+	Search   []*omdbResult `json:"Search"`
+}
+
+// OMDb looks up metadata with the Open Movie Database api. Movies and series
+// have their imdb ids like tt0133093, episodes tt0944947:1:2.
+type OMDb struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+func NewOMDb(c config.MetadataMap, client *http.Client) *OMDb {
+	o := &OMDb{baseURL: c.BaseURL, apiKey: c.APIKey, client: client}
+	if o.baseURL == "" {
+		o.baseURL = omdbBaseURL
+	}
+	return o
+}
+
+func (o *OMDb) Name() string {
+	return "omdb"
+}
+
+// get gets the api, omdb answers with a 200 and a Response of False when nothing is found.
+func (o *OMDb) get(ctx context.Context, params url.Values, v interface{}) error {
+	params.Set("apikey", o.apiKey)
+	return getJSON(ctx, o.client, endpoint(o.baseURL, "/", params), v)
+}
+
+func omdbError(message string) error {
+	if strings.Contains(strings.ToLower(message), "api key") {
+		return ErrUnauthorized
+	}
+	return ErrNotFound
+}
+
+func (o *OMDb) newMetadata(id string, r *omdbResult) *models.MediaMetadata {
+	m := &models.MediaMetadata{
+		Provider: o.Name(),
+		ID:       id,
+		Kind:     models.MediaMetadataMovie,
+		Title:    r.Title,
+		Year:     parseYear(r.Year),
+	}
+	if r.Type == "series" {
+		m.Kind = models.MediaMetadataSeries
+	}
+	// omdb uses N/A for the values that it does not know
+	if r.Plot != "N/A" {
+		m.Synopsis = r.Plot
+	}
+	if r.Poster != "N/A" {
+		m.Poster = r.Poster
+	}
+	if fields := strings.Fields(r.Runtime); len(fields) > 0 {
+		m.Runtime, _ = strconv.Atoi(fields[0])
+	}
+	if r.Genre != "" && r.Genre != "N/A" {
+		for _, genre := range strings.Split(r.Genre, ",") {
+			m.Genres = append(m.Genres, strings.TrimSpace(genre))
+		}
+	}
+	return m
+}
+
+func (o *OMDb) Search(ctx context.Context, q Query) ([]*models.MediaMetadata, error) {
+
+	var (
+		params = url.Values{"s": {q.Title}, "type": {"movie"}}
+		resp   = new(omdbSearchResponse)
+	)
+
+	if q.IsEpisode() {
+		params.Set("type", "series")
+	}
+
+	if q.Year > 0 {
+		params.Set("y", strconv.Itoa(q.Year))
+	}
+
+	if err := o.get(ctx, params, resp); err != nil {
+		return nil, err
+	}
+
+	results := make([]*models.MediaMetadata, 0, len(resp.Search))
+	if resp.Response == "False" {
+		if err := omdbError(resp.Error); err != ErrNotFound {
+			return nil, err
+		}
+		return results, nil
+	}
+
+	for _, r := range resp.Search {
+		if len(results) == maxResults {
+			break
+		}
+		if !q.IsEpisode() {
+			results = append(results, o.newMetadata(r.ImdbID, r))
+			continue
+		}
+		// the episode itself is looked up once the user picks the series
+		m := o.newMetadata(r.ImdbID+":"+strconv.Itoa(q.Season)+":"+strconv.Itoa(q.Episode), r)
+		m.Kind = models.MediaMetadataEpisode
+		m.Season, m.Episode = q.Season, q.Episode
+		results = append(results, m)
+	}
+
+	return results, nil
+}
+
+func (o *OMDb) Get(ctx context.Context, id string) (*models.MediaMetadata, error) {
+
+	parts := strings.Split(id, ":")
+	if !imdbIDRegex.MatchString(parts[0]) || (len(parts) != 1 && len(parts) != 3) {
+		return nil, ErrInvalidID
+	}
+
+	series := new(omdbResult)
+	if err := o.get(ctx, url.Values{"i": {parts[0]}, "plot": {"short"}}, series); err != nil {
+		return nil, err
+	}
+	if series.Response == "False" {
+		return nil, omdbError(series.Error)
+	}
+
+	if len(parts) == 1 {
+		return o.newMetadata(id, series), nil
+	}
+
+	season, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, ErrInvalidID
+	}
+	episodeNumber, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return nil, ErrInvalidID
+	}
+
+	episode := new(omdbResult)
+	if err := o.get(ctx, url.Values{"i": {parts[0]}, "Season": {parts[1]}, "Episode": {parts[2]}, "plot": {"short"}}, episode); err != nil {
+		return nil, err
+	}
+	if episode.Response == "False" {
+		return nil, omdbError(episode.Error)
+	}
+
+	m := o.newMetadata(id, series)
+	m.Kind = models.MediaMetadataEpisode
+	m.Season, m.Episode = season, episodeNumber
+	m.EpisodeTitle = episode.Title
+	details := o.newMetadata(id, episode)
+	if details.Synopsis != "" {
+		m.Synopsis = details.Synopsis
+	}
+	if details.Runtime > 0 {
+		m.Runtime = details.Runtime
+	}
+
+	return m, nil
+}
@@ -0,0 +1,201 @@
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/castyapp/grpc.server/config"
+	"github.com/castyapp/grpc.server/models"
+)
+
+const (
+	tmdbBaseURL      = "https://api.themoviedb.org/3"
+	tmdbImageBaseURL = "https://image.tmdb.org/t/p/w500"
+)
+
+type tmdbGenre struct {
+	Name string `json:"name"`
+}
+
+type tmdbResult struct {
+	ID             int          `json:"id"`
+	Title          string       `json:"title"`
+	Name           string       `json:"name"`
+	ReleaseDate    string       `json:"release_date"`
+	FirstAirDate   string       `json:"first_air_date"`
+	Overview       string       `json:"overview"`
+	PosterPath     string       `json:"poster_path"`
+	Genres         []*tmdbGenre `json:"genres"`
+	Runtime        int          `json:"runtime"`
+	EpisodeRunTime []int        `json:"episode_run_time"`
+}
+
+type tmdbSearchResponse struct {
+	Results []*tmdbResult `json:"results"`
+}
+
+// TMDB looks up metadata with the v3 api of The Movie Database. Movies have
+// ids like movie:603, series tv:1399 and episodes tv:1399:1:2.
+type TMDB struct {
+	baseURL      string
+	imageBaseURL string
+	apiKey       string
+	language     string
+	client       *http.Client
+}
+
+func NewTMDB(c config.MetadataMap, client *http.Client) *TMDB {
+	t := &TMDB{
+		baseURL:      c.BaseURL,
+		imageBaseURL: c.ImageBaseURL,
+		apiKey:       c.APIKey,
+		language:     c.Language,
+		client:       client,
+	}
+	if t.baseURL == "" {
+		t.baseURL = tmdbBaseURL
+	}
+	if t.imageBaseURL == "" {
+		t.imageBaseURL = tmdbImageBaseURL
+	}
+	return t
+}
+
+func (t *TMDB) Name() string {
+	return "tmdb"
+}
+
+func (t *TMDB) get(ctx context.Context, path string, params url.Values, v interface{}) error {
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("api_key", t.apiKey)
+	if t.language != "" {
+		params.Set("language", t.language)
+	}
+	return getJSON(ctx, t.client, endpoint(t.baseURL, path, params), v)
+}
+
+func (t *TMDB) image(path string) string {
+	if path == "" {
+		return ""
+	}
+	return strings.TrimRight(t.imageBaseURL, "/") + path
+}
+
+func (t *TMDB) newMetadata(kind models.MediaMetadataKind, id string, r *tmdbResult) *models.MediaMetadata {
+	m := &models.MediaMetadata{
+		Provider: t.Name(),
+		ID:       id,
+		Kind:     kind,
+		Title:    r.Title,
+		Year:     parseYear(r.ReleaseDate),
+		Synopsis: r.Overview,
+		Runtime:  r.Runtime,
+		Poster:   t.image(r.PosterPath),
+	}
+	if kind != models.MediaMetadataMovie {
+		m.Title = r.Name
+		m.Year = parseYear(r.FirstAirDate)
+		if len(r.EpisodeRunTime) > 0 {
+			m.Runtime = r.EpisodeRunTime[0]
+		}
+	}
+	for _, genre := range r.Genres {
+		m.Genres = append(m.Genres, genre.Name)
+	}
+	return m
+}
+
+func (t *TMDB) Search(ctx context.Context, q Query) ([]*models.MediaMetadata, error) {
+
+	var (
+		path   = "/search/movie"
+		params = url.Values{"query": {q.Title}}
+		resp   = new(tmdbSearchResponse)
+	)
+
+	switch {
+	case q.IsEpisode():
+		path = "/search/tv"
+		if q.Year > 0 {
+			params.Set("first_air_date_year", strconv.Itoa(q.Year))
+		}
+	case q.Year > 0:
+		params.Set("year", strconv.Itoa(q.Year))
+	}
+
+	if err := t.get(ctx, path, params, resp); err != nil {
+		return nil, err
+	}
+
+	results := make([]*models.MediaMetadata, 0, len(resp.Results))
+	for _, r := range resp.Results {
+		if len(results) == maxResults {
+			break
+		}
+		if !q.IsEpisode() {
+			results = append(results, t.newMetadata(models.MediaMetadataMovie, fmt.Sprintf("movie:%d", r.ID), r))
+			continue
+		}
+		// the episode itself is looked up once the user picks the series
+		m := t.newMetadata(models.MediaMetadataEpisode, fmt.Sprintf("tv:%d:%d:%d", r.ID, q.Season, q.Episode), r)
+		m.Season, m.Episode = q.Season, q.Episode
+		results = append(results, m)
+	}
+
+	return results, nil
+}
+
+func (t *TMDB) Get(ctx context.Context, id string) (*models.MediaMetadata, error) {
+
+	parts := strings.Split(id, ":")
+	for _, part := range parts[1:] {
+		if _, err := strconv.Atoi(part); err != nil {
+			return nil, ErrInvalidID
+		}
+	}
+
+	switch {
+	case parts[0] == "movie" && len(parts) == 2:
+		movie := new(tmdbResult)
+		if err := t.get(ctx, "/movie/"+parts[1], nil, movie); err != nil {
+			return nil, err
+		}
+		return t.newMetadata(models.MediaMetadataMovie, id, movie), nil
+	case parts[0] == "tv" && len(parts) == 2:
+		series := new(tmdbResult)
+		if err := t.get(ctx, "/tv/"+parts[1], nil, series); err != nil {
+			return nil, err
+		}
+		return t.newMetadata(models.MediaMetadataSeries, id, series), nil
+	case parts[0] == "tv" && len(parts) == 4:
+		var (
+			series  = new(tmdbResult)
+			episode = new(tmdbResult)
+		)
+		if err := t.get(ctx, "/tv/"+parts[1], nil, series); err != nil {
+			return nil, err
+		}
+		if err := t.get(ctx, fmt.Sprintf("/tv/%s/season/%s/episode/%s", parts[1], parts[2], parts[3]), nil, episode); err != nil {
+			return nil, err
+		}
+		m := t.newMetadata(models.MediaMetadataEpisode, id, series)
+		m.Season, _ = strconv.Atoi(parts[2])
+		m.Episode, _ = strconv.Atoi(parts[3])
+		m.EpisodeTitle = episode.Name
+		if episode.Overview != "" {
+			m.Synopsis = episode.Overview
+		}
+		if episode.Runtime > 0 {
+			m.Runtime = episode.Runtime
+		}
+		return m, nil
+	}
+
+	return nil, ErrInvalidID
+}
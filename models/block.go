@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Block struct {
+	ID            *primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID        *primitive.ObjectID `bson:"user_id,omitempty" json:"user_id,omitempty"`
+	BlockedUserID *primitive.ObjectID `bson:"blocked_user_id,omitempty" json:"blocked_user_id,omitempty"`
+	CreatedAt     time.Time           `bson:"created_at,omitempty" json:"created_at,omitempty"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MediaCollection is a folder of the media library of a user, collections
+// without a parent are at the root of the library.
+type MediaCollection struct {
+	ID        *primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID    *primitive.ObjectID `bson:"user_id" json:"user_id"`
+	ParentID  *primitive.ObjectID `bson:"parent_id,omitempty" json:"parent_id,omitempty"`
+	Name      string              `bson:"name" json:"name"`
+	CreatedAt time.Time           `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time           `bson:"updated_at" json:"updated_at"`
+}
+
+// MediaEpisode places a media source in a series of the library.
+type MediaEpisode struct {
+	Title   string `bson:"title" json:"title"`
+	Season  int    `bson:"season" json:"season"`
+	Episode int    `bson:"episode" json:"episode"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type MediaJobKind string
+
+const (
+	MediaJobExtractTracks MediaJobKind = "extract_tracks"
+	MediaJobThumbnails    MediaJobKind = "thumbnails"
+)
+
+type MediaJobStatus string
+
+const (
+	MediaJobPending   MediaJobStatus = "pending"
+	MediaJobRunning   MediaJobStatus = "running"
+	MediaJobCompleted MediaJobStatus = "completed"
+	MediaJobFailed    MediaJobStatus = "failed"
+)
+
+// MediaJob is a background job that processes an uploaded media source.
+type MediaJob struct {
+	ID            *primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID        *primitive.ObjectID `bson:"user_id,omitempty" json:"user_id,omitempty"`
+	MediaSourceID *primitive.ObjectID `bson:"media_source_id,omitempty" json:"media_source_id,omitempty"`
+	Kind          MediaJobKind        `bson:"kind" json:"kind"`
+	Status        MediaJobStatus      `bson:"status" json:"status"`
+	// Progress is a percentage between 0 and 100
+	Progress int    `bson:"progress" json:"progress"`
+	Step     string `bson:"step,omitempty" json:"step,omitempty"`
+	Attempts int    `bson:"attempts" json:"attempts"`
+	Error    string `bson:"error,omitempty" json:"error,omitempty"`
+	// Warnings are the problems that did not fail the whole job, like a track that could not be extracted
+	Warnings   []string  `bson:"warnings,omitempty" json:"warnings,omitempty"`
+	StartedAt  time.Time `bson:"started_at,omitempty" json:"started_at,omitempty"`
+	FinishedAt time.Time `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+	CreatedAt  time.Time `bson:"created_at,omitempty" json:"created_at,omitempty"`
+	UpdatedAt  time.Time `bson:"updated_at,omitempty" json:"updated_at,omitempty"`
+}
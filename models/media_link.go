@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// MediaLink is how the server of the uri of a media source answered when it was checked.
+type MediaLink struct {
+	ContentType string `bson:"content_type" json:"content_type"`
+	// Size is zero when the server does not send the length of the content
+	Size int64 `bson:"size" json:"size"`
+	// AcceptRanges is true when the server supports byte ranges, the player needs them to seek
+	AcceptRanges bool           `bson:"accept_ranges" json:"accept_ranges"`
+	CORS         *MediaLinkCORS `bson:"cors" json:"cors"`
+	CheckedAt    time.Time      `bson:"checked_at" json:"checked_at"`
+}
+
+// MediaLinkCORS are the cross origin headers that the server sent to the origin of the web player.
+type MediaLinkCORS struct {
+	AllowOrigin      string   `bson:"allow_origin" json:"allow_origin"`
+	AllowCredentials bool     `bson:"allow_credentials" json:"allow_credentials"`
+	ExposeHeaders    []string `bson:"expose_headers" json:"expose_headers"`
+	// Allowed is true when the web player can read the media with fetch requests
+	Allowed bool `bson:"allowed" json:"allowed"`
+}
@@ -0,0 +1,27 @@
+package models
+
+type MediaMetadataKind string
+
+const (
+	MediaMetadataMovie   MediaMetadataKind = "movie"
+	MediaMetadataSeries  MediaMetadataKind = "series"
+	MediaMetadataEpisode MediaMetadataKind = "episode"
+)
+
+// MediaMetadata is what a movie or tv show database knows about a media source.
+type MediaMetadata struct {
+	Provider string `bson:"provider" json:"provider"`
+	// ID is the id of the movie, series or episode at the provider
+	ID       string            `bson:"id" json:"id"`
+	Kind     MediaMetadataKind `bson:"kind" json:"kind"`
+	Title    string            `bson:"title" json:"title"`
+	Year     int               `bson:"year,omitempty" json:"year,omitempty"`
+	Synopsis string            `bson:"synopsis,omitempty" json:"synopsis,omitempty"`
+	Genres   []string          `bson:"genres,omitempty" json:"genres,omitempty"`
+	// Runtime in minutes
+	Runtime      int    `bson:"runtime,omitempty" json:"runtime,omitempty"`
+	Poster       string `bson:"poster,omitempty" json:"poster,omitempty"`
+	Season       int    `bson:"season,omitempty" json:"season,omitempty"`
+	Episode      int    `bson:"episode,omitempty" json:"episode,omitempty"`
+	EpisodeTitle string `bson:"episode_title,omitempty" json:"episode_title,omitempty"`
+}
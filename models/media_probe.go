@@ -0,0 +1,76 @@
+package models
+
+import "time"
+
+type MediaTrack struct {
+	Index           int    `bson:"index" json:"index"`
+	Codec           string `bson:"codec" json:"codec"`
+	Language        string `bson:"language,omitempty" json:"language,omitempty"`
+	Title           string `bson:"title,omitempty" json:"title,omitempty"`
+	Default         bool   `bson:"default" json:"default"`
+	Forced          bool   `bson:"forced" json:"forced"`
+	HearingImpaired bool   `bson:"hearing_impaired" json:"hearing_impaired"`
+}
+
+// MediaProbe is what ffprobe found out about a media source.
+type MediaProbe struct {
+	// Duration in seconds
+	Duration       float64       `bson:"duration" json:"duration"`
+	Container      string        `bson:"container" json:"container"`
+	Bitrate        int64         `bson:"bitrate" json:"bitrate"`
+	VideoCodec     string        `bson:"video_codec,omitempty" json:"video_codec,omitempty"`
+	AudioCodec     string        `bson:"audio_codec,omitempty" json:"audio_codec,omitempty"`
+	Width          int           `bson:"width,omitempty" json:"width,omitempty"`
+	Height         int           `bson:"height,omitempty" json:"height,omitempty"`
+	AudioTracks    []*MediaTrack `bson:"audio_tracks" json:"audio_tracks"`
+	SubtitleTracks []*MediaTrack `bson:"subtitle_tracks" json:"subtitle_tracks"`
+	ProbedAt       time.Time     `bson:"probed_at" json:"probed_at"`
+}
+
+// MediaThumbnails are the seek previews of a media source, the sprite sheets
+// and the WebVTT thumbnail track are stored in the uploads bucket.
+type MediaThumbnails struct {
+	// Interval between two previews in seconds
+	Interval    float64   `bson:"interval" json:"interval"`
+	Width       int       `bson:"width" json:"width"`
+	Height      int       `bson:"height" json:"height"`
+	Track       string    `bson:"track" json:"track"`
+	Sprites     []string  `bson:"sprites" json:"sprites"`
+	GeneratedAt time.Time `bson:"generated_at" json:"generated_at"`
+}
+
+// MediaVariant is a rendition of a stream that the player can switch to.
+type MediaVariant struct {
+	Bandwidth     int64   `bson:"bandwidth" json:"bandwidth"`
+	Width         int     `bson:"width,omitempty" json:"width,omitempty"`
+	Height        int     `bson:"height,omitempty" json:"height,omitempty"`
+	Codecs        string  `bson:"codecs,omitempty" json:"codecs,omitempty"`
+	FrameRate     float64 `bson:"frame_rate,omitempty" json:"frame_rate,omitempty"`
+	AudioGroup    string  `bson:"audio_group,omitempty" json:"audio_group,omitempty"`
+	SubtitleGroup string  `bson:"subtitle_group,omitempty" json:"subtitle_group,omitempty"`
+	URI           string  `bson:"uri,omitempty" json:"uri,omitempty"`
+}
+
+// MediaRendition is an alternative audio or subtitle rendition of a stream.
+type MediaRendition struct {
+	GroupID  string `bson:"group_id,omitempty" json:"group_id,omitempty"`
+	Name     string `bson:"name,omitempty" json:"name,omitempty"`
+	Language string `bson:"language,omitempty" json:"language,omitempty"`
+	Codecs   string `bson:"codecs,omitempty" json:"codecs,omitempty"`
+	Default  bool   `bson:"default" json:"default"`
+	Forced   bool   `bson:"forced" json:"forced"`
+	URI      string `bson:"uri,omitempty" json:"uri,omitempty"`
+}
+
+// MediaManifest is what the HLS or DASH manifest of a stream media source lists.
+type MediaManifest struct {
+	// Format is either hls or dash
+	Format string `bson:"format" json:"format"`
+	Live   bool   `bson:"live" json:"live"`
+	// Duration in seconds, it's zero for live streams
+	Duration           float64           `bson:"duration" json:"duration"`
+	Variants           []*MediaVariant   `bson:"variants" json:"variants"`
+	AudioRenditions    []*MediaRendition `bson:"audio_renditions" json:"audio_renditions"`
+	SubtitleRenditions []*MediaRendition `bson:"subtitle_renditions" json:"subtitle_renditions"`
+	InspectedAt        time.Time         `bson:"inspected_at" json:"inspected_at"`
+}
@@ -8,15 +8,26 @@ import (
 )
 
 type MediaSource struct {
-	ID        *primitive.ObjectID    `bson:"_id, omitempty" json:"id,omitempty"`
-	UserID    *primitive.ObjectID    `bson:"user_id,omitempty" json:"user_id,omitempty"`
-	Title     string                 `bson:"title" json:"title"`
-	Type      proto.MediaSource_Type `bson:"type" json:"type,omitempty"`
-	Banner    string                 `bson:"banner" json:"banner,omitempty"`
-	URI       string                 `bson:"uri" json:"uri,omitempty"`
-	Length    int64                  `bson:"length" json:"length,omitempty"`
-	Artist    string                 `bson:"artist" json:"artist,omitempty"`
-	Subtitles []*Subtitle            `json:"subtitles,omitempty"`
-	CreatedAt time.Time              `bson:"created_at,omitempty" json:"created_at,omitempty"`
-	UpdatedAt time.Time              `bson:"updated_at,omitempty" json:"updated_at,omitempty"`
+	ID           *primitive.ObjectID    `bson:"_id, omitempty" json:"id,omitempty"`
+	UserID       *primitive.ObjectID    `bson:"user_id,omitempty" json:"user_id,omitempty"`
+	Title        string                 `bson:"title" json:"title"`
+	Type         proto.MediaSource_Type `bson:"type" json:"type,omitempty"`
+	Banner       string                 `bson:"banner" json:"banner,omitempty"`
+	URI          string                 `bson:"uri" json:"uri,omitempty"`
+	Length       int64                  `bson:"length" json:"length,omitempty"`
+	Artist       string                 `bson:"artist" json:"artist,omitempty"`
+	ObjectKey    string                 `bson:"object_key,omitempty" json:"object_key,omitempty"`
+	Size         int64                  `bson:"size,omitempty" json:"size,omitempty"`
+	Probe        *MediaProbe            `bson:"probe,omitempty" json:"probe,omitempty"`
+	AudioTracks  []*MediaTrack          `bson:"audio_tracks,omitempty" json:"audio_tracks,omitempty"`
+	Thumbnails   *MediaThumbnails       `bson:"thumbnails,omitempty" json:"thumbnails,omitempty"`
+	Manifest     *MediaManifest         `bson:"manifest,omitempty" json:"manifest,omitempty"`
+	Metadata     *MediaMetadata         `bson:"metadata,omitempty" json:"metadata,omitempty"`
+	Link         *MediaLink             `bson:"link,omitempty" json:"link,omitempty"`
+	CollectionID *primitive.ObjectID    `bson:"collection_id,omitempty" json:"collection_id,omitempty"`
+	Tags         []string               `bson:"tags,omitempty" json:"tags,omitempty"`
+	Series       *MediaEpisode          `bson:"series,omitempty" json:"series,omitempty"`
+	Subtitles    []*Subtitle            `json:"subtitles,omitempty"`
+	CreatedAt    time.Time              `bson:"created_at,omitempty" json:"created_at,omitempty"`
+	UpdatedAt    time.Time              `bson:"updated_at,omitempty" json:"updated_at,omitempty"`
 }
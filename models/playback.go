@@ -0,0 +1,106 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	MinPlaybackRate = 0.25
+	MaxPlaybackRate = 4
+)
+
+var (
+	ErrInvalidPosition     = errors.New("playback position is out of the media")
+	ErrInvalidPlaybackRate = errors.New("playback rate is out of range")
+)
+
+// PlaybackState is the playback of the media of a theater as the server sees it. Position
+// is where the media was at UpdatedAt, it moves on with the rate while the media is playing
+// so the clients work out the current position with the server time instead of each other.
+type PlaybackState struct {
+	TheaterID     *primitive.ObjectID `bson:"_id" json:"theater_id"`
+	MediaSourceID *primitive.ObjectID `bson:"media_source_id,omitempty" json:"media_source_id,omitempty"`
+	// Position in seconds
+	Position float64 `bson:"position" json:"position"`
+	Rate     float64 `bson:"rate" json:"rate"`
+	Paused   bool    `bson:"paused" json:"paused"`
+	// Length of the media in seconds, the position stops there, it's zero when it's unknown
+	Length    float64             `bson:"length" json:"length"`
+	UpdatedBy *primitive.ObjectID `bson:"updated_by,omitempty" json:"updated_by,omitempty"`
+	UpdatedAt time.Time           `bson:"updated_at" json:"updated_at"`
+	// Version increases with every change, older snapshots never replace newer ones
+	Version int64 `bson:"version" json:"version"`
+}
+
+// NewPlaybackState returns the state of media that was just selected, paused at the start.
+func NewPlaybackState(theaterID, mediaSourceID *primitive.ObjectID, length float64, now time.Time) *PlaybackState {
+	return &PlaybackState{
+		TheaterID:     theaterID,
+		MediaSourceID: mediaSourceID,
+		Rate:          1,
+		Paused:        true,
+		Length:        length,
+		UpdatedAt:     now,
+	}
+}
+
+// PositionAt returns the position of the media at the time.
+func (p *PlaybackState) PositionAt(t time.Time) float64 {
+	position := p.Position
+	if !p.Paused && t.After(p.UpdatedAt) {
+		position += t.Sub(p.UpdatedAt).Seconds() * p.Rate
+	}
+	if p.Length > 0 && position > p.Length {
+		position = p.Length
+	}
+	return position
+}
+
+// advance moves the position to the time, every change starts from the current position.
+func (p *PlaybackState) advance(userID *primitive.ObjectID, now time.Time) {
+	p.Position = p.PositionAt(now)
+	p.UpdatedBy = userID
+	p.UpdatedAt = now
+	p.Version++
+}
+
+func (p *PlaybackState) Play(userID *primitive.ObjectID, now time.Time) {
+	p.advance(userID, now)
+	p.Paused = false
+}
+
+func (p *PlaybackState) Pause(userID *primitive.ObjectID, now time.Time) {
+	p.advance(userID, now)
+	p.Paused = true
+}
+
+func (p *PlaybackState) Seek(userID *primitive.ObjectID, position float64, now time.Time) error {
+	if position < 0 || (p.Length > 0 && position > p.Length) {
+		return ErrInvalidPosition
+	}
+	p.advance(userID, now)
+	p.Position = position
+	return nil
+}
+
+func (p *PlaybackState) SetRate(userID *primitive.ObjectID, rate float64, now time.Time) error {
+	if rate < MinPlaybackRate || rate > MaxPlaybackRate {
+		return ErrInvalidPlaybackRate
+	}
+	p.advance(userID, now)
+	p.Rate = rate
+	return nil
+}
+
+// SetLength changes the length of the media when it was read again, a position that is past
+// the new length is moved to its end.
+func (p *PlaybackState) SetLength(length float64, now time.Time) {
+	p.advance(nil, now)
+	p.Length = length
+	if p.Length > 0 && p.Position > p.Length {
+		p.Position = p.Length
+	}
+}
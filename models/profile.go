@@ -0,0 +1,59 @@
+package models
+
+type Visibility string
+
+const (
+	VisibilityPublic  Visibility = "public"
+	VisibilityFriends Visibility = "friends"
+	VisibilityOnlyMe  Visibility = "only_me"
+)
+
+// Relation is how the user who is looking at a profile relates to its owner.
+type Relation int
+
+const (
+	RelationStranger Relation = iota
+	RelationFriend
+	RelationSelf
+)
+
+func (v Visibility) IsValid() bool {
+	switch v {
+	case VisibilityPublic, VisibilityFriends, VisibilityOnlyMe:
+		return true
+	}
+	return false
+}
+
+// Allows reports whether a field with this visibility can be shown to a viewer
+// with the given relation, an unset visibility falls back to the given default.
+func (v Visibility) Allows(relation Relation, fallback Visibility) bool {
+	if !v.IsValid() {
+		v = fallback
+	}
+	switch v {
+	case VisibilityPublic:
+		return true
+	case VisibilityFriends:
+		return relation == RelationFriend || relation == RelationSelf
+	}
+	return relation == RelationSelf
+}
+
+type Profile struct {
+	Bio            string   `bson:"bio,omitempty" json:"bio,omitempty"`
+	Location       string   `bson:"location,omitempty" json:"location,omitempty"`
+	Links          []string `bson:"links,omitempty" json:"links,omitempty"`
+	Banner         string   `bson:"banner,omitempty" json:"banner,omitempty"`
+	FavouriteMedia []string `bson:"favourite_media,omitempty" json:"favourite_media,omitempty"`
+	Timezone       string   `bson:"timezone,omitempty" json:"timezone,omitempty"`
+}
+
+type ProfileVisibility struct {
+	Email          Visibility `bson:"email,omitempty" json:"email,omitempty"`
+	Bio            Visibility `bson:"bio,omitempty" json:"bio,omitempty"`
+	Location       Visibility `bson:"location,omitempty" json:"location,omitempty"`
+	Links          Visibility `bson:"links,omitempty" json:"links,omitempty"`
+	FavouriteMedia Visibility `bson:"favourite_media,omitempty" json:"favourite_media,omitempty"`
+	Timezone       Visibility `bson:"timezone,omitempty" json:"timezone,omitempty"`
+}
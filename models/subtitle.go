@@ -6,11 +6,23 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Subtitle of a media source. File of the subtitles that are stored by us is the s3:// uri of
+// their WebVTT copy, which clients get as a presigned url, subtitles added with a file that is
+// not an http or https url keep it as it was given.
 type Subtitle struct {
 	ID            *primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
 	MediaSourceID *primitive.ObjectID `bson:"media_source_id,omitempty" json:"media_source_id,omitempty"`
-	Lang          string              `bson:"lang" json:"size"`
+	Lang          string              `bson:"lang" json:"lang"`
 	File          string              `bson:"file" json:"file"`
+	Label         string              `bson:"label,omitempty" json:"label,omitempty"`
+	Forced        bool                `bson:"forced" json:"forced"`
+	SDH           bool                `bson:"sdh" json:"sdh"`
+	Default       bool                `bson:"default" json:"default"`
+	OffsetMs      int64               `bson:"offset_ms" json:"offset_ms"`
+	Version       int                 `bson:"version,omitempty" json:"version,omitempty"`
+	TrackIndex    *int                `bson:"track_index,omitempty" json:"track_index,omitempty"`
+	ObjectKey     string              `bson:"object_key,omitempty" json:"object_key,omitempty"`
+	Size          int64               `bson:"size,omitempty" json:"size,omitempty"`
 	CreatedAt     time.Time           `bson:"created_at,omitempty" json:"created_at,omitempty"`
 	UpdatedAt     time.Time           `bson:"updated_at,omitempty" json:"updated_at,omitempty"`
 }
@@ -16,6 +16,8 @@ type Theater struct {
 	MediaSourceID     *primitive.ObjectID       `bson:"media_source_id,omitempty" json:"media_source_id,omitempty"`
 	CreatedAt         time.Time                 `bson:"created_at,omitempty" json:"created_at,omitempty"`
 	UpdatedAt         time.Time                 `bson:"updated_at,omitempty" json:"updated_at,omitempty"`
+	// VideoPlayerUserIDs are the members that control the video player with ACCESS_BY_CHOOSEN_FRIENDS
+	VideoPlayerUserIDs []*primitive.ObjectID `bson:"video_player_user_ids,omitempty" json:"video_player_user_ids,omitempty"`
 }
 
 type Follow struct {
@@ -32,4 +34,21 @@ type TheaterMember struct {
 	ID        *primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
 	TheaterID *primitive.ObjectID `bson:"theater_id,omitempty" json:"theater_id,omitempty"`
 	UserID    *primitive.ObjectID `bson:"user_id,omitempty" json:"user_id,omitempty"`
+	JoinedAt  time.Time           `bson:"joined_at,omitempty" json:"joined_at,omitempty"`
+}
+
+// TheaterBan keeps a user out of a theater, until ExpiresAt when it's set.
+type TheaterBan struct {
+	ID        *primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	TheaterID *primitive.ObjectID `bson:"theater_id,omitempty" json:"theater_id,omitempty"`
+	UserID    *primitive.ObjectID `bson:"user_id,omitempty" json:"user_id,omitempty"`
+	BannedBy  *primitive.ObjectID `bson:"banned_by,omitempty" json:"banned_by,omitempty"`
+	Reason    string              `bson:"reason,omitempty" json:"reason,omitempty"`
+	ExpiresAt *time.Time          `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+	CreatedAt time.Time           `bson:"created_at,omitempty" json:"created_at,omitempty"`
+}
+
+// IsActive reports whether the ban still keeps the user out at the time.
+func (b *TheaterBan) IsActive(t time.Time) bool {
+	return b.ExpiresAt == nil || b.ExpiresAt.After(t)
 }
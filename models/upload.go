@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type UploadKind string
+
+const (
+	UploadKindVideo    UploadKind = "video"
+	UploadKindAudio    UploadKind = "audio"
+	UploadKindSubtitle UploadKind = "subtitle"
+)
+
+type UploadStatus string
+
+const (
+	UploadStatusPending UploadStatus = "pending"
+	// UploadStatusCompleting is claimed by the CompleteUpload call that is checking the upload
+	UploadStatusCompleting UploadStatus = "completing"
+	UploadStatusCompleted  UploadStatus = "completed"
+)
+
+// UnfinishedUploadStatuses are the uploads that are not completed yet.
+var UnfinishedUploadStatuses = []UploadStatus{UploadStatusPending, UploadStatusCompleting}
+
+type Upload struct {
+	ID          *primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID      *primitive.ObjectID `bson:"user_id,omitempty" json:"user_id,omitempty"`
+	Kind        UploadKind          `bson:"kind" json:"kind"`
+	Status      UploadStatus        `bson:"status" json:"status"`
+	Bucket      string              `bson:"bucket" json:"bucket"`
+	ObjectKey   string              `bson:"object_key" json:"object_key"`
+	Filename    string              `bson:"filename" json:"filename"`
+	ContentType string              `bson:"content_type" json:"content_type"`
+	// DeclaredSize is reserved from the quota of the user until the upload is completed
+	DeclaredSize  int64               `bson:"declared_size" json:"declared_size"`
+	Size          int64               `bson:"size" json:"size"`
+	MediaSourceID *primitive.ObjectID `bson:"media_source_id,omitempty" json:"media_source_id,omitempty"`
+	SubtitleID    *primitive.ObjectID `bson:"subtitle_id,omitempty" json:"subtitle_id,omitempty"`
+	Lang          string              `bson:"lang,omitempty" json:"lang,omitempty"`
+	ExpiresAt     time.Time           `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+	CreatedAt     time.Time           `bson:"created_at,omitempty" json:"created_at,omitempty"`
+	UpdatedAt     time.Time           `bson:"updated_at,omitempty" json:"updated_at,omitempty"`
+}
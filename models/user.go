@@ -26,6 +26,9 @@ type User struct {
 	State                proto.PERSONAL_STATE `bson:"state,omitempty" json:"state,omitempty"`
 	Avatar               string               `bson:"avatar,omitempty" json:"avatar,omitempty"`
 	RoleID               uint                 `bson:"role_id,omitempty" json:"role_id,omitempty"`
+	Profile              Profile              `bson:"profile,omitempty" json:"profile,omitempty"`
+	Visibility           ProfileVisibility    `bson:"visibility,omitempty" json:"visibility,omitempty"`
+	UsernameChangedAt    time.Time            `bson:"username_changed_at,omitempty" json:"username_changed_at,omitempty"`
 	LastLogin            time.Time            `bson:"last_login,omitempty" json:"last_login,omitempty"`
 	JoinedAt             time.Time            `bson:"joined_at,omitempty" json:"joined_at,omitempty"`
 	UpdatedAt            time.Time            `bson:"updated_at,omitempty" json:"updated_at,omitempty"`
@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type UsernameHistory struct {
+	ID            *primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID        *primitive.ObjectID `bson:"user_id,omitempty" json:"user_id,omitempty"`
+	Username      string              `bson:"username,omitempty" json:"username,omitempty"`
+	ChangedAt     time.Time           `bson:"changed_at,omitempty" json:"changed_at,omitempty"`
+	ReclaimableAt time.Time           `bson:"reclaimable_at,omitempty" json:"reclaimable_at,omitempty"`
+}
@@ -0,0 +1,50 @@
+package probe
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/castyapp/grpc.server/fetcher"
+)
+
+// proxyVariables are dropped from the environment of ffprobe and ffmpeg, only our proxy is used.
+var proxyVariables = []string{"http_proxy", "https_proxy", "no_proxy", "all_proxy"}
+
+// newCommand runs ffprobe or ffmpeg with their http and https connections going through a proxy
+// that checks the addresses they connect to, the protocol whitelist only limits the protocols.
+// ffmpeg reads http_proxy for both, https urls are tunneled with CONNECT.
+// The returned function closes the proxy once the command is done. Trusted commands read the
+// urls of our own storage, which is usually on a private address, so they run without the proxy.
+func newCommand(ctx context.Context, trusted bool, path string, args ...string) (*exec.Cmd, func(), error) {
+
+	if trusted {
+		return exec.CommandContext(ctx, path, args...), func() {}, nil
+	}
+
+	proxy, err := fetcher.StartProxy(0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	env := make([]string, 0, len(os.Environ())+1)
+	for _, variable := range os.Environ() {
+		name := strings.ToLower(strings.SplitN(variable, "=", 2)[0])
+		skip := false
+		for _, proxyVariable := range proxyVariables {
+			if name == proxyVariable {
+				skip = true
+				break
+			}
+		}
+		if !skip {
+			env = append(env, variable)
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Env = append(env, "http_proxy="+proxy.URL())
+
+	return cmd, func() { proxy.Close() }, nil
+}
@@ -0,0 +1,198 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/castyapp/grpc.server/models"
+)
+
+var (
+	ErrFFmpegNotInstalled = errors.New("probe: ffmpeg is not installed")
+	ErrTooLarge           = errors.New("probe: extracted track is too large")
+)
+
+// textSubtitleCodecs are the subtitle codecs that ffmpeg can convert to WebVTT,
+// image based subtitles like pgs and dvd_subtitle can't be converted.
+var textSubtitleCodecs = []string{"subrip", "srt", "ass", "ssa", "webvtt", "mov_text", "text"}
+
+// IsTextSubtitle reports whether the subtitle track can be extracted as WebVTT.
+func IsTextSubtitle(track *models.MediaTrack) bool {
+	return contains(textSubtitleCodecs, track.Codec)
+}
+
+// limitedBuffer fails the writes once the limit is reached, so ffmpeg stops.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit    int
+	exceeded bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > b.limit {
+		b.exceeded = true
+		return 0, ErrTooLarge
+	}
+	return b.Buffer.Write(p)
+}
+
+type Extractor struct {
+	// Path of the ffmpeg binary
+	Path    string
+	Timeout time.Duration
+	// MaxBytes is the largest track that is extracted
+	MaxBytes int
+	// Trusted extractors only read the urls of our own storage, they connect without the proxy
+	Trusted bool
+}
+
+// run runs ffmpeg with the args, its output is written to stdout when it is not nil.
+func (e *Extractor) run(ctx context.Context, stdout *limitedBuffer, args ...string) error {
+
+	path, timeout := e.Path, e.Timeout
+	if path == "" {
+		path = "ffmpeg"
+	}
+
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	args = append([]string{"-v", "error", "-nostdin", "-protocol_whitelist", protocols}, args...)
+	command, closeProxy, err := newCommand(ctx, e.Trusted, path, args...)
+	if err != nil {
+		return fmt.Errorf("probe: could not start the proxy: %v", err)
+	}
+	defer closeProxy()
+
+	if stdout != nil {
+		command.Stdout = stdout
+	}
+
+	err = command.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return ErrTimedOut
+	}
+
+	if err != nil {
+		var execErr *exec.Error
+		if errors.As(err, &execErr) {
+			return ErrFFmpegNotInstalled
+		}
+		if stdout != nil && stdout.exceeded {
+			return ErrTooLarge
+		}
+		return fmt.Errorf("probe: ffmpeg failed: %v", err)
+	}
+
+	return nil
+}
+
+func (e *Extractor) newOutput() *limitedBuffer {
+	output := &limitedBuffer{limit: e.MaxBytes}
+	if output.limit <= 0 {
+		output.limit = 5 << 20
+	}
+	return output
+}
+
+// ExtractSubtitle converts the subtitle stream at index of the media to WebVTT.
+func (e *Extractor) ExtractSubtitle(ctx context.Context, uri string, index int) ([]byte, error) {
+	output := e.newOutput()
+	err := e.run(ctx, output,
+		"-i", uri,
+		"-map", "0:"+strconv.Itoa(index),
+		"-f", "webvtt",
+		"pipe:1",
+	)
+	if err != nil {
+		return nil, err
+	}
+	return output.Bytes(), nil
+}
+
+// Frame grabs a png frame of the video after the offset, the thumbnail filter picks
+// the most representative of the next frames so black or blurry frames are skipped.
+// Frames wider than maxWidth are scaled down.
+func (e *Extractor) Frame(ctx context.Context, uri string, offset time.Duration, maxWidth int) ([]byte, error) {
+	output := e.newOutput()
+	err := e.run(ctx, output,
+		"-ss", seconds(offset),
+		"-i", uri,
+		"-vf", fmt.Sprintf("thumbnail=50,scale='min(%d,iw)':-2", maxWidth),
+		"-frames:v", "1",
+		"-f", "image2",
+		"-c:v", "png",
+		"pipe:1",
+	)
+	if err != nil {
+		return nil, err
+	}
+	if output.Len() == 0 {
+		return nil, ErrNoStreams
+	}
+	return output.Bytes(), nil
+}
+
+// Sprites renders a frame of the video every interval, letterboxed to width x height,
+// and tiles them into jpeg sprite sheets of columns x rows frames, in order.
+func (e *Extractor) Sprites(ctx context.Context, uri string, interval time.Duration, width, height, columns, rows int) ([][]byte, error) {
+
+	dir, err := ioutil.TempDir("", "casty-sprites-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	filters := fmt.Sprintf(
+		"fps=1/%s,scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2,tile=%dx%d",
+		seconds(interval), width, height, width, height, columns, rows,
+	)
+
+	err = e.run(ctx, nil,
+		"-i", uri,
+		"-vf", filters,
+		"-q:v", "5",
+		"-start_number", "0",
+		filepath.Join(dir, "sprite_%03d.jpg"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// ReadDir sorts by name, so the sheets are in order
+	sheets := make([][]byte, 0, len(files))
+	for _, file := range files {
+		data, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		sheets = append(sheets, data)
+	}
+
+	if len(sheets) == 0 {
+		return nil, ErrNoStreams
+	}
+
+	return sheets, nil
+}
+
+func seconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
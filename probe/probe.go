@@ -0,0 +1,206 @@
+package probe
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/castyapp/grpc.server/models"
+)
+
+const DefaultTimeout = 30 * time.Second
+
+var (
+	ErrNotInstalled = errors.New("probe: ffprobe is not installed")
+	ErrTimedOut     = errors.New("probe: timed out")
+	ErrNoStreams    = errors.New("probe: media has no audio or video streams")
+)
+
+// protocols are the only protocols that ffprobe is allowed to use, so it can't read local files.
+// httpproxy tunnels https urls through the proxy of command.
+const protocols = "http,https,httpproxy,tcp,tls,crypto"
+
+var (
+	playableContainers  = []string{"mp4", "mov", "webm", "ogg", "mp3", "hls", "dash", "aac", "flac", "wav"}
+	playableVideoCodecs = []string{"h264", "vp8", "vp9", "av1", "theora"}
+	playableAudioCodecs = []string{"aac", "mp3", "opus", "vorbis", "flac", "pcm_s16le"}
+)
+
+type UnplayableError struct {
+	Reason string
+}
+
+func (e *UnplayableError) Error() string {
+	return fmt.Sprintf("media can not be played: %s", e.Reason)
+}
+
+type ffprobeStream struct {
+	Index       int               `json:"index"`
+	CodecName   string            `json:"codec_name"`
+	CodecType   string            `json:"codec_type"`
+	Width       int               `json:"width"`
+	Height      int               `json:"height"`
+	Tags        map[string]string `json:"tags"`
+	Disposition map[string]int    `json:"disposition"`
+}
+
+type ffprobeOutput struct {
+	Streams []*ffprobeStream `json:"streams"`
+	Format  struct {
+		FormatName string `json:"format_name"`
+		Duration   string `json:"duration"`
+		BitRate    string `json:"bit_rate"`
+	} `json:"format"`
+}
+
+func newTrack(s *ffprobeStream) *models.MediaTrack {
+	return &models.MediaTrack{
+		Index:           s.Index,
+		Codec:           s.CodecName,
+		Language:        s.Tags["language"],
+		Title:           s.Tags["title"],
+		Default:         s.Disposition["default"] == 1,
+		Forced:          s.Disposition["forced"] == 1,
+		HearingImpaired: s.Disposition["hearing_impaired"] == 1,
+	}
+}
+
+// Parse parses the json output of ffprobe -show_format -show_streams.
+func Parse(data []byte) (*models.MediaProbe, error) {
+
+	output := new(ffprobeOutput)
+	if err := json.Unmarshal(data, output); err != nil {
+		return nil, fmt.Errorf("probe: could not parse ffprobe output: %v", err)
+	}
+
+	var (
+		duration, _ = strconv.ParseFloat(output.Format.Duration, 64)
+		bitrate, _  = strconv.ParseInt(output.Format.BitRate, 10, 64)
+		result      = &models.MediaProbe{
+			Duration:       duration,
+			Container:      output.Format.FormatName,
+			Bitrate:        bitrate,
+			AudioTracks:    make([]*models.MediaTrack, 0),
+			SubtitleTracks: make([]*models.MediaTrack, 0),
+			ProbedAt:       time.Now(),
+		}
+	)
+
+	for _, stream := range output.Streams {
+		switch stream.CodecType {
+		case "video":
+			// cover arts of audio files are video streams too
+			if result.VideoCodec != "" || stream.Disposition["attached_pic"] == 1 {
+				continue
+			}
+			result.VideoCodec = stream.CodecName
+			result.Width = stream.Width
+			result.Height = stream.Height
+		case "audio":
+			if result.AudioCodec == "" {
+				result.AudioCodec = stream.CodecName
+			}
+			result.AudioTracks = append(result.AudioTracks, newTrack(stream))
+		case "subtitle":
+			result.SubtitleTracks = append(result.SubtitleTracks, newTrack(stream))
+		}
+	}
+
+	if result.VideoCodec == "" && result.AudioCodec == "" {
+		return nil, ErrNoStreams
+	}
+
+	return result, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckPlayable checks that the player can play the container and the codecs of the media.
+func CheckPlayable(result *models.MediaProbe) error {
+
+	containerPlayable := false
+	for _, name := range strings.Split(result.Container, ",") {
+		if contains(playableContainers, name) {
+			containerPlayable = true
+			break
+		}
+	}
+
+	if !containerPlayable {
+		return &UnplayableError{Reason: fmt.Sprintf("container [%s] is not supported", result.Container)}
+	}
+
+	if result.VideoCodec != "" && !contains(playableVideoCodecs, result.VideoCodec) {
+		return &UnplayableError{Reason: fmt.Sprintf("video codec [%s] is not supported", result.VideoCodec)}
+	}
+
+	if result.AudioCodec != "" && !contains(playableAudioCodecs, result.AudioCodec) {
+		return &UnplayableError{Reason: fmt.Sprintf("audio codec [%s] is not supported", result.AudioCodec)}
+	}
+
+	return nil
+}
+
+type Prober struct {
+	// Path of the ffprobe binary
+	Path    string
+	Timeout time.Duration
+	// Trusted probers only read the urls of our own storage, they connect without the proxy
+	Trusted bool
+}
+
+// Probe runs ffprobe on the uri and parses its output.
+func (p *Prober) Probe(ctx context.Context, uri string) (*models.MediaProbe, error) {
+
+	path, timeout := p.Path, p.Timeout
+	if path == "" {
+		path = "ffprobe"
+	}
+
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	command, closeProxy, err := newCommand(ctx, p.Trusted, path,
+		"-v", "error",
+		"-protocol_whitelist", protocols,
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		uri,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("probe: could not start the proxy: %v", err)
+	}
+	defer closeProxy()
+
+	output, err := command.Output()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, ErrTimedOut
+	}
+
+	if err != nil {
+		var execErr *exec.Error
+		if errors.As(err, &execErr) {
+			return nil, ErrNotInstalled
+		}
+		return nil, fmt.Errorf("probe: ffprobe failed: %v", err)
+	}
+
+	return Parse(output)
+}
@@ -0,0 +1,284 @@
+package search
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/castyapp/grpc.server/models"
+	"github.com/castyapp/libcasty-protocol-go/proto"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	MaxTags      = 20
+	MaxTagLength = 32
+)
+
+var (
+	ErrInvalidTag  = errors.New("tags can only have letters, digits, spaces, dashes and underscores")
+	ErrInvalidSort = errors.New("invalid media sort")
+)
+
+var tagRegex = regexp.MustCompile(`^[\p{L}\p{N} _-]+$`)
+
+// MediaSort is the order of the media library.
+type MediaSort string
+
+const (
+	SortNewest  MediaSort = "newest"
+	SortOldest  MediaSort = "oldest"
+	SortTitle   MediaSort = "title"
+	SortUpdated MediaSort = "updated"
+	// SortEpisode lists the episodes of series by season and episode, it only lists media that is in a series
+	SortEpisode MediaSort = "episode"
+)
+
+type sortField struct {
+	name string
+	// order is 1 for ascending and -1 for descending
+	order int
+}
+
+// mediaSorts are the fields that the media library is sorted by, the id always comes
+// last so every media source has a unique position for the cursors.
+var mediaSorts = map[MediaSort][]sortField{
+	SortNewest:  {{"created_at", -1}, {"_id", -1}},
+	SortOldest:  {{"created_at", 1}, {"_id", 1}},
+	SortTitle:   {{"title", 1}, {"_id", 1}},
+	SortUpdated: {{"updated_at", -1}, {"_id", -1}},
+	SortEpisode: {{"series.title", 1}, {"series.season", 1}, {"series.episode", 1}, {"_id", 1}},
+}
+
+// titleCollation compares titles case insensitively.
+var titleCollation = &options.Collation{Locale: "en", Strength: 2}
+
+type MediaQuery struct {
+	Keyword string
+	// Type filters the media by its type, every type is listed when it's unknown
+	Type         proto.MediaSource_Type
+	CollectionID *primitive.ObjectID
+	// Unfiled lists the media that is not in any collection
+	Unfiled bool
+	// Tags lists the media that has all of the tags
+	Tags   []string
+	Series string
+	Season int
+	Sort   MediaSort
+	Cursor string
+	Limit  int64
+}
+
+type MediaPage struct {
+	Results    []*models.MediaSource
+	NextCursor string
+}
+
+// NormalizeTags lowercases and deduplicates the tags, tags are matched exactly.
+func NormalizeTags(tags []string) ([]string, error) {
+	var (
+		seen       = make(map[string]bool, len(tags))
+		normalized = make([]string, 0, len(tags))
+	)
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.Join(strings.Fields(tag), " "))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len([]rune(tag)) > MaxTagLength || !tagRegex.MatchString(tag) {
+			return nil, ErrInvalidTag
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized, nil
+}
+
+// mediaCursor is the sort values of the last media source of a page.
+type mediaCursor struct {
+	Sort   MediaSort     `bson:"s"`
+	Values []interface{} `bson:"v"`
+}
+
+func encodeMediaCursor(sort MediaSort, fields []sortField, mediaSource *models.MediaSource) (string, error) {
+	cursor := &mediaCursor{Sort: sort, Values: make([]interface{}, 0, len(fields))}
+	for _, field := range fields {
+		cursor.Values = append(cursor.Values, mediaSortValue(mediaSource, field.name))
+	}
+	raw, err := bson.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func decodeMediaCursor(value string, sort MediaSort, fields []sortField) ([]interface{}, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	cursor := new(mediaCursor)
+	if err := bson.Unmarshal(raw, cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	// a cursor of another sort order points at a different position
+	if cursor.Sort != sort || len(cursor.Values) != len(fields) {
+		return nil, ErrInvalidCursor
+	}
+	return cursor.Values, nil
+}
+
+func mediaSortValue(mediaSource *models.MediaSource, field string) interface{} {
+	switch field {
+	case "created_at":
+		return mediaSource.CreatedAt
+	case "updated_at":
+		return mediaSource.UpdatedAt
+	case "title":
+		return mediaSource.Title
+	case "series.title":
+		return mediaSource.Series.Title
+	case "series.season":
+		return mediaSource.Series.Season
+	case "series.episode":
+		return mediaSource.Series.Episode
+	}
+	return mediaSource.ID
+}
+
+// afterCursor matches the media sources that come after the sort values, so
+// pages stay stable while media sources are added or removed.
+func afterCursor(fields []sortField, values []interface{}) bson.M {
+	or := make([]interface{}, 0, len(fields))
+	for i, field := range fields {
+		condition := bson.M{}
+		for j := 0; j < i; j++ {
+			condition[fields[j].name] = values[j]
+		}
+		operator := "$gt"
+		if field.order < 0 {
+			operator = "$lt"
+		}
+		condition[field.name] = bson.M{operator: values[i]}
+		or = append(or, condition)
+	}
+	return bson.M{"$or": or}
+}
+
+// MediaFilter returns the filter of the media library of the user without the cursor.
+// The keyword is always matched literally, it is never used as a raw regex.
+func MediaFilter(userID *primitive.ObjectID, q MediaQuery) (bson.M, error) {
+
+	filter := bson.M{"user_id": userID}
+
+	if q.Type != proto.MediaSource_UNKNOWN {
+		filter["type"] = q.Type
+	}
+
+	switch {
+	case q.CollectionID != nil:
+		filter["collection_id"] = q.CollectionID
+	case q.Unfiled:
+		filter["collection_id"] = bson.M{"$exists": false}
+	}
+
+	if len(q.Tags) > 0 {
+		tags, err := NormalizeTags(q.Tags)
+		if err != nil {
+			return nil, err
+		}
+		filter["tags"] = bson.M{"$all": tags}
+	}
+
+	if q.Series != "" {
+		filter["series.title"] = q.Series
+		if q.Season > 0 {
+			filter["series.season"] = q.Season
+		}
+	} else if q.Sort == SortEpisode {
+		filter["series"] = bson.M{"$exists": true}
+	}
+
+	if keyword := strings.TrimSpace(q.Keyword); keyword != "" {
+		quoted := bson.M{"$regex": regexp.QuoteMeta(keyword), "$options": "i"}
+		filter["$or"] = []interface{}{
+			bson.M{"title": quoted},
+			bson.M{"artist": quoted},
+			bson.M{"series.title": quoted},
+			bson.M{"metadata.title": quoted},
+			bson.M{"tags": strings.ToLower(keyword)},
+		}
+	}
+
+	return filter, nil
+}
+
+// MediaSources lists a page of the media library of the user.
+func MediaSources(ctx context.Context, db *mongo.Database, userID *primitive.ObjectID, q MediaQuery) (*MediaPage, error) {
+
+	if q.Sort == "" {
+		q.Sort = SortNewest
+	}
+
+	fields, ok := mediaSorts[q.Sort]
+	if !ok {
+		return nil, ErrInvalidSort
+	}
+
+	if q.Limit <= 0 {
+		q.Limit = DefaultLimit
+	}
+
+	if q.Limit > MaxLimit {
+		q.Limit = MaxLimit
+	}
+
+	filter, err := MediaFilter(userID, q)
+	if err != nil {
+		return nil, err
+	}
+
+	if q.Cursor != "" {
+		values, err := decodeMediaCursor(q.Cursor, q.Sort, fields)
+		if err != nil {
+			return nil, err
+		}
+		filter = bson.M{"$and": []interface{}{filter, afterCursor(fields, values)}}
+	}
+
+	sort := make(bson.D, 0, len(fields))
+	for _, field := range fields {
+		sort = append(sort, bson.E{Key: field.name, Value: field.order})
+	}
+
+	// one more than the limit tells if there is a next page
+	opts := options.Find().SetSort(sort).SetLimit(q.Limit + 1)
+	if q.Sort == SortTitle || q.Sort == SortEpisode {
+		opts.SetCollation(titleCollation)
+	}
+
+	cursor, err := db.Collection("media_sources").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	page := &MediaPage{Results: make([]*models.MediaSource, 0)}
+	if err := cursor.All(ctx, &page.Results); err != nil {
+		return nil, err
+	}
+
+	if int64(len(page.Results)) > q.Limit {
+		page.Results = page.Results[:q.Limit]
+		if page.NextCursor, err = encodeMediaCursor(q.Sort, fields, page.Results[q.Limit-1]); err != nil {
+			return nil, err
+		}
+	}
+
+	return page, nil
+}
@@ -0,0 +1,423 @@
+package search
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/castyapp/grpc.server/helpers"
+	"github.com/castyapp/grpc.server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+var ErrInvalidCursor = errors.New("invalid search cursor")
+
+type Tier int
+
+const (
+	TierExactUsername Tier = iota
+	TierUsernamePrefix
+	TierFullname
+)
+
+type Query struct {
+	Keyword          string
+	Cursor           string
+	Limit            int64
+	FriendsOfFriends bool
+}
+
+type Result struct {
+	User   *models.User
+	Tier   Tier
+	Friend bool
+}
+
+type Page struct {
+	Results    []*Result
+	NextCursor string
+}
+
+// key is the position of a result in the ranking, it is also what cursors encode.
+type key struct {
+	tier     Tier
+	friend   bool
+	username string
+}
+
+func (k key) less(o key) bool {
+	if k.tier != o.tier {
+		return k.tier < o.tier
+	}
+	if k.friend != o.friend {
+		return k.friend
+	}
+	return k.username < o.username
+}
+
+func (r *Result) key() key {
+	return key{tier: r.Tier, friend: r.Friend, username: r.User.Username}
+}
+
+func encodeCursor(k key) string {
+	friend := "0"
+	if k.friend {
+		friend = "1"
+	}
+	raw := fmt.Sprintf("%d:%s:%s", k.tier, friend, k.username)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (k key, err error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return k, ErrInvalidCursor
+	}
+	parts := strings.SplitN(string(raw), ":", 3)
+	if len(parts) != 3 {
+		return k, ErrInvalidCursor
+	}
+	tier, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return k, ErrInvalidCursor
+	}
+	return key{tier: Tier(tier), friend: parts[1] == "1", username: parts[2]}, nil
+}
+
+// Classify returns the ranking tier of the user for the given keyword, the
+// second return value is false when the user does not match at all.
+func Classify(user *models.User, keyword string) (Tier, bool) {
+	var (
+		username = strings.ToLower(user.Username)
+		fullname = strings.ToLower(user.Fullname)
+	)
+	keyword = strings.ToLower(keyword)
+	switch {
+	case username == keyword:
+		return TierExactUsername, true
+	case strings.HasPrefix(username, keyword):
+		return TierUsernamePrefix, true
+	}
+	for _, word := range strings.Fields(fullname) {
+		if strings.HasPrefix(word, keyword) {
+			return TierFullname, true
+		}
+	}
+	if strings.HasPrefix(fullname, keyword) {
+		return TierFullname, true
+	}
+	return 0, false
+}
+
+// Rank classifies and sorts the candidates, exact username matches first, then
+// username prefix matches and then fullname matches. Friends go first in every tier.
+func Rank(candidates []*models.User, keyword string, friends map[string]bool) []*Result {
+	results := make([]*Result, 0, len(candidates))
+	for _, candidate := range candidates {
+		tier, ok := Classify(candidate, keyword)
+		if !ok {
+			continue
+		}
+		results = append(results, &Result{
+			User:   candidate,
+			Tier:   tier,
+			Friend: friends[candidate.ID.Hex()],
+		})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].key().less(results[j].key())
+	})
+	return results
+}
+
+func pageLimit(limit int64) int64 {
+	if limit <= 0 {
+		return DefaultLimit
+	}
+	if limit > MaxLimit {
+		return MaxLimit
+	}
+	return limit
+}
+
+// Paginate returns the page of ranked results that comes after the cursor.
+func Paginate(results []*Result, cursor string, limit int64) (*Page, error) {
+
+	limit = pageLimit(limit)
+
+	start := 0
+	if cursor != "" {
+		after, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		start = sort.Search(len(results), func(i int) bool {
+			return after.less(results[i].key())
+		})
+	}
+
+	end := start + int(limit)
+	if end > len(results) {
+		end = len(results)
+	}
+
+	page := &Page{Results: results[start:end]}
+	if end < len(results) && end > start {
+		page.NextCursor = encodeCursor(results[end-1].key())
+	}
+
+	return page, nil
+}
+
+// friendsOfFriendsIDs returns the accepted friends of the friends of the user with a single
+// query, the user and the direct friends of the user are not among them.
+func friendsOfFriendsIDs(ctx context.Context, db *mongo.Database, userID *primitive.ObjectID, friendIDs []*primitive.ObjectID) ([]*primitive.ObjectID, error) {
+
+	ids := make([]*primitive.ObjectID, 0)
+	if len(friendIDs) == 0 {
+		return ids, nil
+	}
+
+	excluded := map[string]bool{userID.Hex(): true}
+	for _, id := range friendIDs {
+		excluded[id.Hex()] = true
+	}
+
+	filter := bson.M{
+		"accepted": true,
+		"$or": []interface{}{
+			bson.M{"user_id": bson.M{"$in": friendIDs}},
+			bson.M{"friend_id": bson.M{"$in": friendIDs}},
+		},
+	}
+
+	cursor, err := db.Collection("friends").Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		friend := new(models.Friend)
+		if err := cursor.Decode(friend); err != nil {
+			continue
+		}
+		for _, id := range []*primitive.ObjectID{friend.UserID, friend.FriendID} {
+			if id != nil && !excluded[id.Hex()] {
+				excluded[id.Hex()] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	return ids, cursor.Err()
+}
+
+// tierFilter matches the users that Classify puts in the tier, usernames are stored
+// lowercase so the anchored regexes can use the username index.
+func tierFilter(keyword string, tier Tier) bson.M {
+
+	var (
+		quoted   = regexp.QuoteMeta(keyword)
+		username = bson.M{}
+		filter   = bson.M{"username": username}
+	)
+
+	switch tier {
+	case TierExactUsername:
+		username["$eq"] = keyword
+	case TierUsernamePrefix:
+		username["$regex"] = "^" + quoted
+		username["$ne"] = keyword
+	case TierFullname:
+		username["$not"] = primitive.Regex{Pattern: "^" + quoted}
+		// keywords with a space can only match the start of the fullname, others match any word of it
+		fullname := `(^|\s)` + quoted
+		if len(strings.Fields(keyword)) > 1 {
+			fullname = "^" + quoted
+		}
+		filter["fullname"] = bson.M{"$regex": fullname, "$options": "i"}
+	}
+
+	return filter
+}
+
+// fetchTier appends the users of the tier to the candidates in the order of their usernames,
+// starting after afterUsername when it is set, until there are want candidates or the tier
+// is exhausted. Users that Classify does not put in the tier are skipped and do not count.
+func fetchTier(ctx context.Context, db *mongo.Database, keyword string, tier Tier, ids bson.M, afterUsername *string, candidates []*models.User, want int64) ([]*models.User, error) {
+
+	for int64(len(candidates)) < want {
+
+		filter := tierFilter(keyword, tier)
+		filter["_id"] = ids
+		if afterUsername != nil {
+			filter["username"].(bson.M)["$gt"] = *afterUsername
+		}
+
+		remaining := want - int64(len(candidates))
+		opts := options.Find().SetLimit(remaining).SetSort(bson.M{"username": 1})
+		cursor, err := db.Collection("users").Find(ctx, filter, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		var fetched int64
+		for cursor.Next(ctx) {
+			fetched++
+			if username, ok := cursor.Current.Lookup("username").StringValueOK(); ok {
+				afterUsername = &username
+			}
+			candidate := new(models.User)
+			if err := cursor.Decode(candidate); err != nil {
+				continue
+			}
+			if t, ok := Classify(candidate, keyword); ok && t == tier {
+				candidates = append(candidates, candidate)
+			}
+		}
+		err = cursor.Err()
+		cursor.Close(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if fetched < remaining || afterUsername == nil {
+			break
+		}
+	}
+
+	return candidates, nil
+}
+
+// Users searches users by username and fullname for the given user.
+// The keyword is always matched literally, it is never used as a raw regex.
+// Every tier is queried for friends and then for the rest of the users in the order of
+// the ranking, starting from the cursor, until the page is full.
+func Users(ctx context.Context, db *mongo.Database, user *models.User, q Query) (*Page, error) {
+
+	keyword := strings.ToLower(strings.TrimSpace(q.Keyword))
+	if keyword == "" {
+		return &Page{Results: make([]*Result, 0)}, nil
+	}
+
+	var (
+		after     key
+		hasCursor = q.Cursor != ""
+		limit     = pageLimit(q.Limit)
+	)
+
+	if hasCursor {
+		var err error
+		if after, err = decodeCursor(q.Cursor); err != nil {
+			return nil, err
+		}
+	}
+
+	blockedIDs, err := helpers.GetBlockedUserIDs(ctx, db, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	friendIDs, err := helpers.GetFriendIDs(ctx, db, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	friends := make(map[string]bool, len(friendIDs))
+	for _, id := range friendIDs {
+		friends[id.Hex()] = true
+	}
+
+	strangersFilter := bson.M{
+		"$ne":  user.ID,
+		"$nin": append(append([]*primitive.ObjectID{}, blockedIDs...), friendIDs...),
+	}
+
+	if q.FriendsOfFriends {
+		fofIDs, err := friendsOfFriendsIDs(ctx, db, user.ID, friendIDs)
+		if err != nil {
+			return nil, err
+		}
+		strangersFilter["$in"] = fofIDs
+	}
+
+	candidates := make([]*models.User, 0)
+	for tier := TierExactUsername; tier <= TierFullname; tier++ {
+		for _, friend := range []bool{true, false} {
+
+			// friends of friends are the only users that are searched for them
+			if friend && (q.FriendsOfFriends || len(friendIDs) == 0) {
+				continue
+			}
+
+			bucket := key{tier: tier, friend: friend}
+			if hasCursor && bucket.less(key{tier: after.tier, friend: after.friend}) {
+				continue
+			}
+
+			ids := strangersFilter
+			if friend {
+				ids = bson.M{"$in": friendIDs, "$nin": blockedIDs}
+			}
+
+			var afterUsername *string
+			if hasCursor && tier == after.tier && friend == after.friend {
+				afterUsername = &after.username
+			}
+
+			// one more user than the page is fetched to know if there is a next page
+			candidates, err = fetchTier(ctx, db, keyword, tier, ids, afterUsername, candidates, limit+1)
+			if err != nil {
+				return nil, err
+			}
+
+			if int64(len(candidates)) > limit {
+				return Paginate(Rank(candidates, keyword, friends), q.Cursor, limit)
+			}
+		}
+	}
+
+	return Paginate(Rank(candidates, keyword, friends), q.Cursor, limit)
+}
+
+// CreateIndexes creates the indexes that user and media library search rely on, usernames
+// are searched with the unique index of helpers.CreateUsernameIndexes.
+func CreateIndexes(ctx context.Context, db *mongo.Database) error {
+
+	_, err := db.Collection("users").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "fullname", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Collection("media_sources").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "collection_id", Value: 1}}},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "tags", Value: 1}}},
+		{
+			Keys: bson.D{
+				{Key: "user_id", Value: 1},
+				{Key: "series.title", Value: 1},
+				{Key: "series.season", Value: 1},
+				{Key: "series.episode", Value: 1},
+			},
+			Options: options.Index().SetCollation(titleCollation),
+		},
+	})
+	return err
+}
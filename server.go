@@ -9,9 +9,13 @@ import (
 
 	"github.com/castyapp/grpc.server/config"
 	"github.com/castyapp/grpc.server/core"
+	"github.com/castyapp/grpc.server/helpers"
+	"github.com/castyapp/grpc.server/jobs"
 	"github.com/castyapp/grpc.server/jwt"
+	"github.com/castyapp/grpc.server/metadata"
 	"github.com/castyapp/grpc.server/oauth"
 	"github.com/castyapp/grpc.server/providers"
+	"github.com/castyapp/grpc.server/search"
 	"github.com/castyapp/grpc.server/services/auth"
 	"github.com/castyapp/grpc.server/services/message"
 	"github.com/castyapp/grpc.server/services/theater"
@@ -19,6 +23,7 @@ import (
 	"github.com/castyapp/grpc.server/storage"
 	"github.com/castyapp/libcasty-protocol-go/proto"
 	"github.com/getsentry/sentry-go"
+	"go.mongodb.org/mongo-driver/mongo"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
 )
@@ -59,6 +64,26 @@ func main() {
 		// config redis connection
 		&providers.RedisProvider{},
 
+		// create mongodb indexes that user and media library search and theater members rely on
+		&providers.LambdaProvider{
+			Registeration: func(ctx *core.Context) error {
+				db := ctx.MustGet("db.mongo").(*mongo.Database)
+				if err := search.CreateIndexes(ctx, db); err != nil {
+					return fmt.Errorf("could not create search indexes: %v", err)
+				}
+				if err := helpers.CreateMemberIndexes(ctx, db); err != nil {
+					return fmt.Errorf("could not create theater member indexes: %v", err)
+				}
+				if err := helpers.CreateUsernameIndexes(ctx, db); err != nil {
+					return fmt.Errorf("could not create username indexes: %v", err)
+				}
+				if err := helpers.CreateBlockIndexes(ctx, db); err != nil {
+					return fmt.Errorf("could not create block indexes: %v", err)
+				}
+				return nil
+			},
+		},
+
 		// configure jwt
 		&providers.LambdaProvider{
 			Registeration: func(ctx *core.Context) error {
@@ -81,16 +106,42 @@ func main() {
 			},
 		},
 
-		// configure s3 bucket (minio) storage
+		// configure the storage backend (minio, fs or memory)
 		&providers.LambdaProvider{
 			Registeration: func(ctx *core.Context) error {
 				cm := ctx.MustGet("config.map").(*config.Map)
 				if err := storage.Configure(cm); err != nil {
-					return fmt.Errorf("could not configure s3 bucket storage client: %v", err)
+					return fmt.Errorf("could not configure storage backend: %v", err)
 				}
 				return nil
 			},
 		},
+
+		// configure the movie and tv show metadata provider
+		&providers.LambdaProvider{
+			Registeration: func(ctx *core.Context) error {
+				var (
+					cm = ctx.MustGet("config.map").(*config.Map)
+					db = ctx.MustGet("db.mongo").(*mongo.Database)
+				)
+				if err := metadata.Configure(ctx, cm, db); err != nil {
+					return fmt.Errorf("could not configure metadata provider: %v", err)
+				}
+				return nil
+			},
+		},
+
+		// precompute friend suggestions into redis
+		&jobs.FriendSuggestions{},
+
+		// delete orphaned objects from the storage buckets
+		&jobs.StorageGC{},
+
+		// extract embedded subtitles and audio tracks of uploaded media
+		&jobs.TrackExtraction{},
+
+		// generate poster frames and seek previews of media sources
+		&jobs.Thumbnails{},
 	)
 
 	defer ctx.Close()
@@ -101,6 +152,8 @@ func main() {
 		log.Fatal(fmt.Errorf("could not create tcp listener: %v", err))
 	}
 
+	// the operations that the protocol has no messages for yet are not registered,
+	// they are listed in the README until the protocol is bumped
 	server := grpc.NewServer()
 	proto.RegisterAuthServiceServer(server, auth.NewService(ctx))
 	proto.RegisterUserServiceServer(server, user.NewService(ctx))
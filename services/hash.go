@@ -1,13 +1,14 @@
 package services
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
-	"net/http"
 	"time"
 
+	"github.com/castyapp/grpc.server/fetcher"
+	"github.com/castyapp/grpc.server/images"
 	"github.com/castyapp/grpc.server/storage"
-	"github.com/minio/minio-go"
 )
 
 func RandomString(length int) string {
@@ -21,16 +22,21 @@ func RandomString(length int) string {
 }
 
 func SaveAvatarFromURL(url string) (string, error) {
-	avatarName := RandomNumber(20)
-	resp, err := http.DefaultClient.Get(url)
+	return saveImageFromURL(storage.Buckets.Avatars, images.Avatar, url)
+}
+
+func SaveBannerFromURL(url string) (string, error) {
+	return saveImageFromURL(storage.Buckets.Banners, images.Banner, url)
+}
+
+func saveImageFromURL(bucket string, spec images.Spec, url string) (string, error) {
+	options := fetcher.Images
+	options.MaxBytes = spec.MaxBytes
+	resp, err := fetcher.New(options).Fetch(context.Background(), url)
 	if err != nil {
-		return avatarName, err
-	}
-	defer resp.Body.Close()
-	if _, err = storage.Client.PutObject("avatars", fmt.Sprintf("%s.png", avatarName), resp.Body, -1, minio.PutObjectOptions{}); err != nil {
 		return "", err
 	}
-	return avatarName, nil
+	return SaveImage(bucket, spec, resp.Data)
 }
 
 func RandomNumber(length int) string {
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/castyapp/grpc.server/images"
+	"github.com/castyapp/grpc.server/storage"
+)
+
+var sizeSuffixRegex = regexp.MustCompile(`^[0-9]+x[0-9]+$`)
+
+// ImageObjectName returns the object name of a stored image size, the first
+// size of the spec is stored without a size suffix so "<name>.png" keeps
+// pointing at the full size image.
+func ImageObjectName(name string, spec images.Spec, size images.Size) string {
+	if len(spec.Sizes) > 0 && spec.Sizes[0] == size {
+		return fmt.Sprintf("%s.%s", name, spec.Format.Extension())
+	}
+	return fmt.Sprintf("%s_%s.%s", name, size, spec.Format.Extension())
+}
+
+// ImageNameFromObject returns the name of the image that an object of
+// ImageObjectName belongs to.
+func ImageNameFromObject(objectName string) string {
+	name := strings.TrimSuffix(objectName, path.Ext(objectName))
+	if i := strings.LastIndex(name, "_"); i != -1 && sizeSuffixRegex.MatchString(name[i+1:]) {
+		name = name[:i]
+	}
+	return name
+}
+
+// SaveImage processes the image and stores every size of it in the bucket,
+// it returns the name that the image is stored with.
+func SaveImage(bucket string, spec images.Spec, data []byte) (string, error) {
+
+	variants, err := images.Process(data, spec)
+	if err != nil {
+		return "", err
+	}
+
+	name := RandomNumber(20)
+	for _, variant := range variants {
+		objectName := ImageObjectName(name, spec, variant.Size)
+		if err := storage.Client.Put(bucket, objectName, bytes.NewReader(variant.Data), int64(len(variant.Data)), spec.Format.ContentType()); err != nil {
+			RemoveImage(bucket, name, spec)
+			return "", err
+		}
+	}
+
+	return name, nil
+}
+
+// RemoveImage removes every size of a stored image from the bucket.
+func RemoveImage(bucket, name string, spec images.Spec) {
+	if name == "" || name == "default" {
+		return
+	}
+	for _, size := range spec.Sizes {
+		if err := storage.Client.Delete(bucket, ImageObjectName(name, spec, size)); err != nil {
+			log.Printf("could not remove image [%s/%s]: %v", bucket, name, err)
+		}
+	}
+}
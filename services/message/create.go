@@ -7,7 +7,6 @@ import (
 	"time"
 
 	"github.com/castyapp/grpc.server/helpers"
-	"github.com/castyapp/grpc.server/models"
 	"github.com/castyapp/grpc.server/services/auth"
 	"github.com/castyapp/libcasty-protocol-go/proto"
 	"github.com/castyapp/libcasty-protocol-go/protocol"
@@ -21,11 +20,9 @@ import (
 func (s *Service) CreateMessage(ctx context.Context, req *proto.MessageRequest) (*proto.MessageResponse, error) {
 
 	var (
-		db              = s.MustGet("db.mongo").(*mongo.Database)
-		receiver        = new(models.User)
-		collection      = db.Collection("messages")
-		usersCollection = db.Collection("users")
-		failedResponse  = status.Error(codes.Internal, "Could not create message, Please try again later!")
+		db             = s.MustGet("db.mongo").(*mongo.Database)
+		collection     = db.Collection("messages")
+		failedResponse = status.Error(codes.Internal, "Could not create message, Please try again later!")
 	)
 
 	user, err := auth.Authenticate(s.Context, req.AuthRequest)
@@ -37,10 +34,24 @@ func (s *Service) CreateMessage(ctx context.Context, req *proto.MessageRequest)
 		return nil, errors.New("receiver can not be you")
 	}
 
-	if err := usersCollection.FindOne(ctx, bson.M{"username": req.Message.Receiver.Id}).Decode(receiver); err != nil {
+	receiver, err := helpers.FindUserByUsername(ctx, db, req.Message.Receiver.Id)
+	if err != nil {
 		return nil, status.Error(codes.NotFound, "Could not find receiver!")
 	}
 
+	if receiver.ID.Hex() == user.ID.Hex() {
+		return nil, errors.New("receiver can not be you")
+	}
+
+	blocked, err := helpers.IsBlocked(ctx, db, user.ID, receiver.ID)
+	if err != nil {
+		return nil, failedResponse
+	}
+
+	if blocked {
+		return nil, status.Error(codes.PermissionDenied, "You can not send messages to this user!")
+	}
+
 	message := bson.M{
 		"content":     req.Message.Content,
 		"sender_id":   user.ID,
@@ -55,11 +66,12 @@ func (s *Service) CreateMessage(ctx context.Context, req *proto.MessageRequest)
 		return nil, failedResponse
 	}
 
+	relation := helpers.GetRelation(ctx, db, user.ID, receiver.ID)
 	nowTime := timestamppb.New(time.Now())
 	protoMessage := &proto.Message{
 		Content:   req.Message.Content,
-		Sender:    helpers.NewProtoUser(user),
-		Receiver:  helpers.NewProtoUser(receiver),
+		Sender:    helpers.NewProtoUser(user, relation),
+		Receiver:  helpers.NewProtoUser(receiver, relation),
 		Edited:    false,
 		Deleted:   false,
 		CreatedAt: nowTime,
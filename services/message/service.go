@@ -28,11 +28,9 @@ func NewService(ctx *core.Context) *Service {
 func (s *Service) GetUserMessages(ctx context.Context, req *proto.GetMessagesRequest) (*proto.GetMessagesResponse, error) {
 
 	var (
-		db              = s.MustGet("db.mongo").(*mongo.Database)
-		receiver        = new(models.User)
-		collection      = db.Collection("messages")
-		usersCollection = db.Collection("users")
-		failedResponse  = status.Error(codes.Internal, "Could not get messages, Please try again later!")
+		db             = s.MustGet("db.mongo").(*mongo.Database)
+		collection     = db.Collection("messages")
+		failedResponse = status.Error(codes.Internal, "Could not get messages, Please try again later!")
 	)
 
 	u, err := auth.Authenticate(s.Context, req.AuthRequest)
@@ -44,7 +42,8 @@ func (s *Service) GetUserMessages(ctx context.Context, req *proto.GetMessagesReq
 		return nil, errors.New("receiver can not be you")
 	}
 
-	if err := usersCollection.FindOne(ctx, bson.M{"username": req.ReceiverId}).Decode(receiver); err != nil {
+	receiver, err := helpers.FindUserByUsername(ctx, db, req.ReceiverId)
+	if err != nil {
 		return nil, status.Error(codes.NotFound, "Could not find receiver!")
 	}
 
@@ -66,13 +65,19 @@ func (s *Service) GetUserMessages(ctx context.Context, req *proto.GetMessagesReq
 		return nil, failedResponse
 	}
 
+	receiverRelation := helpers.GetRelation(ctx, db, u.ID, receiver.ID)
+
 	var protoMessages []*proto.Message
 	for cursor.Next(ctx) {
 		var message = new(models.Message)
 		if err := cursor.Decode(message); err != nil {
 			continue
 		}
-		protoMessage, err := helpers.NewProtoMessage(ctx, db, message)
+		relation := receiverRelation
+		if message.SenderID.Hex() == u.ID.Hex() {
+			relation = models.RelationSelf
+		}
+		protoMessage, err := helpers.NewProtoMessage(ctx, db, message, relation)
 		if err != nil {
 			continue
 		}
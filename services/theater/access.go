@@ -0,0 +1,279 @@
+package theater
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/castyapp/grpc.server/helpers"
+	"github.com/castyapp/grpc.server/models"
+	"github.com/castyapp/grpc.server/services/auth"
+	"github.com/castyapp/libcasty-protocol-go/proto"
+	"github.com/castyapp/libcasty-protocol-go/protocol"
+	"github.com/golang/protobuf/ptypes/any"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MaxVideoPlayerUsers is how many users can be chosen to control the video player of a theater.
+const MaxVideoPlayerUsers = 100
+
+var errNoVideoPlayerAccess = status.Error(codes.PermissionDenied, "You don't have access to the video player of this theater!")
+
+type VideoPlayerAccessRequest struct {
+	AuthRequest *proto.AuthenticateRequest
+	Access      proto.VIDEO_PLAYER_ACCESS
+	// UserIds are the users that control the video player with ACCESS_BY_CHOOSEN_FRIENDS,
+	// they replace the users that were chosen before
+	UserIds []string
+}
+
+type VideoPlayerAccessResponse struct {
+	Status  string
+	Code    int64
+	Access  proto.VIDEO_PLAYER_ACCESS
+	UserIds []string
+}
+
+type SelectMediaSourceRequest struct {
+	AuthRequest   *proto.AuthenticateRequest
+	TheaterId     string
+	MediaSourceId string
+}
+
+// checkVideoPlayerAccess returns a PermissionDenied error when the user can't control the
+// video player of the theater.
+func checkVideoPlayerAccess(ctx context.Context, db *mongo.Database, theater *models.Theater, user *models.User) error {
+	allowed, err := helpers.CanControlVideoPlayer(ctx, db, theater, user)
+	if err != nil {
+		log.Println(err)
+		return status.Error(codes.Internal, "Could not check the access to the video player, Please try again later!")
+	}
+	if !allowed {
+		return errNoVideoPlayerAccess
+	}
+	return nil
+}
+
+// findControlledMediaSource finds a media source that the user owns, or that is selected in a
+// theater where the user has access to the video player, like when they change its subtitles.
+func findControlledMediaSource(ctx context.Context, db *mongo.Database, user *models.User, mediaSourceID string) (*models.MediaSource, error) {
+
+	mediaSourceObjectID, err := primitive.ObjectIDFromHex(mediaSourceID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "Could not parse media source id!")
+	}
+
+	mediaSource := new(models.MediaSource)
+	if err := db.Collection("media_sources").FindOne(ctx, bson.M{"_id": mediaSourceObjectID}).Decode(mediaSource); err != nil {
+		return nil, status.Error(codes.NotFound, "Could not find media source!")
+	}
+
+	if mediaSource.UserID.Hex() == user.ID.Hex() {
+		return mediaSource, nil
+	}
+
+	cursor, err := db.Collection("theaters").Find(ctx, bson.M{"media_source_id": mediaSource.ID})
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Could not find media source, Please try again later!")
+	}
+	defer cursor.Close(ctx)
+
+	found := false
+	for cursor.Next(ctx) {
+		theater := new(models.Theater)
+		if err := cursor.Decode(theater); err != nil {
+			continue
+		}
+		if theater.Privacy == proto.PRIVACY_PRIVATE {
+			continue
+		}
+		if blocked, err := helpers.IsBlocked(ctx, db, user.ID, theater.UserID); err != nil || blocked {
+			continue
+		}
+		found = true
+		if allowed, err := helpers.CanControlVideoPlayer(ctx, db, theater, user); err == nil && allowed {
+			return mediaSource, nil
+		}
+	}
+
+	// the media source is only known to exist when it's playing in a theater the user can see
+	if found {
+		return nil, errNoVideoPlayerAccess
+	}
+
+	return nil, status.Error(codes.NotFound, "Could not find media source!")
+}
+
+// UpdateVideoPlayerAccess changes who controls the video player of the theater of the user,
+// the chosen users are only used with ACCESS_BY_CHOOSEN_FRIENDS
+func (s *Service) UpdateVideoPlayerAccess(ctx context.Context, req *VideoPlayerAccessRequest) (*VideoPlayerAccessResponse, error) {
+
+	dbConn, err := s.Get("db.mongo")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		db             = dbConn.(*mongo.Database)
+		theater        = new(models.Theater)
+		failedResponse = status.Error(codes.Internal, "Could not update theater, Please try again later!")
+	)
+
+	user, err := auth.Authenticate(s.Context, req.AuthRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := proto.VIDEO_PLAYER_ACCESS_name[int32(req.Access)]; !ok || req.Access == proto.VIDEO_PLAYER_ACCESS_ACCESS_UNKNOWN {
+		return nil, status.ErrorProto(&spb.Status{
+			Code:    int32(codes.InvalidArgument),
+			Message: "Validation Error!",
+			Details: []*any.Any{{TypeUrl: "access", Value: []byte("Video player access is invalid!")}},
+		})
+	}
+
+	if len(req.UserIds) > MaxVideoPlayerUsers {
+		return nil, status.Errorf(codes.InvalidArgument, "Only %d users can be chosen!", MaxVideoPlayerUsers)
+	}
+
+	userIDs := make([]*primitive.ObjectID, 0, len(req.UserIds))
+	seen := make(map[primitive.ObjectID]bool, len(req.UserIds))
+	for _, hexID := range req.UserIds {
+		userID, err := primitive.ObjectIDFromHex(hexID)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "Could not parse user id!")
+		}
+		// the owner always has access
+		if seen[userID] || userID == *user.ID {
+			continue
+		}
+		seen[userID] = true
+		userIDs = append(userIDs, &userID)
+	}
+
+	if len(userIDs) > 0 {
+		count, err := db.Collection("users").CountDocuments(ctx, bson.M{"_id": bson.M{"$in": userIDs}})
+		if err != nil {
+			return nil, failedResponse
+		}
+		if count != int64(len(userIDs)) {
+			return nil, status.Error(codes.NotFound, "Could not find the users!")
+		}
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"video_player_access":   req.Access,
+			"video_player_user_ids": userIDs,
+			"updated_at":            time.Now(),
+		},
+	}
+
+	if err := db.Collection("theaters").FindOneAndUpdate(ctx, bson.M{"user_id": user.ID}, update).Decode(theater); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, status.Error(codes.NotFound, "Could not find theater!")
+		}
+		return nil, failedResponse
+	}
+
+	event, err := protocol.NewMsgProtobuf(proto.EMSG_THEATER_UPDATED, &proto.Theater{
+		Id:                theater.ID.Hex(),
+		VideoPlayerAccess: req.Access,
+	})
+	if err == nil {
+		if err := helpers.SendEventToTheaterMembers(s.Context, event.Bytes(), theater); err != nil {
+			log.Println(err)
+		}
+	}
+
+	hexIDs := make([]string, 0, len(userIDs))
+	for _, userID := range userIDs {
+		hexIDs = append(hexIDs, userID.Hex())
+	}
+
+	return &VideoPlayerAccessResponse{
+		Status:  "success",
+		Code:    http.StatusOK,
+		Access:  req.Access,
+		UserIds: hexIDs,
+	}, nil
+}
+
+// SelectTheaterMediaSource selects the media of a theater for a member with access to its video
+// player, they can select media of their own library or of the library of the owner
+func (s *Service) SelectTheaterMediaSource(ctx context.Context, req *SelectMediaSourceRequest) (*proto.TheaterMediaSourcesResponse, error) {
+
+	dbConn, err := s.Get("db.mongo")
+	if err != nil {
+		return nil, err
+	}
+
+	db := dbConn.(*mongo.Database)
+
+	user, err := auth.Authenticate(s.Context, req.AuthRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	theater, err := findVisibleTheater(ctx, db, user, req.TheaterId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkVideoPlayerAccess(ctx, db, theater, user); err != nil {
+		return nil, err
+	}
+
+	return s.selectMediaSource(ctx, db, user, theater, req.MediaSourceId)
+}
+
+func (s *Service) selectMediaSource(ctx context.Context, db *mongo.Database, user *models.User, theater *models.Theater, mediaSourceID string) (*proto.TheaterMediaSourcesResponse, error) {
+
+	mediaSourceObjectID, err := primitive.ObjectIDFromHex(mediaSourceID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "Could not parse media source id!")
+	}
+
+	var (
+		mediaSource = new(models.MediaSource)
+		filter      = bson.M{
+			"_id":     mediaSourceObjectID,
+			"user_id": bson.M{"$in": []*primitive.ObjectID{user.ID, theater.UserID}},
+		}
+	)
+
+	if err := db.Collection("media_sources").FindOne(ctx, filter).Decode(mediaSource); err != nil {
+		return nil, status.Error(codes.NotFound, "Could not find media source!")
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"media_source_id": mediaSource.ID,
+		},
+	}
+
+	if _, err := db.Collection("theaters").UpdateOne(ctx, bson.M{"_id": theater.ID}, update); err != nil {
+		return nil, status.Error(codes.Internal, "Could not select media source, Please try again later!")
+	}
+
+	mediaSourceProto := helpers.NewMediaSourceProto(mediaSource)
+	event, err := protocol.NewMsgProtobuf(proto.EMSG_THEATER_MEDIA_SOURCE_CHANGED, mediaSourceProto)
+	if err == nil {
+		if err := helpers.SendEventToTheaterMembers(s.Context, event.Bytes(), theater); err != nil {
+			log.Println(err)
+		}
+	}
+
+	return &proto.TheaterMediaSourcesResponse{
+		Status:  "success",
+		Code:    http.StatusOK,
+		Message: "Media source selected successfully!",
+		Result:  []*proto.MediaSource{mediaSourceProto},
+	}, nil
+}
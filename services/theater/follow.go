@@ -49,7 +49,7 @@ func (s *Service) GetFollowedTheaters(ctx context.Context, req *proto.Authentica
 		if err != nil {
 			continue
 		}
-		protoTheater, err := helpers.NewTheaterProto(ctx, db, theater)
+		protoTheater, err := helpers.NewTheaterProto(ctx, db, user.ID, theater)
 		if err != nil {
 			continue
 		}
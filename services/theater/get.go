@@ -24,13 +24,12 @@ func (s *Service) GetTheater(ctx context.Context, req *proto.GetTheaterRequest)
 	}
 
 	var (
-		db              = dbConn.(*mongo.Database)
-		authenticated   = false
-		authUser        = new(models.User)
-		dbTheater       = new(models.Theater)
-		usersCollection = db.Collection("users")
-		collection      = db.Collection("theaters")
-		failedResponse  = status.Error(codes.Internal, "Could not get theater, Please try again later!")
+		db             = dbConn.(*mongo.Database)
+		authenticated  = false
+		authUser       = new(models.User)
+		dbTheater      = new(models.Theater)
+		collection     = db.Collection("theaters")
+		failedResponse = status.Error(codes.Internal, "Could not get theater, Please try again later!")
 	)
 
 	if req.AuthRequest != nil {
@@ -50,8 +49,8 @@ func (s *Service) GetTheater(ctx context.Context, req *proto.GetTheaterRequest)
 			return nil, status.Error(codes.NotFound, "Could not find theater!")
 		}
 	} else if req.User != "" {
-		user := new(models.User)
-		if err := usersCollection.FindOne(ctx, bson.M{"username": req.User}).Decode(user); err != nil {
+		user, err := helpers.FindUserByUsername(ctx, db, req.User)
+		if err != nil {
 			return nil, status.Error(codes.NotFound, "Could not find the user!")
 		}
 		if err := collection.FindOne(ctx, bson.M{"user_id": user.ID}).Decode(dbTheater); err != nil {
@@ -74,10 +73,17 @@ func (s *Service) GetTheater(ctx context.Context, req *proto.GetTheaterRequest)
 			case proto.PRIVACY_PRIVATE:
 				return nil, status.Error(codes.PermissionDenied, "Permission Denied!")
 			}
+			blocked, err := helpers.IsBlocked(ctx, db, authUser.ID, dbTheater.UserID)
+			if err != nil {
+				return nil, failedResponse
+			}
+			if blocked {
+				return nil, status.Error(codes.NotFound, "Could not find theater!")
+			}
 		}
 	}
 
-	theater, err := helpers.NewTheaterProto(ctx, db, dbTheater)
+	theater, err := helpers.NewTheaterProto(ctx, db, authUser.ID, dbTheater)
 	if err != nil {
 		log.Println(err)
 		return nil, failedResponse
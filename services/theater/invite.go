@@ -62,6 +62,9 @@ func (s *Service) Invite(ctx context.Context, req *proto.InviteFriendsTheaterReq
 		if err != nil {
 			continue
 		}
+		if blocked, err := helpers.IsBlocked(ctx, db, user.ID, &friendObjectID); err != nil || blocked {
+			continue
+		}
 		fids = append(fids, friendObjectID)
 	}
 
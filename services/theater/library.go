@@ -0,0 +1,714 @@
+package theater
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/castyapp/grpc.server/config"
+	"github.com/castyapp/grpc.server/helpers"
+	"github.com/castyapp/grpc.server/metadata"
+	"github.com/castyapp/grpc.server/models"
+	"github.com/castyapp/grpc.server/search"
+	"github.com/castyapp/grpc.server/services/auth"
+	"github.com/castyapp/libcasty-protocol-go/proto"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// maxBulkMediaSources bounds the media sources of a bulk operation
+	maxBulkMediaSources = 100
+	// maxCollectionDepth bounds how deep collections can be nested
+	maxCollectionDepth      = 10
+	maxCollectionNameLength = 100
+	maxSeriesTitleLength    = 200
+)
+
+type SearchMediaLibraryRequest struct {
+	AuthRequest *proto.AuthenticateRequest
+	Keyword     string
+	// Type lists the media of a type, every type is listed when it's unknown
+	Type         proto.MediaSource_Type
+	CollectionId string
+	// Unfiled lists the media that is not in any collection
+	Unfiled bool
+	// Tags lists the media that has all of the tags
+	Tags   []string
+	Series string
+	Season int
+	// Sort can be newest, oldest, title, updated or episode
+	Sort   string
+	Cursor string
+	Limit  int64
+}
+
+type MediaLibraryItem struct {
+	Media        *proto.MediaSource
+	CollectionId string
+	Tags         []string
+	Series       *models.MediaEpisode
+}
+
+type MediaLibraryResponse struct {
+	Status     string
+	Code       int64
+	Result     []*MediaLibraryItem
+	NextCursor string
+}
+
+type MediaCollectionRequest struct {
+	AuthRequest  *proto.AuthenticateRequest
+	CollectionId string
+	Name         string
+	// ParentId nests the collection in another collection, it's at the root of the library when empty
+	ParentId string
+}
+
+type MediaCollectionsResponse struct {
+	Status string
+	Code   int64
+	Result []*models.MediaCollection
+}
+
+type BulkMediaSourcesRequest struct {
+	AuthRequest    *proto.AuthenticateRequest
+	MediaSourceIds []string
+	// CollectionId is where the media sources are moved to, they are unfiled when it's empty
+	CollectionId string
+	AddTags      []string
+	RemoveTags   []string
+	// Series groups the media sources into a season of a series, they are ungrouped when it's empty
+	Series string
+	Season int
+}
+
+type BulkMediaSourcesResponse struct {
+	Status  string
+	Code    int64
+	Message string
+	// Affected is the number of media sources that were changed
+	Affected int64
+}
+
+func newMediaLibraryItem(mediaSource *models.MediaSource) *MediaLibraryItem {
+	item := &MediaLibraryItem{
+		Media:  helpers.NewMediaSourceProto(mediaSource),
+		Tags:   mediaSource.Tags,
+		Series: mediaSource.Series,
+	}
+	if mediaSource.CollectionID != nil {
+		item.CollectionId = mediaSource.CollectionID.Hex()
+	}
+	return item
+}
+
+// findOwnCollection finds a collection of the user, it returns nil when the id is empty.
+func findOwnCollection(ctx context.Context, db *mongo.Database, user *models.User, collectionID string) (*models.MediaCollection, error) {
+	if collectionID == "" {
+		return nil, nil
+	}
+	collectionObjectID, err := primitive.ObjectIDFromHex(collectionID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "Could not parse collection id!")
+	}
+	collection := new(models.MediaCollection)
+	filter := bson.M{"_id": collectionObjectID, "user_id": user.ID}
+	if err := db.Collection("media_collections").FindOne(ctx, filter).Decode(collection); err != nil {
+		return nil, status.Error(codes.NotFound, "Could not find collection!")
+	}
+	return collection, nil
+}
+
+// parseMediaSourceIDs parses the ids of a bulk operation.
+func parseMediaSourceIDs(ids []string) ([]primitive.ObjectID, error) {
+	if len(ids) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Media sources are required!")
+	}
+	if len(ids) > maxBulkMediaSources {
+		return nil, status.Errorf(codes.InvalidArgument, "At most %d media sources can be changed at once!", maxBulkMediaSources)
+	}
+	objectIDs := make([]primitive.ObjectID, 0, len(ids))
+	for _, id := range ids {
+		objectID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "Could not parse media source id!")
+		}
+		objectIDs = append(objectIDs, objectID)
+	}
+	return objectIDs, nil
+}
+
+func bulkResponse(message string, affected int64) *BulkMediaSourcesResponse {
+	return &BulkMediaSourcesResponse{
+		Status:   "success",
+		Code:     http.StatusOK,
+		Message:  message,
+		Affected: affected,
+	}
+}
+
+// SearchMediaLibrary lists a page of the media library of the user, filtered and sorted
+func (s *Service) SearchMediaLibrary(ctx context.Context, req *SearchMediaLibraryRequest) (*MediaLibraryResponse, error) {
+
+	dbConn, err := s.Get("db.mongo")
+	if err != nil {
+		return nil, err
+	}
+
+	db := dbConn.(*mongo.Database)
+
+	user, err := auth.Authenticate(s.Context, req.AuthRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	query := search.MediaQuery{
+		Keyword: req.Keyword,
+		Type:    req.Type,
+		Unfiled: req.Unfiled,
+		Tags:    req.Tags,
+		Series:  req.Series,
+		Season:  req.Season,
+		Sort:    search.MediaSort(req.Sort),
+		Cursor:  req.Cursor,
+		Limit:   req.Limit,
+	}
+
+	if req.CollectionId != "" {
+		collection, err := findOwnCollection(ctx, db, user, req.CollectionId)
+		if err != nil {
+			return nil, err
+		}
+		query.CollectionID = collection.ID
+	}
+
+	page, err := search.MediaSources(ctx, db, user.ID, query)
+	switch err {
+	case nil:
+	case search.ErrInvalidCursor:
+		return nil, status.Error(codes.InvalidArgument, "Search cursor is invalid!")
+	case search.ErrInvalidSort:
+		return nil, status.Error(codes.InvalidArgument, "Sort can be newest, oldest, title, updated or episode!")
+	case search.ErrInvalidTag:
+		return nil, status.Error(codes.InvalidArgument, "Tags can only have letters, digits, spaces, dashes and underscores!")
+	default:
+		log.Println(err)
+		return nil, status.Error(codes.Internal, "Could not search media sources, Please try again later!")
+	}
+
+	items := make([]*MediaLibraryItem, 0, len(page.Results))
+	for _, mediaSource := range page.Results {
+		items = append(items, newMediaLibraryItem(mediaSource))
+	}
+
+	return &MediaLibraryResponse{
+		Status:     "success",
+		Code:       http.StatusOK,
+		Result:     items,
+		NextCursor: page.NextCursor,
+	}, nil
+}
+
+// GetMediaCollections returns every collection of the user's media library
+func (s *Service) GetMediaCollections(ctx context.Context, req *proto.AuthenticateRequest) (*MediaCollectionsResponse, error) {
+
+	dbConn, err := s.Get("db.mongo")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		db          = dbConn.(*mongo.Database)
+		collections = make([]*models.MediaCollection, 0)
+	)
+
+	user, err := auth.Authenticate(s.Context, req)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.Find().SetSort(bson.M{"name": 1}).SetCollation(&options.Collation{Locale: "en", Strength: 2})
+	cursor, err := db.Collection("media_collections").Find(ctx, bson.M{"user_id": user.ID}, opts)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Could not get collections, Please try again later!")
+	}
+
+	if err := cursor.All(ctx, &collections); err != nil {
+		return nil, status.Error(codes.Internal, "Could not get collections, Please try again later!")
+	}
+
+	return &MediaCollectionsResponse{
+		Status: "success",
+		Code:   http.StatusOK,
+		Result: collections,
+	}, nil
+}
+
+func validateCollectionName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", status.Error(codes.InvalidArgument, "Collection name is required!")
+	}
+	if len([]rune(name)) > maxCollectionNameLength {
+		return "", status.Errorf(codes.InvalidArgument, "Collection name can not be longer than %d characters!", maxCollectionNameLength)
+	}
+	return name, nil
+}
+
+// checkCollectionParent checks that the collection can be nested in the parent, a collection
+// can not be moved into itself or one of its own children.
+func checkCollectionParent(ctx context.Context, db *mongo.Database, collectionID *primitive.ObjectID, parent *models.MediaCollection) error {
+	depth := 1
+	for current := parent; current != nil; depth++ {
+		if collectionID != nil && current.ID.Hex() == collectionID.Hex() {
+			return status.Error(codes.InvalidArgument, "A collection can not be moved into itself!")
+		}
+		if depth >= maxCollectionDepth {
+			return status.Errorf(codes.InvalidArgument, "Collections can not be nested deeper than %d levels!", maxCollectionDepth)
+		}
+		if current.ParentID == nil {
+			break
+		}
+		next := new(models.MediaCollection)
+		if err := db.Collection("media_collections").FindOne(ctx, bson.M{"_id": current.ParentID}).Decode(next); err != nil {
+			break
+		}
+		current = next
+	}
+	return nil
+}
+
+// CreateMediaCollection creates a collection in the media library of the user
+func (s *Service) CreateMediaCollection(ctx context.Context, req *MediaCollectionRequest) (*MediaCollectionsResponse, error) {
+
+	dbConn, err := s.Get("db.mongo")
+	if err != nil {
+		return nil, err
+	}
+
+	db := dbConn.(*mongo.Database)
+
+	user, err := auth.Authenticate(s.Context, req.AuthRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := validateCollectionName(req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	parent, err := findOwnCollection(ctx, db, user, req.ParentId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkCollectionParent(ctx, db, nil, parent); err != nil {
+		return nil, err
+	}
+
+	var (
+		now        = time.Now()
+		id         = primitive.NewObjectID()
+		collection = &models.MediaCollection{
+			ID:        &id,
+			UserID:    user.ID,
+			Name:      name,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+	)
+
+	if parent != nil {
+		collection.ParentID = parent.ID
+	}
+
+	if _, err := db.Collection("media_collections").InsertOne(ctx, collection); err != nil {
+		return nil, status.Error(codes.Internal, "Could not create collection, Please try again later!")
+	}
+
+	return &MediaCollectionsResponse{
+		Status: "success",
+		Code:   http.StatusOK,
+		Result: []*models.MediaCollection{collection},
+	}, nil
+}
+
+// UpdateMediaCollection renames a collection and moves it into another collection
+func (s *Service) UpdateMediaCollection(ctx context.Context, req *MediaCollectionRequest) (*MediaCollectionsResponse, error) {
+
+	dbConn, err := s.Get("db.mongo")
+	if err != nil {
+		return nil, err
+	}
+
+	db := dbConn.(*mongo.Database)
+
+	user, err := auth.Authenticate(s.Context, req.AuthRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	collection, err := findOwnCollection(ctx, db, user, req.CollectionId)
+	if err != nil {
+		return nil, err
+	}
+
+	if collection == nil {
+		return nil, status.Error(codes.InvalidArgument, "Collection is required!")
+	}
+
+	name, err := validateCollectionName(req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	parent, err := findOwnCollection(ctx, db, user, req.ParentId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkCollectionParent(ctx, db, collection.ID, parent); err != nil {
+		return nil, err
+	}
+
+	collection.Name = name
+	collection.ParentID = nil
+	collection.UpdatedAt = time.Now()
+
+	update := bson.M{
+		"$set": bson.M{"name": name, "updated_at": collection.UpdatedAt},
+	}
+
+	if parent != nil {
+		collection.ParentID = parent.ID
+		update["$set"].(bson.M)["parent_id"] = parent.ID
+	} else {
+		update["$unset"] = bson.M{"parent_id": ""}
+	}
+
+	if _, err := db.Collection("media_collections").UpdateOne(ctx, bson.M{"_id": collection.ID}, update); err != nil {
+		return nil, status.Error(codes.Internal, "Could not update collection, Please try again later!")
+	}
+
+	return &MediaCollectionsResponse{
+		Status: "success",
+		Code:   http.StatusOK,
+		Result: []*models.MediaCollection{collection},
+	}, nil
+}
+
+// RemoveMediaCollection removes a collection, its media sources and collections are moved to its parent
+func (s *Service) RemoveMediaCollection(ctx context.Context, req *MediaCollectionRequest) (*proto.Response, error) {
+
+	dbConn, err := s.Get("db.mongo")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		db             = dbConn.(*mongo.Database)
+		failedResponse = status.Error(codes.Internal, "Could not remove collection, Please try again later!")
+	)
+
+	user, err := auth.Authenticate(s.Context, req.AuthRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	collection, err := findOwnCollection(ctx, db, user, req.CollectionId)
+	if err != nil {
+		return nil, err
+	}
+
+	if collection == nil {
+		return nil, status.Error(codes.InvalidArgument, "Collection is required!")
+	}
+
+	moves := []struct {
+		collection string
+		field      string
+	}{
+		{"media_sources", "collection_id"},
+		{"media_collections", "parent_id"},
+	}
+
+	for _, move := range moves {
+		update := bson.M{"$unset": bson.M{move.field: ""}}
+		if collection.ParentID != nil {
+			update = bson.M{"$set": bson.M{move.field: collection.ParentID}}
+		}
+		filter := bson.M{"user_id": user.ID, move.field: collection.ID}
+		if _, err := db.Collection(move.collection).UpdateMany(ctx, filter, update); err != nil {
+			return nil, failedResponse
+		}
+	}
+
+	if _, err := db.Collection("media_collections").DeleteOne(ctx, bson.M{"_id": collection.ID}); err != nil {
+		return nil, failedResponse
+	}
+
+	return &proto.Response{
+		Status:  "success",
+		Code:    http.StatusOK,
+		Message: "Collection removed successfully!",
+	}, nil
+}
+
+// MoveMediaSources moves many media sources into a collection at once
+func (s *Service) MoveMediaSources(ctx context.Context, req *BulkMediaSourcesRequest) (*BulkMediaSourcesResponse, error) {
+
+	dbConn, err := s.Get("db.mongo")
+	if err != nil {
+		return nil, err
+	}
+
+	db := dbConn.(*mongo.Database)
+
+	user, err := auth.Authenticate(s.Context, req.AuthRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := parseMediaSourceIDs(req.MediaSourceIds)
+	if err != nil {
+		return nil, err
+	}
+
+	collection, err := findOwnCollection(ctx, db, user, req.CollectionId)
+	if err != nil {
+		return nil, err
+	}
+
+	update := bson.M{
+		"$set":   bson.M{"updated_at": time.Now()},
+		"$unset": bson.M{"collection_id": ""},
+	}
+
+	if collection != nil {
+		update = bson.M{"$set": bson.M{"collection_id": collection.ID, "updated_at": time.Now()}}
+	}
+
+	result, err := db.Collection("media_sources").UpdateMany(ctx, bson.M{"_id": bson.M{"$in": ids}, "user_id": user.ID}, update)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Could not move media sources, Please try again later!")
+	}
+
+	return bulkResponse("Media sources moved successfully!", result.ModifiedCount), nil
+}
+
+// TagMediaSources adds and removes tags of many media sources at once
+func (s *Service) TagMediaSources(ctx context.Context, req *BulkMediaSourcesRequest) (*BulkMediaSourcesResponse, error) {
+
+	dbConn, err := s.Get("db.mongo")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		db             = dbConn.(*mongo.Database)
+		failedResponse = status.Error(codes.Internal, "Could not tag media sources, Please try again later!")
+	)
+
+	user, err := auth.Authenticate(s.Context, req.AuthRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := parseMediaSourceIDs(req.MediaSourceIds)
+	if err != nil {
+		return nil, err
+	}
+
+	addTags, err := search.NormalizeTags(req.AddTags)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "Tags can only have letters, digits, spaces, dashes and underscores!")
+	}
+
+	removeTags, err := search.NormalizeTags(req.RemoveTags)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "Tags can only have letters, digits, spaces, dashes and underscores!")
+	}
+
+	if len(addTags) > search.MaxTags {
+		return nil, status.Errorf(codes.InvalidArgument, "A media source can not have more than %d tags!", search.MaxTags)
+	}
+
+	var (
+		affected   int64
+		filter     = bson.M{"_id": bson.M{"$in": ids}, "user_id": user.ID}
+		collection = db.Collection("media_sources")
+		now        = time.Now()
+		tags       = bson.M{"$ifNull": bson.A{"$tags", bson.A{}}}
+	)
+
+	if len(addTags) > 0 {
+
+		// the tags that every media source would have after the update, none of them can have too many
+		resulting := bson.M{"$setUnion": bson.A{bson.M{"$setDifference": bson.A{tags, removeTags}}, addTags}}
+		tooMany, err := collection.CountDocuments(ctx, bson.M{
+			"_id":     filter["_id"],
+			"user_id": user.ID,
+			"$expr":   bson.M{"$gt": bson.A{bson.M{"$size": resulting}, search.MaxTags}},
+		})
+		if err != nil {
+			return nil, failedResponse
+		}
+
+		if tooMany > 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "A media source can not have more than %d tags!", search.MaxTags)
+		}
+	}
+
+	// a field can not be pulled from and added to in the same update
+	if len(removeTags) > 0 {
+		update := bson.M{"$pull": bson.M{"tags": bson.M{"$in": removeTags}}, "$set": bson.M{"updated_at": now}}
+		result, err := collection.UpdateMany(ctx, filter, update)
+		if err != nil {
+			return nil, failedResponse
+		}
+		affected = result.ModifiedCount
+	}
+
+	if len(addTags) > 0 {
+		var (
+			// tags that were added in the meantime can not make a media source go over the limit
+			addFilter = bson.M{
+				"_id":     filter["_id"],
+				"user_id": user.ID,
+				"$expr":   bson.M{"$lte": bson.A{bson.M{"$size": bson.M{"$setUnion": bson.A{tags, addTags}}}, search.MaxTags}},
+			}
+			update = bson.M{"$addToSet": bson.M{"tags": bson.M{"$each": addTags}}, "$set": bson.M{"updated_at": now}}
+		)
+		result, err := collection.UpdateMany(ctx, addFilter, update)
+		if err != nil {
+			return nil, failedResponse
+		}
+		if result.ModifiedCount > affected {
+			affected = result.ModifiedCount
+		}
+	}
+
+	return bulkResponse("Media sources tagged successfully!", affected), nil
+}
+
+// GroupMediaSources puts many media sources into a season of a series at once, their episode numbers
+// are kept or guessed from their titles
+func (s *Service) GroupMediaSources(ctx context.Context, req *BulkMediaSourcesRequest) (*BulkMediaSourcesResponse, error) {
+
+	dbConn, err := s.Get("db.mongo")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		db             = dbConn.(*mongo.Database)
+		collection     = db.Collection("media_sources")
+		failedResponse = status.Error(codes.Internal, "Could not group media sources, Please try again later!")
+	)
+
+	user, err := auth.Authenticate(s.Context, req.AuthRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := parseMediaSourceIDs(req.MediaSourceIds)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		series = strings.TrimSpace(req.Series)
+		filter = bson.M{"_id": bson.M{"$in": ids}, "user_id": user.ID}
+	)
+
+	if series == "" {
+		update := bson.M{"$unset": bson.M{"series": ""}, "$set": bson.M{"updated_at": time.Now()}}
+		result, err := collection.UpdateMany(ctx, filter, update)
+		if err != nil {
+			return nil, failedResponse
+		}
+		return bulkResponse("Media sources ungrouped successfully!", result.ModifiedCount), nil
+	}
+
+	if len([]rune(series)) > maxSeriesTitleLength {
+		return nil, status.Errorf(codes.InvalidArgument, "Series title can not be longer than %d characters!", maxSeriesTitleLength)
+	}
+
+	if req.Season < 0 {
+		return nil, status.Error(codes.InvalidArgument, "Season can not be negative!")
+	}
+
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return nil, failedResponse
+	}
+
+	mediaSources := make([]*models.MediaSource, 0)
+	if err := cursor.All(ctx, &mediaSources); err != nil {
+		return nil, failedResponse
+	}
+
+	var affected int64
+	for _, mediaSource := range mediaSources {
+		var (
+			guess   = metadata.ParseFilename(mediaSource.Title)
+			episode = &models.MediaEpisode{Title: series, Season: req.Season, Episode: guess.Episode}
+		)
+		if mediaSource.Series != nil && mediaSource.Series.Episode > 0 {
+			episode.Episode = mediaSource.Series.Episode
+		}
+		if episode.Season == 0 {
+			episode.Season = guess.Season
+		}
+		update := bson.M{"$set": bson.M{"series": episode, "updated_at": time.Now()}}
+		if _, err := collection.UpdateOne(ctx, bson.M{"_id": mediaSource.ID}, update); err != nil {
+			return nil, failedResponse
+		}
+		affected++
+	}
+
+	return bulkResponse("Media sources grouped successfully!", affected), nil
+}
+
+// RemoveMediaSources removes many media sources at once, with their subtitles and files
+func (s *Service) RemoveMediaSources(ctx context.Context, req *BulkMediaSourcesRequest) (*BulkMediaSourcesResponse, error) {
+
+	dbConn, err := s.Get("db.mongo")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		db = dbConn.(*mongo.Database)
+		cm = s.MustGet("config.map").(*config.Map)
+	)
+
+	user, err := auth.Authenticate(s.Context, req.AuthRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := parseMediaSourceIDs(req.MediaSourceIds)
+	if err != nil {
+		return nil, err
+	}
+
+	removal, err := helpers.RemoveMediaSources(ctx, db, bson.M{"_id": bson.M{"$in": ids}, "user_id": user.ID})
+	if err != nil {
+		log.Println(err)
+		return nil, status.Error(codes.Internal, "Could not delete media sources, Please try again later!")
+	}
+
+	helpers.RemoveMediaSourceFiles(removal, cm.Uploads.GetBucket())
+	helpers.SendTheaterMediaChangedEvents(s.Context, removal.Theaters)
+
+	return bulkResponse("Media sources deleted successfully!", int64(len(removal.MediaSources))), nil
+}
@@ -0,0 +1,100 @@
+package theater
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/castyapp/grpc.server/config"
+	"github.com/castyapp/grpc.server/linkcheck"
+	"github.com/castyapp/grpc.server/models"
+	"github.com/castyapp/grpc.server/services/auth"
+	"github.com/castyapp/grpc.server/storage"
+	"github.com/castyapp/libcasty-protocol-go/proto"
+	"github.com/golang/protobuf/ptypes/any"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type MediaLinkResponse struct {
+	Status string
+	Code   int64
+	// Result is nil for the media source types that are not requested
+	Result *models.MediaLink
+}
+
+func violationDetails(violations []linkcheck.Violation) []*any.Any {
+	details := make([]*any.Any, 0, len(violations))
+	for _, violation := range violations {
+		details = append(details, &any.Any{
+			TypeUrl: violation.Field,
+			Value:   []byte(violation.Description),
+		})
+	}
+	return details
+}
+
+// validateMediaSource returns the validation errors of the uri and the type of a media source.
+// Object uris of our own buckets are only set by CompleteUpload, clients can not use them whatever the type is.
+func (s *Service) validateMediaSource(uri string, mediaType proto.MediaSource_Type) []*any.Any {
+	if _, _, ok := storage.ParseObjectURI(strings.TrimSpace(uri)); ok {
+		return []*any.Any{{TypeUrl: "uri", Value: []byte("Uri is not available!")}}
+	}
+	cm := s.MustGet("config.map").(*config.Map)
+	return violationDetails(linkcheck.NewRules(cm.MediaURIs).Validate(uri, mediaType))
+}
+
+// checkMediaSourceURI requests the uri of a download or stream media source so broken links
+// are rejected before they reach the theater. It returns nil when the uri is not checked.
+func (s *Service) checkMediaSourceURI(ctx context.Context, mediaType proto.MediaSource_Type, uri string) (*models.MediaLink, error) {
+
+	cm := s.MustGet("config.map").(*config.Map)
+	if !cm.MediaURIs.CheckReachability || !linkcheck.Checkable(mediaType) {
+		return nil, nil
+	}
+
+	link, violations := linkcheck.NewChecker(cm.MediaURIs).Check(ctx, uri, mediaType)
+	if len(violations) > 0 {
+		return nil, status.ErrorProto(&spb.Status{
+			Code:    int32(codes.InvalidArgument),
+			Message: "Validation Error!",
+			Details: violationDetails(violations),
+		})
+	}
+
+	return link, nil
+}
+
+// CheckMediaSourceURI validates the uri of a media source and reports how its server answers
+// without adding it, so clients can point out broken links while the user types them
+func (s *Service) CheckMediaSourceURI(ctx context.Context, req *proto.MediaSourceAuthRequest) (*MediaLinkResponse, error) {
+
+	if _, err := auth.Authenticate(s.Context, req.AuthRequest); err != nil {
+		return nil, err
+	}
+
+	if req.Media == nil {
+		return nil, status.Error(codes.InvalidArgument, "Media source is required!")
+	}
+
+	validationErrors := s.validateMediaSource(req.Media.Uri, req.Media.Type)
+	if len(validationErrors) > 0 {
+		return nil, status.ErrorProto(&spb.Status{
+			Code:    int32(codes.InvalidArgument),
+			Message: "Validation Error!",
+			Details: validationErrors,
+		})
+	}
+
+	link, err := s.checkMediaSourceURI(ctx, req.Media.Type, req.Media.Uri)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MediaLinkResponse{
+		Status: "success",
+		Code:   http.StatusOK,
+		Result: link,
+	}, nil
+}
@@ -0,0 +1,71 @@
+package theater
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/castyapp/grpc.server/fetcher"
+	"github.com/castyapp/grpc.server/manifest"
+	"github.com/castyapp/grpc.server/models"
+	"github.com/castyapp/libcasty-protocol-go/proto"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type MediaManifestResponse struct {
+	Status string
+	Code   int64
+	Result *models.MediaManifest
+}
+
+// inspectManifest fetches and parses the HLS or DASH manifest of a stream media source,
+// it returns nil for media sources that are not streams.
+func (s *Service) inspectManifest(ctx context.Context, mediaType proto.MediaSource_Type, uri string) (*models.MediaManifest, error) {
+
+	switch {
+	case mediaType == proto.MediaSource_M3U8:
+	case mediaType == proto.MediaSource_DOWNLOAD_URI && manifest.Detect(uri) != "":
+	default:
+		return nil, nil
+	}
+
+	result, err := manifest.NewInspector(0).Inspect(ctx, uri)
+	switch err {
+	case nil:
+		return result, nil
+	case fetcher.ErrInvalidURL, fetcher.ErrBlockedAddress, fetcher.ErrTooManyRedirects:
+		return nil, status.Error(codes.InvalidArgument, "Media source uri is not allowed!")
+	case fetcher.ErrRequestTimedOut:
+		return nil, status.Error(codes.DeadlineExceeded, "Reading the media source manifest took too long!")
+	case manifest.ErrNotManifest, manifest.ErrInvalid, manifest.ErrEmpty, fetcher.ErrTooLarge:
+		return nil, status.Error(codes.InvalidArgument, "Media source manifest is invalid!")
+	default:
+		return nil, status.Error(codes.InvalidArgument, "Could not read the media source manifest!")
+	}
+}
+
+// GetMediaManifest returns the renditions of a stream media source, to its owner and
+// to the members of the theaters that are playing it
+func (s *Service) GetMediaManifest(ctx context.Context, req *proto.MediaSourceAuthRequest) (*MediaManifestResponse, error) {
+
+	dbConn, err := s.Get("db.mongo")
+	if err != nil {
+		return nil, err
+	}
+
+	mediaSource, err := s.findSharedMediaSource(ctx, dbConn.(*mongo.Database), req)
+	if err != nil {
+		return nil, err
+	}
+
+	if mediaSource.Manifest == nil {
+		return nil, status.Error(codes.NotFound, "Media source is not a stream!")
+	}
+
+	return &MediaManifestResponse{
+		Status: "success",
+		Code:   http.StatusOK,
+		Result: mediaSource.Manifest,
+	}, nil
+}
@@ -0,0 +1,93 @@
+package theater
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/castyapp/grpc.server/models"
+	"github.com/castyapp/grpc.server/services/auth"
+	"github.com/castyapp/libcasty-protocol-go/proto"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type MediaJobsRequest struct {
+	AuthRequest *proto.AuthenticateRequest
+	// MediaSourceId limits the jobs to a media source, all of the jobs of the user are returned when empty
+	MediaSourceId string
+}
+
+type MediaJobsResponse struct {
+	Status string
+	Code   int64
+	Result []*models.MediaJob
+}
+
+// maxListedMediaJobs bounds the jobs that are returned, newest first
+const maxListedMediaJobs = 50
+
+// enqueueMediaJob creates a pending job for a media source, it is picked up by the jobs package.
+func enqueueMediaJob(ctx context.Context, db *mongo.Database, mediaSource *models.MediaSource, kind models.MediaJobKind) error {
+	now := time.Now()
+	_, err := db.Collection("media_jobs").InsertOne(ctx, bson.M{
+		"user_id":         mediaSource.UserID,
+		"media_source_id": mediaSource.ID,
+		"kind":            kind,
+		"status":          models.MediaJobPending,
+		"progress":        0,
+		"attempts":        0,
+		"created_at":      now,
+		"updated_at":      now,
+	})
+	return err
+}
+
+// GetMediaJobs returns the status and progress of the background jobs of the user's media sources
+func (s *Service) GetMediaJobs(ctx context.Context, req *MediaJobsRequest) (*MediaJobsResponse, error) {
+
+	dbConn, err := s.Get("db.mongo")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		db             = dbConn.(*mongo.Database)
+		jobs           = make([]*models.MediaJob, 0)
+		failedResponse = status.Error(codes.Internal, "Could not get media jobs, Please try again later!")
+	)
+
+	user, err := auth.Authenticate(s.Context, req.AuthRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{"user_id": user.ID}
+	if req.MediaSourceId != "" {
+		mediaSourceObjectID, err := primitive.ObjectIDFromHex(req.MediaSourceId)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "Could not parse media source id!")
+		}
+		filter["media_source_id"] = mediaSourceObjectID
+	}
+
+	opts := options.Find().SetSort(bson.M{"created_at": -1}).SetLimit(maxListedMediaJobs)
+	cursor, err := db.Collection("media_jobs").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, failedResponse
+	}
+
+	if err := cursor.All(ctx, &jobs); err != nil {
+		return nil, failedResponse
+	}
+
+	return &MediaJobsResponse{
+		Status: "success",
+		Code:   http.StatusOK,
+		Result: jobs,
+	}, nil
+}
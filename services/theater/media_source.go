@@ -1,14 +1,19 @@
 package theater
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"time"
 
+	"github.com/castyapp/grpc.server/config"
+	"github.com/castyapp/grpc.server/fetcher"
 	"github.com/castyapp/grpc.server/helpers"
+	"github.com/castyapp/grpc.server/images"
 	"github.com/castyapp/grpc.server/models"
+	"github.com/castyapp/grpc.server/search"
 	"github.com/castyapp/grpc.server/services"
 	"github.com/castyapp/grpc.server/services/auth"
 	"github.com/castyapp/grpc.server/storage"
@@ -16,16 +21,19 @@ import (
 	"github.com/castyapp/libcasty-protocol-go/protocol"
 	"github.com/getsentry/sentry-go"
 	"github.com/golang/protobuf/ptypes/any"
-	"github.com/minio/minio-go"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	spb "google.golang.org/genproto/googleapis/rpc/status"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+// SelectMediaSource selects the media of the theater of the user, SelectTheaterMediaSource
+// selects the media of theaters of other users
 func (s *Service) SelectMediaSource(ctx context.Context, req *proto.MediaSourceAuthRequest) (*proto.TheaterMediaSourcesResponse, error) {
 
 	dbConn, err := s.Get("db.mongo")
@@ -33,79 +41,69 @@ func (s *Service) SelectMediaSource(ctx context.Context, req *proto.MediaSourceA
 		return nil, err
 	}
 
-	var (
-		db         = dbConn.(*mongo.Database)
-		collection = db.Collection("theaters")
-	)
+	db := dbConn.(*mongo.Database)
 
 	user, err := auth.Authenticate(s.Context, req.AuthRequest)
 	if err != nil {
 		return nil, status.Error(codes.Unauthenticated, "Unauthorized!")
 	}
 
-	var (
-		theater     = new(models.Theater)
-		findTheater = bson.M{"user_id": user.ID}
-	)
-
-	if err := collection.FindOne(ctx, findTheater).Decode(theater); err != nil {
+	theater := new(models.Theater)
+	if err := db.Collection("theaters").FindOne(ctx, bson.M{"user_id": user.ID}).Decode(theater); err != nil {
 		return nil, status.Error(codes.NotFound, "Could not find theater!")
 	}
 
-	mediaSourceID, err := primitive.ObjectIDFromHex(req.Media.Id)
-	if err != nil {
-		return nil, err
+	if req.Media == nil {
+		return nil, status.Error(codes.InvalidArgument, "Media source is required!")
 	}
 
-	mediaSource := new(models.MediaSource)
-
-	decoder := db.Collection("media_sources").FindOne(ctx, bson.M{"_id": mediaSourceID, "user_id": user.ID})
-	if err := decoder.Decode(mediaSource); err != nil {
-		return nil, err
-	}
+	return s.selectMediaSource(ctx, db, user, theater, req.Media.Id)
+}
 
-	var (
-		filter = bson.M{"user_id": user.ID}
-		update = bson.M{
-			"$set": bson.M{
-				"media_source_id": mediaSource.ID,
-			},
-		}
-	)
+// maxPosterBytes is the largest poster image that is accepted from a url
+const maxPosterBytes = 10 << 20
 
-	if _, err := collection.UpdateOne(ctx, filter, update); err != nil {
-		return nil, err
+// SavePosterFromURL stores the image of the url as a poster, posters are always stored as
+// png since they are served as <name>.png whatever format the url had.
+func (s *Service) SavePosterFromURL(url string) (string, error) {
+	resp, err := fetcher.New(fetcher.Images).Fetch(s.Context, url)
+	if err != nil {
+		return "", err
 	}
-
-	mediaSourceProto := helpers.NewMediaSourceProto(mediaSource)
-	event, err := protocol.NewMsgProtobuf(proto.EMSG_THEATER_MEDIA_SOURCE_CHANGED, mediaSourceProto)
-	if err == nil {
-		if err := helpers.SendEventToTheaterMembers(s.Context, event.Bytes(), theater); err != nil {
-			log.Println(err)
-		}
+	data, err := images.Convert(resp.Data, maxPosterBytes, images.PNG)
+	if err != nil {
+		return "", err
 	}
-
-	return &proto.TheaterMediaSourcesResponse{
-		Status:  "success",
-		Code:    http.StatusOK,
-		Message: "Media source selected successfully!",
-		Result:  []*proto.MediaSource{mediaSourceProto},
-	}, nil
+	posterName := services.RandomNumber(20)
+	objectName := fmt.Sprintf("%s.%s", posterName, images.PNG.Extension())
+	if err := storage.Client.Put(storage.Buckets.Posters, objectName, bytes.NewReader(data), int64(len(data)), images.PNG.ContentType()); err != nil {
+		return "", err
+	}
+	return posterName, nil
 }
 
-func (s *Service) SavePosterFromURL(url string) (string, error) {
-	posterName := services.RandomNumber(20)
-	resp, err := http.DefaultClient.Get(url)
+// readMediaSource inspects the manifest and probes the uri of a media source. The manifest
+// and the probed duration are trusted over the length that the client sent.
+func (s *Service) readMediaSource(ctx context.Context, mediaType proto.MediaSource_Type, uri string, length int64) (*models.MediaProbe, *models.MediaManifest, int64, error) {
+
+	mediaManifest, err := s.inspectManifest(ctx, mediaType, uri)
 	if err != nil {
-		return "", err
+		return nil, nil, 0, err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode == http.StatusOK {
-		if _, err := storage.Client.PutObject("posters", fmt.Sprintf("%s.png", posterName), resp.Body, -1, minio.PutObjectOptions{}); err != nil {
-			return "", err
-		}
+
+	mediaProbe, err := s.probeMediaSource(ctx, mediaType, uri, false)
+	if err != nil {
+		return nil, nil, 0, err
 	}
-	return posterName, nil
+
+	switch {
+	case mediaManifest != nil:
+		length = int64(mediaManifest.Duration)
+	case mediaProbe != nil:
+		length = int64(mediaProbe.Duration)
+	}
+
+	return mediaProbe, mediaManifest, length, nil
 }
 
 func (s *Service) AddMediaSource(ctx context.Context, req *proto.MediaSourceAuthRequest) (*proto.TheaterMediaSourcesResponse, error) {
@@ -117,7 +115,6 @@ func (s *Service) AddMediaSource(ctx context.Context, req *proto.MediaSourceAuth
 
 	var (
 		db                 = dbConn.(*mongo.Database)
-		validationErrors   []*any.Any
 		collection         = db.Collection("media_sources")
 		theatersCollection = db.Collection("theaters")
 		failedResponse     = status.Error(codes.Internal, "Could not add a new media source. Please try again later!")
@@ -137,20 +134,7 @@ func (s *Service) AddMediaSource(ctx context.Context, req *proto.MediaSourceAuth
 		return nil, status.Error(codes.NotFound, "Could not find theater!")
 	}
 
-	if req.Media.Uri == "" {
-		validationErrors = append(validationErrors, &any.Any{
-			TypeUrl: "uri",
-			Value:   []byte("Uri is required!"),
-		})
-	}
-
-	if req.Media.Type == proto.MediaSource_UNKNOWN {
-		validationErrors = append(validationErrors, &any.Any{
-			TypeUrl: "type",
-			Value:   []byte("Media source type can not be unknown!"),
-		})
-	}
-
+	validationErrors := s.validateMediaSource(req.Media.Uri, req.Media.Type)
 	if len(validationErrors) > 0 {
 		return nil, status.ErrorProto(&spb.Status{
 			Code:    int32(codes.InvalidArgument),
@@ -159,11 +143,23 @@ func (s *Service) AddMediaSource(ctx context.Context, req *proto.MediaSourceAuth
 		})
 	}
 
-	var poster string
-	poster, err = s.SavePosterFromURL(req.Media.Banner)
+	link, err := s.checkMediaSourceURI(ctx, req.Media.Type, req.Media.Uri)
 	if err != nil {
-		sentry.CaptureException(fmt.Errorf("could not upload poster %v", err))
-		poster = "default"
+		return nil, err
+	}
+
+	mediaProbe, mediaManifest, length, err := s.readMediaSource(ctx, req.Media.Type, req.Media.Uri, req.Media.Length)
+	if err != nil {
+		return nil, err
+	}
+
+	// media sources without a banner get a poster frame from the thumbnails job
+	poster := "default"
+	if req.Media.Banner != "" {
+		if poster, err = s.SavePosterFromURL(req.Media.Banner); err != nil {
+			sentry.CaptureException(fmt.Errorf("could not upload poster %v", err))
+			poster = "default"
+		}
 	}
 
 	mediaSource := bson.M{
@@ -171,19 +167,39 @@ func (s *Service) AddMediaSource(ctx context.Context, req *proto.MediaSourceAuth
 		"type":       req.Media.Type,
 		"banner":     poster,
 		"uri":        req.Media.Uri,
-		"length":     req.Media.Length,
+		"length":     length,
 		"user_id":    user.ID,
 		"artist":     req.Media.Artist,
 		"created_at": time.Now(),
 		"updated_at": time.Now(),
 	}
 
+	if mediaProbe != nil {
+		mediaSource["probe"] = mediaProbe
+	}
+
+	if mediaManifest != nil {
+		mediaSource["manifest"] = mediaManifest
+	}
+
+	if link != nil {
+		mediaSource["link"] = link
+	}
+
 	result, err := collection.InsertOne(ctx, mediaSource)
 	if err != nil {
 		return nil, failedResponse
 	}
 
 	insertedID := result.InsertedID.(primitive.ObjectID)
+
+	// media that ffprobe could read as a video gets a poster frame and seek previews in the background
+	if hasVideo(mediaProbe) {
+		created := &models.MediaSource{ID: &insertedID, UserID: user.ID}
+		if err := enqueueMediaJob(ctx, db, created, models.MediaJobThumbnails); err != nil {
+			log.Println(err)
+		}
+	}
 	update, _ := theatersCollection.UpdateOne(ctx, bson.M{"user_id": user.ID}, bson.M{
 		"$set": bson.M{
 			"media_source_id": insertedID,
@@ -201,7 +217,7 @@ func (s *Service) AddMediaSource(ctx context.Context, req *proto.MediaSourceAuth
 		Type:      req.Media.Type,
 		Banner:    poster,
 		Uri:       req.Media.Uri,
-		Length:    req.Media.Length,
+		Length:    length,
 		Artist:    req.Media.Artist,
 		UserId:    user.ID.Hex(),
 		CreatedAt: nowTime,
@@ -223,6 +239,244 @@ func (s *Service) AddMediaSource(ctx context.Context, req *proto.MediaSourceAuth
 	}, nil
 }
 
+type UpdateMediaSourceRequest struct {
+	AuthRequest *proto.AuthenticateRequest
+	// Media holds the id of the media source and its new values
+	Media *proto.MediaSource
+	// UpdateMask lists the fields of Media that are updated, they can be title, artist, banner, uri and type
+	UpdateMask *fieldmaskpb.FieldMask
+}
+
+var updatableMediaSourceFields = map[string]bool{
+	"title":  true,
+	"artist": true,
+	"banner": true,
+	"uri":    true,
+	"type":   true,
+}
+
+// hasVideo reports whether ffprobe found a video stream in the media, so it gets a poster frame and seek previews.
+func hasVideo(mediaProbe *models.MediaProbe) bool {
+	return mediaProbe != nil && mediaProbe.VideoCodec != ""
+}
+
+// UpdateMediaSource updates the fields of a media source that are listed in the update mask, a new
+// uri or type is validated and probed like a new media source. The theaters that are playing the
+// media source are notified about the change
+func (s *Service) UpdateMediaSource(ctx context.Context, req *UpdateMediaSourceRequest) (*proto.TheaterMediaSourcesResponse, error) {
+
+	dbConn, err := s.Get("db.mongo")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		db               = dbConn.(*mongo.Database)
+		fields           = make(map[string]bool)
+		validationErrors = make([]*any.Any, 0)
+		failedResponse   = status.Error(codes.Internal, "Could not update media source, Please try again later!")
+	)
+
+	user, err := auth.Authenticate(s.Context, req.AuthRequest)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "Unauthorized!")
+	}
+
+	if req.Media == nil {
+		return nil, status.Error(codes.InvalidArgument, "Media source is required!")
+	}
+
+	if req.UpdateMask == nil || len(req.UpdateMask.Paths) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Update mask is required!")
+	}
+
+	for _, path := range req.UpdateMask.Paths {
+		if !updatableMediaSourceFields[path] {
+			validationErrors = append(validationErrors, &any.Any{
+				TypeUrl: "update_mask",
+				Value:   []byte(fmt.Sprintf("Field %s can not be updated!", path)),
+			})
+			continue
+		}
+		fields[path] = true
+	}
+
+	mediaSource, err := findOwnMediaSource(ctx, db, user, req.Media.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		uri            = mediaSource.URI
+		mediaType      = mediaSource.Type
+		previousLength = mediaSource.Length
+	)
+
+	if fields["uri"] {
+		uri = req.Media.Uri
+	}
+
+	if fields["type"] {
+		mediaType = req.Media.Type
+	}
+
+	switch {
+	case uri != mediaSource.URI:
+		validationErrors = append(validationErrors, s.validateMediaSource(uri, mediaType)...)
+	case mediaType != mediaSource.Type && mediaSource.ObjectKey != "":
+		// uploaded files are stored with the type they were uploaded as
+		validationErrors = append(validationErrors, &any.Any{
+			TypeUrl: "type",
+			Value:   []byte("Type of an uploaded media source can not be changed!"),
+		})
+	case mediaType != mediaSource.Type:
+		validationErrors = append(validationErrors, s.validateMediaSource(uri, mediaType)...)
+	}
+
+	if len(validationErrors) > 0 {
+		return nil, status.ErrorProto(&spb.Status{
+			Code:    int32(codes.InvalidArgument),
+			Message: "Validation Error!",
+			Details: validationErrors,
+		})
+	}
+
+	var (
+		set   = bson.M{"updated_at": time.Now()}
+		unset = bson.M{}
+		// media that is read again or loses its banner gets new thumbnails
+		generateThumbnails = false
+	)
+
+	if fields["title"] {
+		set["title"] = req.Media.Title
+	}
+
+	if fields["artist"] {
+		set["artist"] = req.Media.Artist
+	}
+
+	if uri != mediaSource.URI || mediaType != mediaSource.Type {
+
+		link, err := s.checkMediaSourceURI(ctx, mediaType, uri)
+		if err != nil {
+			return nil, err
+		}
+
+		mediaProbe, mediaManifest, length, err := s.readMediaSource(ctx, mediaType, uri, req.Media.Length)
+		if err != nil {
+			return nil, err
+		}
+
+		set["uri"] = uri
+		set["type"] = mediaType
+		set["length"] = length
+
+		if mediaProbe != nil {
+			set["probe"] = mediaProbe
+		} else {
+			unset["probe"] = ""
+		}
+
+		if mediaManifest != nil {
+			set["manifest"] = mediaManifest
+		} else {
+			unset["manifest"] = ""
+		}
+
+		if link != nil {
+			set["link"] = link
+		} else {
+			unset["link"] = ""
+		}
+
+		// what was found out about the old uri does not belong to the media anymore,
+		// an uploaded file that is not used is removed by the storage gc
+		if uri != mediaSource.URI {
+			unset["thumbnails"] = ""
+			unset["audio_tracks"] = ""
+			unset["object_key"] = ""
+			unset["size"] = ""
+		}
+
+		generateThumbnails = hasVideo(mediaProbe)
+	}
+
+	if fields["banner"] {
+		poster := "default"
+		if req.Media.Banner != "" {
+			if poster, err = s.SavePosterFromURL(req.Media.Banner); err != nil {
+				return nil, status.ErrorProto(&spb.Status{
+					Code:    int32(codes.InvalidArgument),
+					Message: "Validation Error!",
+					Details: []*any.Any{
+						{
+							TypeUrl: "banner",
+							Value:   []byte("Could not fetch the banner!"),
+						},
+					},
+				})
+			}
+		}
+		set["banner"] = poster
+		if poster == "default" && hasVideo(mediaSource.Probe) {
+			generateThumbnails = true
+		}
+	}
+
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	var (
+		filter = bson.M{"_id": mediaSource.ID, "user_id": user.ID}
+		opts   = options.FindOneAndUpdate().SetReturnDocument(options.After)
+	)
+
+	if err := db.Collection("media_sources").FindOneAndUpdate(ctx, filter, update, opts).Decode(mediaSource); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, status.Error(codes.NotFound, "Could not find media source!")
+		}
+		return nil, failedResponse
+	}
+
+	if _, replaced := unset["object_key"]; replaced {
+
+		// the upload of the old uri does not count toward the quota anymore
+		filter := bson.M{"media_source_id": mediaSource.ID, "subtitle_id": bson.M{"$exists": false}}
+		if _, err := db.Collection("uploads").DeleteMany(ctx, filter); err != nil {
+			log.Println(err)
+		}
+
+		// subtitles that were extracted from the tracks of the old file do not belong to the media,
+		// their files are removed by the storage gc
+		filter = bson.M{"media_source_id": mediaSource.ID, "track_index": bson.M{"$exists": true}}
+		if _, err := db.Collection("subtitles").DeleteMany(ctx, filter); err != nil {
+			log.Println(err)
+		}
+	}
+
+	if mediaSource.Length != previousLength {
+		helpers.UpdatePlaybackLength(s.Context, db, mediaSource)
+	}
+
+	if generateThumbnails && hasVideo(mediaSource.Probe) {
+		if err := enqueueMediaJob(ctx, db, mediaSource, models.MediaJobThumbnails); err != nil {
+			log.Println(err)
+		}
+	}
+
+	helpers.SendMediaSourceChangedEvents(s.Context, db, mediaSource)
+
+	return &proto.TheaterMediaSourcesResponse{
+		Status:  "success",
+		Code:    http.StatusOK,
+		Message: "Media source updated successfully!",
+		Result:  []*proto.MediaSource{helpers.NewMediaSourceProto(mediaSource)},
+	}, nil
+}
+
 func (s *Service) GetMediaSource(ctx context.Context, req *proto.MediaSourceAuthRequest) (*proto.TheaterMediaSourcesResponse, error) {
 
 	dbConn, err := s.Get("db.mongo")
@@ -292,18 +546,20 @@ func (s *Service) GetMediaSources(ctx context.Context, req *proto.MediaSourceAut
 		}, nil
 	}
 
-	cursor, err := db.Collection("media_sources").Find(ctx, bson.M{"user_id": user.ID})
-	if err != nil {
-		return nil, status.Error(codes.NotFound, "Could not find theater!")
-	}
-
-	for cursor.Next(ctx) {
-		dbMediaSource := new(models.MediaSource)
-		if err := cursor.Decode(dbMediaSource); err != nil {
-			continue
+	// the whole library is listed in the order of the newest first, like the library search does
+	query := search.MediaQuery{Sort: search.SortNewest, Limit: search.MaxLimit}
+	for {
+		page, err := search.MediaSources(ctx, db, user.ID, query)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "Could not get media sources, Please try again later!")
+		}
+		for _, dbMediaSource := range page.Results {
+			mediaSources = append(mediaSources, helpers.NewMediaSourceProto(dbMediaSource))
 		}
-		protoMediaSource := helpers.NewMediaSourceProto(dbMediaSource)
-		mediaSources = append(mediaSources, protoMediaSource)
+		if page.NextCursor == "" {
+			break
+		}
+		query.Cursor = page.NextCursor
 	}
 
 	return &proto.TheaterMediaSourcesResponse{
@@ -321,8 +577,8 @@ func (s *Service) RemoveMediaSource(ctx context.Context, req *proto.MediaSourceR
 	}
 
 	var (
-		db         = dbConn.(*mongo.Database)
-		collection = db.Collection("media_sources")
+		db = dbConn.(*mongo.Database)
+		cm = s.MustGet("config.map").(*config.Map)
 	)
 
 	user, err := auth.Authenticate(s.Context, req.AuthRequest)
@@ -336,28 +592,25 @@ func (s *Service) RemoveMediaSource(ctx context.Context, req *proto.MediaSourceR
 
 	mediaSourceObjectID, err := primitive.ObjectIDFromHex(req.MediaSourceId)
 	if err != nil {
-		return nil, status.Error(codes.Internal, "Could not parse MediaSourceId!")
+		return nil, status.Error(codes.InvalidArgument, "Could not parse MediaSourceId!")
 	}
 
-	var (
-		theater     = new(models.Theater)
-		findTheater = bson.M{"user_id": user.ID}
-	)
-
-	if err := db.Collection("theaters").FindOne(ctx, findTheater).Decode(theater); err != nil {
-		return nil, status.Error(codes.Internal, "Could not find theater!")
+	removal, err := helpers.RemoveMediaSources(ctx, db, bson.M{"_id": mediaSourceObjectID, "user_id": user.ID})
+	if err != nil {
+		log.Println(err)
+		return nil, status.Error(codes.Internal, "Could not delete media source, Please try again later!")
 	}
 
-	result, err := collection.DeleteOne(ctx, bson.M{"_id": mediaSourceObjectID, "user_id": user.ID})
-	if err == nil {
-		if result.DeletedCount == 1 {
-			return &proto.Response{
-				Status:  "success",
-				Code:    http.StatusOK,
-				Message: "Media source deleted successfully@",
-			}, nil
-		}
+	if len(removal.MediaSources) == 0 {
+		return nil, status.Error(codes.NotFound, "Could not find media source!")
 	}
 
-	return nil, fmt.Errorf("could not delete media source. %v", err)
+	helpers.RemoveMediaSourceFiles(removal, cm.Uploads.GetBucket())
+	helpers.SendTheaterMediaChangedEvents(s.Context, removal.Theaters)
+
+	return &proto.Response{
+		Status:  "success",
+		Code:    http.StatusOK,
+		Message: "Media source deleted successfully!",
+	}, nil
 }
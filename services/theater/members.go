@@ -0,0 +1,471 @@
+package theater
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/castyapp/grpc.server/helpers"
+	"github.com/castyapp/grpc.server/models"
+	"github.com/castyapp/grpc.server/search"
+	"github.com/castyapp/grpc.server/services/auth"
+	"github.com/castyapp/libcasty-protocol-go/proto"
+	"github.com/castyapp/libcasty-protocol-go/protocol"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MaxBanReasonLength is the longest reason that a ban keeps.
+const MaxBanReasonLength = 500
+
+// TheaterMembershipRequest joins or leaves a theater. The websocket gateway joins the users
+// that connect to a theater with their own tokens, so presence is checked like a join.
+type TheaterMembershipRequest struct {
+	AuthRequest *proto.AuthenticateRequest
+	TheaterId   string
+}
+
+// MemberModerationRequest kicks, bans or unbans a user in the theater of the authenticated user.
+type MemberModerationRequest struct {
+	AuthRequest *proto.AuthenticateRequest
+	UserId      string
+	// Reason and Duration are only used by BanMember, bans without a duration are permanent
+	Reason   string
+	Duration time.Duration
+}
+
+type TheaterMembersRequest struct {
+	AuthRequest *proto.AuthenticateRequest
+	TheaterId   string
+	// Cursor is the NextCursor of the previous page
+	Cursor string
+	Limit  int64
+}
+
+type TheaterMembersResponse struct {
+	Status     string
+	Code       int64
+	Result     []*proto.User
+	NextCursor string
+}
+
+type TheaterBansResponse struct {
+	Status string
+	Code   int64
+	Result []*models.TheaterBan
+}
+
+func membershipError(err error) error {
+	switch err {
+	case helpers.ErrTheaterBanned:
+		return status.Error(codes.PermissionDenied, "You are banned from this theater!")
+	case helpers.ErrTheaterNotAllowed:
+		return status.Error(codes.PermissionDenied, "Permission Denied!")
+	}
+	log.Println(err)
+	return status.Error(codes.Internal, "Could not update the theater members, Please try again later!")
+}
+
+// JoinTheater makes the user a member of a theater that its privacy lets them in
+func (s *Service) JoinTheater(ctx context.Context, req *TheaterMembershipRequest) (*proto.Response, error) {
+
+	dbConn, err := s.Get("db.mongo")
+	if err != nil {
+		return nil, err
+	}
+
+	db := dbConn.(*mongo.Database)
+
+	user, err := auth.Authenticate(s.Context, req.AuthRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	theater, err := findVisibleTheater(ctx, db, user, req.TheaterId)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := helpers.JoinTheater(s.Context, db, theater, user); err != nil {
+		return nil, membershipError(err)
+	}
+
+	return &proto.Response{
+		Status:  "success",
+		Code:    http.StatusOK,
+		Message: "Joined theater successfully!",
+	}, nil
+}
+
+func (s *Service) LeaveTheater(ctx context.Context, req *TheaterMembershipRequest) (*proto.Response, error) {
+
+	dbConn, err := s.Get("db.mongo")
+	if err != nil {
+		return nil, err
+	}
+
+	db := dbConn.(*mongo.Database)
+
+	user, err := auth.Authenticate(s.Context, req.AuthRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	theaterObjectID, err := primitive.ObjectIDFromHex(req.TheaterId)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "Theater object id is invalid!")
+	}
+
+	// leaving does not check the privacy, members of a theater that became private can still leave it
+	theater := new(models.Theater)
+	if err := db.Collection("theaters").FindOne(ctx, bson.M{"_id": theaterObjectID}).Decode(theater); err != nil {
+		return nil, status.Error(codes.NotFound, "Could not find theater!")
+	}
+
+	if _, err := helpers.LeaveTheater(s.Context, db, theater, user); err != nil {
+		return nil, membershipError(err)
+	}
+
+	return &proto.Response{
+		Status:  "success",
+		Code:    http.StatusOK,
+		Message: "Left theater successfully!",
+	}, nil
+}
+
+// GetTheaterMembers lists the members of a theater in the order they joined
+func (s *Service) GetTheaterMembers(ctx context.Context, req *TheaterMembersRequest) (*TheaterMembersResponse, error) {
+
+	dbConn, err := s.Get("db.mongo")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		db             = dbConn.(*mongo.Database)
+		failedResponse = status.Error(codes.Internal, "Could not get theater members, Please try again later!")
+	)
+
+	user, err := auth.Authenticate(s.Context, req.AuthRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	theater, err := findVisibleTheater(ctx, db, user, req.TheaterId)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = search.DefaultLimit
+	}
+	if limit > search.MaxLimit {
+		limit = search.MaxLimit
+	}
+
+	filter := bson.M{"theater_id": theater.ID}
+	if req.Cursor != "" {
+		after, err := primitive.ObjectIDFromHex(req.Cursor)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "Cursor is invalid!")
+		}
+		filter["_id"] = bson.M{"$gt": after}
+	}
+
+	// one more than the limit tells if there is a next page
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(limit + 1)
+	cursor, err := db.Collection("theater_members").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, failedResponse
+	}
+
+	members := make([]*models.TheaterMember, 0)
+	if err := cursor.All(ctx, &members); err != nil {
+		return nil, failedResponse
+	}
+
+	response := &TheaterMembersResponse{
+		Status: "success",
+		Code:   http.StatusOK,
+		Result: make([]*proto.User, 0, len(members)),
+	}
+
+	if int64(len(members)) > limit {
+		members = members[:limit]
+		response.NextCursor = members[limit-1].ID.Hex()
+	}
+
+	userIDs := make([]*primitive.ObjectID, 0, len(members))
+	for _, member := range members {
+		userIDs = append(userIDs, member.UserID)
+	}
+
+	users := make([]*models.User, 0, len(userIDs))
+	if len(userIDs) > 0 {
+		cursor, err := db.Collection("users").Find(ctx, bson.M{"_id": bson.M{"$in": userIDs}})
+		if err != nil {
+			return nil, failedResponse
+		}
+		if err := cursor.All(ctx, &users); err != nil {
+			return nil, failedResponse
+		}
+	}
+
+	byID := make(map[string]*models.User, len(users))
+	for _, u := range users {
+		byID[u.ID.Hex()] = u
+	}
+
+	// the friends of the viewer are loaded once instead of a relation lookup per member
+	friendIDs, err := helpers.GetFriendIDs(ctx, db, user.ID)
+	if err != nil {
+		return nil, failedResponse
+	}
+
+	friends := make(map[string]bool, len(friendIDs))
+	for _, friendID := range friendIDs {
+		friends[friendID.Hex()] = true
+	}
+
+	for _, member := range members {
+		u, ok := byID[member.UserID.Hex()]
+		if !ok {
+			continue
+		}
+		relation := models.RelationStranger
+		switch {
+		case u.ID.Hex() == user.ID.Hex():
+			relation = models.RelationSelf
+		case friends[u.ID.Hex()]:
+			relation = models.RelationFriend
+		}
+		response.Result = append(response.Result, helpers.NewProtoUser(u, relation))
+	}
+
+	return response, nil
+}
+
+// findModeratedMember finds the theater of the authenticated user and the user that is moderated.
+func (s *Service) findModeratedMember(ctx context.Context, db *mongo.Database, req *MemberModerationRequest) (*models.Theater, *models.User, error) {
+
+	user, err := auth.Authenticate(s.Context, req.AuthRequest)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	theater := new(models.Theater)
+	if err := db.Collection("theaters").FindOne(ctx, bson.M{"user_id": user.ID}).Decode(theater); err != nil {
+		return nil, nil, status.Error(codes.NotFound, "Could not find theater!")
+	}
+
+	memberID, err := primitive.ObjectIDFromHex(req.UserId)
+	if err != nil {
+		return nil, nil, status.Error(codes.InvalidArgument, "Could not parse user id!")
+	}
+
+	if memberID == *user.ID {
+		return nil, nil, status.Error(codes.InvalidArgument, "You can not moderate yourself!")
+	}
+
+	member := new(models.User)
+	if err := db.Collection("users").FindOne(ctx, bson.M{"_id": memberID}).Decode(member); err != nil {
+		return nil, nil, status.Error(codes.NotFound, "Could not find the user!")
+	}
+
+	return theater, member, nil
+}
+
+// removeMember removes the user from the theater and tells their clients to leave it, it
+// reports whether the user was a member.
+func (s *Service) removeMember(db *mongo.Database, theater *models.Theater, member *models.User) (bool, error) {
+
+	left, err := helpers.LeaveTheater(s.Context, db, theater, member)
+	if err != nil || !left {
+		return false, err
+	}
+
+	event, err := protocol.NewMsgProtobuf(proto.EMSG_LEAVE_THEATER, &proto.LeaveTheaterMsgEvent{TheaterId: theater.ID.Hex()})
+	if err == nil {
+		if err := helpers.SendEventToUser(s.Context, event.Bytes(), &proto.User{Id: member.ID.Hex()}); err != nil {
+			log.Println(err)
+		}
+	}
+
+	return true, nil
+}
+
+// KickMember removes a member from the theater of the user, they can join again
+func (s *Service) KickMember(ctx context.Context, req *MemberModerationRequest) (*proto.Response, error) {
+
+	dbConn, err := s.Get("db.mongo")
+	if err != nil {
+		return nil, err
+	}
+
+	db := dbConn.(*mongo.Database)
+
+	theater, member, err := s.findModeratedMember(ctx, db, req)
+	if err != nil {
+		return nil, err
+	}
+
+	left, err := s.removeMember(db, theater, member)
+	if err != nil {
+		return nil, membershipError(err)
+	}
+
+	if !left {
+		return nil, status.Error(codes.NotFound, "User is not a member of the theater!")
+	}
+
+	return &proto.Response{
+		Status:  "success",
+		Code:    http.StatusOK,
+		Message: "Member kicked successfully!",
+	}, nil
+}
+
+// BanMember removes a user from the theater of the user and keeps them out of it,
+// banning a banned user again replaces their ban
+func (s *Service) BanMember(ctx context.Context, req *MemberModerationRequest) (*proto.Response, error) {
+
+	dbConn, err := s.Get("db.mongo")
+	if err != nil {
+		return nil, err
+	}
+
+	db := dbConn.(*mongo.Database)
+
+	if req.Duration < 0 {
+		return nil, status.Error(codes.InvalidArgument, "Ban duration can not be negative!")
+	}
+
+	if len([]rune(req.Reason)) > MaxBanReasonLength {
+		return nil, status.Errorf(codes.InvalidArgument, "Ban reason can not be longer than %d characters!", MaxBanReasonLength)
+	}
+
+	theater, member, err := s.findModeratedMember(ctx, db, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		now = time.Now()
+		ban = &models.TheaterBan{
+			TheaterID: theater.ID,
+			UserID:    member.ID,
+			BannedBy:  theater.UserID,
+			Reason:    req.Reason,
+			CreatedAt: now,
+		}
+	)
+
+	if req.Duration > 0 {
+		expiresAt := now.Add(req.Duration)
+		ban.ExpiresAt = &expiresAt
+	}
+
+	var (
+		filter = bson.M{"theater_id": theater.ID, "user_id": member.ID}
+		opts   = options.Replace().SetUpsert(true)
+	)
+
+	if _, err := db.Collection("theater_bans").ReplaceOne(ctx, filter, ban, opts); err != nil {
+		return nil, membershipError(err)
+	}
+
+	// users that are not members are banned all the same
+	if _, err := s.removeMember(db, theater, member); err != nil {
+		return nil, membershipError(err)
+	}
+
+	return &proto.Response{
+		Status:  "success",
+		Code:    http.StatusOK,
+		Message: "Member banned successfully!",
+	}, nil
+}
+
+func (s *Service) UnbanMember(ctx context.Context, req *MemberModerationRequest) (*proto.Response, error) {
+
+	dbConn, err := s.Get("db.mongo")
+	if err != nil {
+		return nil, err
+	}
+
+	db := dbConn.(*mongo.Database)
+
+	theater, member, err := s.findModeratedMember(ctx, db, req)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := db.Collection("theater_bans").DeleteOne(ctx, bson.M{"theater_id": theater.ID, "user_id": member.ID})
+	if err != nil {
+		return nil, membershipError(err)
+	}
+
+	if result.DeletedCount == 0 {
+		return nil, status.Error(codes.NotFound, "User is not banned!")
+	}
+
+	return &proto.Response{
+		Status:  "success",
+		Code:    http.StatusOK,
+		Message: "Member unbanned successfully!",
+	}, nil
+}
+
+// GetTheaterBans lists the active bans of the theater of the user, the latest first
+func (s *Service) GetTheaterBans(ctx context.Context, req *proto.AuthenticateRequest) (*TheaterBansResponse, error) {
+
+	dbConn, err := s.Get("db.mongo")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		db             = dbConn.(*mongo.Database)
+		theater        = new(models.Theater)
+		failedResponse = status.Error(codes.Internal, "Could not get theater bans, Please try again later!")
+	)
+
+	user, err := auth.Authenticate(s.Context, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Collection("theaters").FindOne(ctx, bson.M{"user_id": user.ID}).Decode(theater); err != nil {
+		return nil, status.Error(codes.NotFound, "Could not find theater!")
+	}
+
+	filter := bson.M{
+		"theater_id": theater.ID,
+		"$or": []interface{}{
+			bson.M{"expires_at": bson.M{"$exists": false}},
+			bson.M{"expires_at": bson.M{"$gt": time.Now()}},
+		},
+	}
+
+	cursor, err := db.Collection("theater_bans").Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, failedResponse
+	}
+
+	bans := make([]*models.TheaterBan, 0)
+	if err := cursor.All(ctx, &bans); err != nil {
+		return nil, failedResponse
+	}
+
+	return &TheaterBansResponse{
+		Status: "success",
+		Code:   http.StatusOK,
+		Result: bans,
+	}, nil
+}
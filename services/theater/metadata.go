@@ -0,0 +1,198 @@
+package theater
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/castyapp/grpc.server/helpers"
+	"github.com/castyapp/grpc.server/metadata"
+	"github.com/castyapp/grpc.server/models"
+	"github.com/castyapp/grpc.server/services/auth"
+	"github.com/castyapp/libcasty-protocol-go/proto"
+	"github.com/getsentry/sentry-go"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type SearchMetadataRequest struct {
+	AuthRequest *proto.AuthenticateRequest
+	// MediaSourceId searches with the title of the media source when Title and Filename are empty
+	MediaSourceId string
+	Title         string
+	Year          int
+	Season        int
+	Episode       int
+	// Filename is parsed for the title, year, season and episode, like Show.S01E02.1080p.mkv
+	Filename string
+}
+
+type MetadataResponse struct {
+	Status string
+	Code   int64
+	Result []*models.MediaMetadata
+}
+
+type ConfirmMetadataRequest struct {
+	AuthRequest   *proto.AuthenticateRequest
+	MediaSourceId string
+	// MetadataId is the id of one of the search results
+	MetadataId string
+}
+
+func metadataError(err error) error {
+	switch err {
+	case metadata.ErrNotFound:
+		return status.Error(codes.NotFound, "Could not find metadata!")
+	case metadata.ErrInvalidID:
+		return status.Error(codes.InvalidArgument, "Metadata id is invalid!")
+	}
+	return status.Error(codes.Unavailable, "Metadata provider is unavailable, Please try again later!")
+}
+
+func findOwnMediaSource(ctx context.Context, db *mongo.Database, user *models.User, mediaSourceID string) (*models.MediaSource, error) {
+	mediaSource := new(models.MediaSource)
+	mediaSourceObjectID, err := primitive.ObjectIDFromHex(mediaSourceID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "Could not parse media source id!")
+	}
+	filter := bson.M{"_id": mediaSourceObjectID, "user_id": user.ID}
+	if err := db.Collection("media_sources").FindOne(ctx, filter).Decode(mediaSource); err != nil {
+		return nil, status.Error(codes.NotFound, "Could not find media source!")
+	}
+	return mediaSource, nil
+}
+
+// SearchMetadata searches the movie and tv show database for the matches of a title, a file name
+// or a media source, the user confirms one of them with ConfirmMetadata
+func (s *Service) SearchMetadata(ctx context.Context, req *SearchMetadataRequest) (*MetadataResponse, error) {
+
+	dbConn, err := s.Get("db.mongo")
+	if err != nil {
+		return nil, err
+	}
+
+	db := dbConn.(*mongo.Database)
+
+	user, err := auth.Authenticate(s.Context, req.AuthRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	if metadata.Client == nil {
+		return nil, status.Error(codes.Unimplemented, "Metadata lookups are not enabled!")
+	}
+
+	var query metadata.Query
+	switch {
+	case strings.TrimSpace(req.Title) != "":
+		query = metadata.Query{Title: strings.TrimSpace(req.Title), Year: req.Year, Season: req.Season, Episode: req.Episode}
+	case req.Filename != "":
+		query = metadata.ParseFilename(req.Filename)
+	case req.MediaSourceId != "":
+		mediaSource, err := findOwnMediaSource(ctx, db, user, req.MediaSourceId)
+		if err != nil {
+			return nil, err
+		}
+		query = metadata.ParseFilename(mediaSource.Title)
+	}
+
+	if query.Title == "" {
+		return nil, status.Error(codes.InvalidArgument, "Title is required!")
+	}
+
+	results, err := metadata.Client.Search(ctx, query)
+	if err != nil {
+		return nil, metadataError(err)
+	}
+
+	return &MetadataResponse{
+		Status: "success",
+		Code:   http.StatusOK,
+		Result: results,
+	}, nil
+}
+
+// ConfirmMetadata sets the metadata of a media source to a search result, the media source
+// is renamed to its canonical title and gets its poster
+func (s *Service) ConfirmMetadata(ctx context.Context, req *ConfirmMetadataRequest) (*proto.TheaterMediaSourcesResponse, error) {
+
+	dbConn, err := s.Get("db.mongo")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		db             = dbConn.(*mongo.Database)
+		failedResponse = status.Error(codes.Internal, "Could not update media source, Please try again later!")
+	)
+
+	user, err := auth.Authenticate(s.Context, req.AuthRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	if metadata.Client == nil {
+		return nil, status.Error(codes.Unimplemented, "Metadata lookups are not enabled!")
+	}
+
+	mediaSource, err := findOwnMediaSource(ctx, db, user, req.MediaSourceId)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := metadata.Client.Get(ctx, req.MetadataId)
+	if err != nil {
+		return nil, metadataError(err)
+	}
+
+	mediaSource.Title = metadata.DisplayTitle(result)
+	mediaSource.Metadata = result
+	mediaSource.UpdatedAt = time.Now()
+
+	set := bson.M{
+		"title":      mediaSource.Title,
+		"metadata":   result,
+		"updated_at": mediaSource.UpdatedAt,
+	}
+
+	// confirmed episodes are grouped into their series in the library
+	if result.Kind == models.MediaMetadataEpisode {
+		mediaSource.Series = &models.MediaEpisode{Title: result.Title, Season: result.Season, Episode: result.Episode}
+		set["series"] = mediaSource.Series
+	}
+
+	// the runtime is only a hint, the probed length is kept when there is one
+	if mediaSource.Length == 0 && result.Runtime > 0 {
+		mediaSource.Length = int64(result.Runtime) * 60
+		set["length"] = mediaSource.Length
+	}
+
+	if result.Poster != "" {
+		poster, err := s.SavePosterFromURL(result.Poster)
+		if err != nil {
+			sentry.CaptureException(fmt.Errorf("could not upload poster %v", err))
+		} else {
+			mediaSource.Banner = poster
+			set["banner"] = poster
+		}
+	}
+
+	if _, err := db.Collection("media_sources").UpdateOne(ctx, bson.M{"_id": mediaSource.ID}, bson.M{"$set": set}); err != nil {
+		return nil, failedResponse
+	}
+
+	helpers.SendMediaSourceChangedEvents(s.Context, db, mediaSource)
+
+	return &proto.TheaterMediaSourcesResponse{
+		Status:  "success",
+		Code:    http.StatusOK,
+		Message: "Media source updated successfully!",
+		Result:  []*proto.MediaSource{helpers.NewMediaSourceProto(mediaSource)},
+	}, nil
+}
@@ -0,0 +1,177 @@
+package theater
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/castyapp/grpc.server/helpers"
+	"github.com/castyapp/grpc.server/models"
+	"github.com/castyapp/grpc.server/services/auth"
+	"github.com/castyapp/libcasty-protocol-go/proto"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type PlaybackRequest struct {
+	AuthRequest *proto.AuthenticateRequest
+	TheaterId   string
+	// Position in seconds, it's only used by Seek
+	Position float64
+	// Rate is only used by SetPlaybackRate
+	Rate float64
+}
+
+type PlaybackStateResponse struct {
+	Status string
+	Code   int64
+	Result *models.PlaybackState
+	// ServerTime is when the response was made, clients compare it with their clock
+	// to work out the current position of a playing media
+	ServerTime time.Time
+}
+
+// findVisibleTheater finds a theater that the user can see, which are the theaters that the user
+// could join: the block, the ban and the privacy of the theater are checked like JoinTheater does.
+func findVisibleTheater(ctx context.Context, db *mongo.Database, user *models.User, theaterID string) (*models.Theater, error) {
+
+	theaterObjectID, err := primitive.ObjectIDFromHex(theaterID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "Theater object id is invalid!")
+	}
+
+	theater := new(models.Theater)
+	if err := db.Collection("theaters").FindOne(ctx, bson.M{"_id": theaterObjectID}).Decode(theater); err != nil {
+		return nil, status.Error(codes.NotFound, "Could not find theater!")
+	}
+
+	switch err := helpers.CheckTheaterJoin(ctx, db, theater, user); err {
+	case nil:
+	case helpers.ErrTheaterBanned:
+		return nil, status.Error(codes.PermissionDenied, "You are banned from this theater!")
+	case helpers.ErrTheaterNotAllowed:
+		return nil, status.Error(codes.PermissionDenied, "Permission Denied!")
+	default:
+		log.Println(err)
+		return nil, status.Error(codes.Internal, "Could not find theater, Please try again later!")
+	}
+
+	return theater, nil
+}
+
+func playbackStateResponse(state *models.PlaybackState) *PlaybackStateResponse {
+	return &PlaybackStateResponse{
+		Status:     "success",
+		Code:       http.StatusOK,
+		Result:     state,
+		ServerTime: time.Now(),
+	}
+}
+
+// GetPlaybackState returns the playback state of a theater, late joiners and reconnecting
+// clients start from it instead of asking the other members
+func (s *Service) GetPlaybackState(ctx context.Context, req *PlaybackRequest) (*PlaybackStateResponse, error) {
+
+	dbConn, err := s.Get("db.mongo")
+	if err != nil {
+		return nil, err
+	}
+
+	db := dbConn.(*mongo.Database)
+
+	user, err := auth.Authenticate(s.Context, req.AuthRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	theater, err := findVisibleTheater(ctx, db, user, req.TheaterId)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := helpers.GetPlaybackState(s.Context, db, theater)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Could not get the playback state, Please try again later!")
+	}
+
+	return playbackStateResponse(state), nil
+}
+
+// updatePlayback changes the playback state of a theater for a user with video player
+// access and sends the new state to the members of the theater.
+func (s *Service) updatePlayback(ctx context.Context, req *PlaybackRequest, change func(*models.PlaybackState, *models.User, time.Time) error) (*PlaybackStateResponse, error) {
+
+	dbConn, err := s.Get("db.mongo")
+	if err != nil {
+		return nil, err
+	}
+
+	db := dbConn.(*mongo.Database)
+
+	user, err := auth.Authenticate(s.Context, req.AuthRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	theater, err := findVisibleTheater(ctx, db, user, req.TheaterId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkVideoPlayerAccess(ctx, db, theater, user); err != nil {
+		return nil, err
+	}
+
+	if theater.MediaSourceID == nil {
+		return nil, status.Error(codes.FailedPrecondition, "Theater has no media source selected!")
+	}
+
+	state, err := helpers.UpdatePlaybackState(s.Context, db, theater, func(state *models.PlaybackState) error {
+		return change(state, user, time.Now())
+	})
+	switch err {
+	case nil:
+	case models.ErrInvalidPosition:
+		return nil, status.Error(codes.InvalidArgument, "Position is out of the media!")
+	case models.ErrInvalidPlaybackRate:
+		return nil, status.Errorf(codes.InvalidArgument, "Playback rate should be between %v and %v!", models.MinPlaybackRate, models.MaxPlaybackRate)
+	case helpers.ErrPlaybackConflict:
+		return nil, status.Error(codes.Aborted, "Playback state is being changed, Please try again!")
+	default:
+		return nil, status.Error(codes.Internal, "Could not update the playback state, Please try again later!")
+	}
+
+	helpers.SendPlaybackStateEvent(s.Context, theater, state)
+
+	return playbackStateResponse(state), nil
+}
+
+func (s *Service) Play(ctx context.Context, req *PlaybackRequest) (*PlaybackStateResponse, error) {
+	return s.updatePlayback(ctx, req, func(state *models.PlaybackState, user *models.User, now time.Time) error {
+		state.Play(user.ID, now)
+		return nil
+	})
+}
+
+func (s *Service) Pause(ctx context.Context, req *PlaybackRequest) (*PlaybackStateResponse, error) {
+	return s.updatePlayback(ctx, req, func(state *models.PlaybackState, user *models.User, now time.Time) error {
+		state.Pause(user.ID, now)
+		return nil
+	})
+}
+
+func (s *Service) Seek(ctx context.Context, req *PlaybackRequest) (*PlaybackStateResponse, error) {
+	return s.updatePlayback(ctx, req, func(state *models.PlaybackState, user *models.User, now time.Time) error {
+		return state.Seek(user.ID, req.Position, now)
+	})
+}
+
+func (s *Service) SetPlaybackRate(ctx context.Context, req *PlaybackRequest) (*PlaybackStateResponse, error) {
+	return s.updatePlayback(ctx, req, func(state *models.PlaybackState, user *models.User, now time.Time) error {
+		return state.SetRate(user.ID, req.Rate, now)
+	})
+}
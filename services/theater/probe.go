@@ -0,0 +1,64 @@
+package theater
+
+import (
+	"context"
+	"log"
+
+	"github.com/castyapp/grpc.server/config"
+	"github.com/castyapp/grpc.server/fetcher"
+	"github.com/castyapp/grpc.server/models"
+	"github.com/castyapp/grpc.server/probe"
+	"github.com/castyapp/libcasty-protocol-go/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// probedTypes are the media source types that ffprobe can read, the others
+// are played by their own players.
+var probedTypes = map[proto.MediaSource_Type]bool{
+	proto.MediaSource_DOWNLOAD_URI: true,
+	proto.MediaSource_M3U8:         true,
+}
+
+// probeMediaSource probes the uri of a media source and rejects the media that
+// the player can't play. Uris of our own storage are trusted, the others are
+// checked against internal addresses first and read through the address checking proxy
+// since ffprobe fetches them.
+// It returns nil when the media source type is not probed or ffprobe is missing.
+func (s *Service) probeMediaSource(ctx context.Context, mediaType proto.MediaSource_Type, uri string, trusted bool) (*models.MediaProbe, error) {
+
+	if !probedTypes[mediaType] {
+		return nil, nil
+	}
+
+	if !trusted {
+		if err := fetcher.CheckURL(ctx, uri); err != nil {
+			return nil, status.Error(codes.InvalidArgument, "Media source uri is not allowed!")
+		}
+	}
+
+	var (
+		cm     = s.MustGet("config.map").(*config.Map)
+		prober = &probe.Prober{Path: cm.Probe.FFprobePath, Timeout: cm.Probe.GetTimeout(), Trusted: trusted}
+	)
+
+	result, err := prober.Probe(ctx, uri)
+	switch err {
+	case nil:
+	case probe.ErrNotInstalled:
+		log.Println(err)
+		return nil, nil
+	case probe.ErrTimedOut:
+		return nil, status.Error(codes.DeadlineExceeded, "Reading the media source took too long!")
+	default:
+		return nil, status.Error(codes.InvalidArgument, "Could not read the media source!")
+	}
+
+	if cm.Probe.RejectUnplayable {
+		if err := probe.CheckPlayable(result); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "Media source can not be played, %s!", err.(*probe.UnplayableError).Reason)
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,329 @@
+package theater
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/castyapp/grpc.server/helpers"
+	"github.com/castyapp/grpc.server/models"
+	"github.com/castyapp/grpc.server/services/auth"
+	"github.com/castyapp/grpc.server/storage"
+	"github.com/castyapp/grpc.server/subtitles"
+	"github.com/castyapp/libcasty-protocol-go/proto"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+const maxSubtitleLabelLength = 50
+
+type UpdateSubtitleRequest struct {
+	AuthRequest   *proto.AuthenticateRequest
+	MediaSourceId string
+	SubtitleId    string
+	Label         string
+	Forced        bool
+	SDH           bool
+	// Default makes this the subtitle that players select first, the other
+	// subtitles of the media source are not default anymore
+	Default bool
+	// UpdateMask lists the fields that are updated, they can be label, forced, sdh and default
+	UpdateMask *fieldmaskpb.FieldMask
+}
+
+var updatableSubtitleFields = map[string]bool{
+	"label":   true,
+	"forced":  true,
+	"sdh":     true,
+	"default": true,
+}
+
+// SubtitleSettings are the fields of a subtitle that proto.Subtitle has no fields for yet,
+// they are returned next to it until the protocol has them.
+type SubtitleSettings struct {
+	Label    string
+	Forced   bool
+	SDH      bool
+	Default  bool
+	OffsetMs int64
+}
+
+type SubtitleResponse struct {
+	Status   string
+	Code     int64
+	Message  string
+	Result   *proto.Subtitle
+	Settings *SubtitleSettings
+}
+
+func newSubtitleResponse(subtitle *models.Subtitle, message string) *SubtitleResponse {
+	protoMsg, _ := helpers.NewSubtitleProto(subtitle)
+	return &SubtitleResponse{
+		Status:  "success",
+		Code:    http.StatusOK,
+		Message: message,
+		Result:  protoMsg,
+		Settings: &SubtitleSettings{
+			Label:    subtitle.Label,
+			Forced:   subtitle.Forced,
+			SDH:      subtitle.SDH,
+			Default:  subtitle.Default,
+			OffsetMs: subtitle.OffsetMs,
+		},
+	}
+}
+
+// SubtitleAnchor maps a time of the subtitle, in milliseconds, to the time it should be shown at.
+type SubtitleAnchor struct {
+	FromMs int64
+	ToMs   int64
+}
+
+type SyncSubtitleRequest struct {
+	AuthRequest   *proto.AuthenticateRequest
+	MediaSourceId string
+	SubtitleId    string
+	// OffsetMs shifts every cue, negative offsets show them earlier
+	OffsetMs int64
+	// Anchors stretches the cues between two points instead of shifting them
+	Anchors []*SubtitleAnchor
+}
+
+// findControlledSubtitle finds a subtitle of a media source that the user controls.
+func findControlledSubtitle(ctx context.Context, db *mongo.Database, user *models.User, mediaSourceID, subtitleID string) (*models.MediaSource, *models.Subtitle, error) {
+
+	var (
+		subtitle            = new(models.Subtitle)
+		subtitleObjectID, _ = primitive.ObjectIDFromHex(subtitleID)
+	)
+
+	mediaSource, err := findControlledMediaSource(ctx, db, user, mediaSourceID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	filter := bson.M{"_id": subtitleObjectID, "media_source_id": mediaSource.ID}
+	if err := db.Collection("subtitles").FindOne(ctx, filter).Decode(subtitle); err != nil {
+		return nil, nil, status.Error(codes.NotFound, "Could not find subtitle!")
+	}
+
+	return mediaSource, subtitle, nil
+}
+
+// UpdateSubtitle updates the fields of a subtitle that are listed in the update mask. A subtitle
+// that is made default replaces the default subtitle of the media source in a single transaction.
+func (s *Service) UpdateSubtitle(ctx context.Context, req *UpdateSubtitleRequest) (*SubtitleResponse, error) {
+
+	dbConn, err := s.Get("db.mongo")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		db             = dbConn.(*mongo.Database)
+		collection     = db.Collection("subtitles")
+		fields         = make(map[string]bool)
+		label          = strings.TrimSpace(req.Label)
+		failedResponse = status.Error(codes.Internal, "Could not update subtitle, Please try again later!")
+	)
+
+	user, err := auth.Authenticate(s.Context, req.AuthRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.UpdateMask == nil || len(req.UpdateMask.Paths) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Update mask is required!")
+	}
+
+	for _, path := range req.UpdateMask.Paths {
+		if !updatableSubtitleFields[path] {
+			return nil, status.Errorf(codes.InvalidArgument, "Field %s can not be updated!", path)
+		}
+		fields[path] = true
+	}
+
+	if fields["label"] && len([]rune(label)) > maxSubtitleLabelLength {
+		return nil, status.Errorf(codes.InvalidArgument, "Label can not be longer than %d characters!", maxSubtitleLabelLength)
+	}
+
+	mediaSource, subtitle, err := findControlledSubtitle(ctx, db, user, req.MediaSourceId, req.SubtitleId)
+	if err != nil {
+		return nil, err
+	}
+
+	set := bson.M{"updated_at": time.Now()}
+
+	if fields["label"] {
+		subtitle.Label = label
+		set["label"] = label
+	}
+
+	if fields["forced"] {
+		subtitle.Forced = req.Forced
+		set["forced"] = req.Forced
+	}
+
+	if fields["sdh"] {
+		subtitle.SDH = req.SDH
+		set["sdh"] = req.SDH
+	}
+
+	if fields["default"] {
+		subtitle.Default = req.Default
+		set["default"] = req.Default
+	}
+
+	subtitle.UpdatedAt = set["updated_at"].(time.Time)
+
+	_, err = helpers.WithTransaction(ctx, db, func(ctx context.Context) (interface{}, error) {
+		if _, err := collection.UpdateOne(ctx, bson.M{"_id": subtitle.ID}, bson.M{"$set": set}); err != nil {
+			return nil, err
+		}
+		if !fields["default"] || !req.Default {
+			return nil, nil
+		}
+		filter := bson.M{"media_source_id": mediaSource.ID, "_id": bson.M{"$ne": subtitle.ID}, "default": true}
+		return collection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"default": false}})
+	})
+	if err != nil {
+		log.Println(err)
+		return nil, failedResponse
+	}
+
+	helpers.SendMediaSourceChangedEvents(s.Context, db, mediaSource)
+
+	return newSubtitleResponse(subtitle, "Subtitle updated successfully!"), nil
+}
+
+// SyncSubtitle shifts or stretches the timings of a stored subtitle and saves it as a new version
+func (s *Service) SyncSubtitle(ctx context.Context, req *SyncSubtitleRequest) (*SubtitleResponse, error) {
+
+	dbConn, err := s.Get("db.mongo")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		db             = dbConn.(*mongo.Database)
+		failedResponse = status.Error(codes.Internal, "Could not sync subtitle, Please try again later!")
+	)
+
+	user, err := auth.Authenticate(s.Context, req.AuthRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(req.Anchors) != 0 && len(req.Anchors) != 2 {
+		return nil, status.Error(codes.InvalidArgument, "Two anchors are required to stretch a subtitle!")
+	}
+
+	if len(req.Anchors) == 0 && req.OffsetMs == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Offset or anchors are required!")
+	}
+
+	mediaSource, subtitle, err := findControlledSubtitle(ctx, db, user, req.MediaSourceId, req.SubtitleId)
+	if err != nil {
+		return nil, err
+	}
+
+	if subtitle.ObjectKey == "" {
+		return nil, status.Error(codes.FailedPrecondition, "Subtitle file is not stored on casty, add it again to sync it!")
+	}
+
+	data, err := readObject(storage.Buckets.Subtitles, subtitle.ObjectKey)
+	if err != nil {
+		log.Println(err)
+		return nil, failedResponse
+	}
+
+	// stored subtitles are always WebVTT
+	cues, _ := subtitles.ParseVTT(string(data))
+	offsetMs := subtitle.OffsetMs
+
+	if len(req.Anchors) == 2 {
+		var (
+			first  = subtitles.Anchor{From: time.Duration(req.Anchors[0].FromMs) * time.Millisecond, To: time.Duration(req.Anchors[0].ToMs) * time.Millisecond}
+			second = subtitles.Anchor{From: time.Duration(req.Anchors[1].FromMs) * time.Millisecond, To: time.Duration(req.Anchors[1].ToMs) * time.Millisecond}
+		)
+		if cues, err = subtitles.Stretch(cues, first, second); err != nil {
+			return nil, status.Error(codes.InvalidArgument, "Anchors should be two different points in increasing order!")
+		}
+	} else {
+		cues = subtitles.Shift(cues, time.Duration(req.OffsetMs)*time.Millisecond)
+		offsetMs += req.OffsetMs
+	}
+
+	if len(cues) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "No cues would be left in the subtitle!")
+	}
+
+	var (
+		version   = subtitle.Version + 1
+		objectKey = subtitles.ObjectKey(mediaSource.ID, subtitle.ID, version)
+		vtt       = subtitles.WebVTT(cues)
+	)
+
+	if err := storage.Client.Put(storage.Buckets.Subtitles, objectKey, bytes.NewReader(vtt), int64(len(vtt)), "text/vtt"); err != nil {
+		log.Println(err)
+		return nil, failedResponse
+	}
+
+	removeObject := func(key string) {
+		if err := storage.Client.Delete(storage.Buckets.Subtitles, key); err != nil {
+			log.Println(err)
+		}
+	}
+
+	var (
+		previousKey = subtitle.ObjectKey
+		// the version in the filter makes concurrent syncs of the same subtitle fail instead of overwriting each other
+		filter = bson.M{"_id": subtitle.ID, "version": subtitle.Version}
+		update = bson.M{
+			"$set": bson.M{
+				"file":       storage.ObjectURI(storage.Buckets.Subtitles, objectKey),
+				"object_key": objectKey,
+				"size":       int64(len(vtt)),
+				"offset_ms":  offsetMs,
+				"version":    version,
+				"updated_at": time.Now(),
+			},
+		}
+	)
+
+	if subtitle.Version == 0 {
+		filter["version"] = bson.M{"$exists": false}
+	}
+
+	result, err := db.Collection("subtitles").UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Println(err)
+		removeObject(objectKey)
+		return nil, failedResponse
+	}
+
+	if result.MatchedCount == 0 {
+		removeObject(objectKey)
+		return nil, status.Error(codes.Aborted, "Subtitle was changed in the meantime, Please try again!")
+	}
+
+	removeObject(previousKey)
+
+	subtitle.File = storage.ObjectURI(storage.Buckets.Subtitles, objectKey)
+	subtitle.ObjectKey = objectKey
+	subtitle.Size = int64(len(vtt))
+	subtitle.OffsetMs = offsetMs
+	subtitle.Version = version
+	subtitle.UpdatedAt = time.Now()
+
+	helpers.SendMediaSourceChangedEvents(s.Context, db, mediaSource)
+
+	return newSubtitleResponse(subtitle, "Subtitle synced successfully!"), nil
+}
@@ -1,23 +1,98 @@
 package theater
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"path"
 	"time"
 
+	"github.com/castyapp/grpc.server/fetcher"
 	"github.com/castyapp/grpc.server/helpers"
 	"github.com/castyapp/grpc.server/models"
 	"github.com/castyapp/grpc.server/services/auth"
+	"github.com/castyapp/grpc.server/storage"
+	"github.com/castyapp/grpc.server/subtitles"
 	"github.com/castyapp/libcasty-protocol-go/proto"
+	"github.com/golang/protobuf/ptypes/any"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
-// Get all subtitles from theater
+// maxReportedParseErrors bounds the invalid lines that are sent back when a subtitle is rejected
+const maxReportedParseErrors = 20
+
+// subtitleValidationError reports why a subtitle file was rejected, with the
+// lines that could not be parsed as details.
+func subtitleValidationError(result *subtitles.Result, err error) error {
+	details := []*any.Any{{
+		TypeUrl: "file",
+		Value:   []byte(err.Error()),
+	}}
+	if result != nil {
+		for i, parseErr := range result.Errors {
+			if i == maxReportedParseErrors {
+				break
+			}
+			details = append(details, &any.Any{
+				TypeUrl: "file",
+				Value:   []byte(parseErr.Error()),
+			})
+		}
+	}
+	return status.ErrorProto(&spb.Status{
+		Code:    int32(codes.InvalidArgument),
+		Message: "Validation Error!",
+		Details: details,
+	})
+}
+
+// storeSubtitle normalises the subtitle file to WebVTT and puts it in the subtitles bucket.
+func storeSubtitle(key string, data []byte, filename, lang string) (*subtitles.Result, int64, error) {
+
+	result, err := subtitles.Process(data, filename, lang)
+	if err != nil {
+		return nil, 0, subtitleValidationError(result, err)
+	}
+
+	vtt := subtitles.WebVTT(result.Cues)
+	if err := storage.Client.Put(storage.Buckets.Subtitles, key, bytes.NewReader(vtt), int64(len(vtt)), "text/vtt"); err != nil {
+		log.Println(err)
+		return nil, 0, status.Error(codes.Internal, "Could not store the subtitle, Please try again later!")
+	}
+
+	return result, int64(len(vtt)), nil
+}
+
+// isSubtitleURL tells if the subtitle file is an url that it's downloaded from.
+func isSubtitleURL(file string) bool {
+	uri, err := url.Parse(file)
+	return err == nil && (uri.Scheme == "http" || uri.Scheme == "https") && uri.Host != ""
+}
+
+// fetchSubtitle downloads a subtitle file that was added by its url.
+func fetchSubtitle(ctx context.Context, file string) ([]byte, error) {
+
+	resp, err := fetcher.New(fetcher.Options{MaxBytes: subtitles.MaxSize}).Fetch(ctx, file)
+	switch err {
+	case nil:
+		return resp.Data, nil
+	case fetcher.ErrTooLarge:
+		return nil, status.Error(codes.InvalidArgument, "Subtitle file is too large!")
+	default:
+		return nil, status.Error(codes.InvalidArgument, "Could not download the subtitle file!")
+	}
+}
+
+// Add subtitles to a media source, the files that are http or https urls are downloaded and
+// stored as WebVTT, other files are kept as they are given like they always were
 func (s *Service) AddSubtitles(ctx context.Context, req *proto.AddSubtitlesRequest) (*proto.SubtitlesResponse, error) {
 
 	dbConn, err := s.Get("db.mongo")
@@ -26,12 +101,13 @@ func (s *Service) AddSubtitles(ctx context.Context, req *proto.AddSubtitlesReque
 	}
 
 	var (
-		db                     = dbConn.(*mongo.Database)
-		insertMap              = make([]interface{}, 0)
-		mediaSource            = new(models.MediaSource)
-		mediaSourcesCollection = db.Collection("media_sources")
-		subtitlesCollection    = db.Collection("subtitles")
-		failedResponse         = status.Error(codes.Internal, "Could not add subtitles, Please try again later!")
+		db                  = dbConn.(*mongo.Database)
+		insertMap           = make([]interface{}, 0)
+		storedKeys          = make([]string, 0)
+		added               = make([]*proto.Subtitle, 0)
+		skippedLines        = 0
+		subtitlesCollection = db.Collection("subtitles")
+		failedResponse      = status.Error(codes.Internal, "Could not add subtitles, Please try again later!")
 	)
 
 	user, err := auth.Authenticate(s.Context, req.AuthRequest)
@@ -39,38 +115,127 @@ func (s *Service) AddSubtitles(ctx context.Context, req *proto.AddSubtitlesReque
 		return nil, err
 	}
 
-	var (
-		mediaSourceObjectID, _ = primitive.ObjectIDFromHex(req.MediaSourceId)
-		findFilter             = bson.M{
-			"_id":     mediaSourceObjectID,
-			"user_id": user.ID,
-		}
-	)
+	mediaSource, err := findControlledMediaSource(ctx, db, user, req.MediaSourceId)
+	if err != nil {
+		return nil, err
+	}
 
-	if err := mediaSourcesCollection.FindOne(ctx, findFilter).Decode(mediaSource); err != nil {
-		return nil, status.Error(codes.NotFound, "Could not find media source!")
+	removeStored := func() {
+		for _, key := range storedKeys {
+			if err := storage.Client.Delete(storage.Buckets.Subtitles, key); err != nil {
+				log.Println(err)
+			}
+		}
 	}
 
 	for _, subtitle := range req.Subtitles {
+
+		var (
+			now        = time.Now()
+			subtitleID = primitive.NewObjectID()
+			objectKey  = subtitles.ObjectKey(mediaSource.ID, &subtitleID, 1)
+		)
+
+		if subtitle.File == "" {
+			removeStored()
+			return nil, status.Error(codes.InvalidArgument, "Subtitle file is required!")
+		}
+
+		// uris of our own buckets would be presigned for whoever added them
+		if _, _, ok := storage.ParseObjectURI(subtitle.File); ok {
+			removeStored()
+			return nil, status.Error(codes.InvalidArgument, "Subtitle file is invalid!")
+		}
+
+		if !isSubtitleURL(subtitle.File) {
+			dbSubtitle := &models.Subtitle{
+				ID:            &subtitleID,
+				MediaSourceID: mediaSource.ID,
+				Lang:          subtitle.Lang,
+				File:          subtitle.File,
+				CreatedAt:     now,
+				UpdatedAt:     now,
+			}
+			insertMap = append(insertMap, bson.M{
+				"_id":             subtitleID,
+				"user_id":         user.ID,
+				"media_source_id": dbSubtitle.MediaSourceID,
+				"file":            dbSubtitle.File,
+				"lang":            dbSubtitle.Lang,
+				"created_at":      now,
+				"updated_at":      now,
+			})
+			if protoMsg, err := helpers.NewSubtitleProto(dbSubtitle); err == nil {
+				added = append(added, protoMsg)
+			}
+			continue
+		}
+
+		data, err := fetchSubtitle(ctx, subtitle.File)
+		if err != nil {
+			removeStored()
+			return nil, err
+		}
+
+		result, size, err := storeSubtitle(objectKey, data, path.Base(subtitle.File), subtitle.Lang)
+		if err != nil {
+			removeStored()
+			return nil, err
+		}
+
+		storedKeys = append(storedKeys, objectKey)
+		skippedLines += len(result.Errors)
+
+		dbSubtitle := &models.Subtitle{
+			ID:            &subtitleID,
+			MediaSourceID: mediaSource.ID,
+			Lang:          subtitle.Lang,
+			File:          storage.ObjectURI(storage.Buckets.Subtitles, objectKey),
+			ObjectKey:     objectKey,
+			Size:          size,
+			Version:       1,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+
 		insertMap = append(insertMap, bson.M{
+			"_id":             subtitleID,
 			"user_id":         user.ID,
-			"media_source_id": mediaSource.ID,
-			"file":            subtitle.File,
-			"lang":            subtitle.Lang,
-			"created_at":      time.Now(),
-			"updated_at":      time.Now(),
+			"media_source_id": dbSubtitle.MediaSourceID,
+			"file":            dbSubtitle.File,
+			"lang":            dbSubtitle.Lang,
+			"object_key":      dbSubtitle.ObjectKey,
+			"size":            dbSubtitle.Size,
+			"version":         dbSubtitle.Version,
+			"created_at":      now,
+			"updated_at":      now,
 		})
+
+		if protoMsg, err := helpers.NewSubtitleProto(dbSubtitle); err == nil {
+			added = append(added, protoMsg)
+		}
+	}
+
+	if len(insertMap) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Subtitles are required!")
 	}
 
 	if _, err := subtitlesCollection.InsertMany(ctx, insertMap); err != nil {
 		log.Println(err)
+		removeStored()
 		return nil, failedResponse
 	}
 
+	message := "Subtitle added successfully!"
+	if skippedLines > 0 {
+		message = fmt.Sprintf("Subtitle added successfully, %d invalid lines were skipped!", skippedLines)
+	}
+
 	return &proto.SubtitlesResponse{
 		Status:  "success",
 		Code:    http.StatusOK,
-		Message: "Subtitle added successfully!",
+		Message: message,
+		Result:  added,
 	}, nil
 }
 
@@ -163,7 +328,6 @@ func (s *Service) RemoveSubtitle(ctx context.Context, req *proto.RemoveSubtitleR
 
 	var (
 		db             = dbConn.(*mongo.Database)
-		mediaSource    = new(models.Theater)
 		collection     = db.Collection("subtitles")
 		failedResponse = status.Error(codes.Internal, "Could not remove subtitle, Please try again later!")
 	)
@@ -173,16 +337,9 @@ func (s *Service) RemoveSubtitle(ctx context.Context, req *proto.RemoveSubtitleR
 		return nil, err
 	}
 
-	var (
-		mediaSourceObjectID, _ = primitive.ObjectIDFromHex(req.MediaSourceId)
-		findFilter             = bson.M{
-			"_id":     mediaSourceObjectID,
-			"user_id": user.ID,
-		}
-	)
-
-	if err := db.Collection("media_sources").FindOne(ctx, findFilter).Decode(mediaSource); err != nil {
-		return nil, status.Error(codes.NotFound, "Could not find media source!")
+	mediaSource, err := findControlledMediaSource(ctx, db, user, req.MediaSourceId)
+	if err != nil {
+		return nil, err
 	}
 
 	var (
@@ -193,11 +350,17 @@ func (s *Service) RemoveSubtitle(ctx context.Context, req *proto.RemoveSubtitleR
 		}
 	)
 
-	result, err := collection.DeleteOne(ctx, filter)
-	if err != nil || result.DeletedCount != 1 {
+	subtitle := new(models.Subtitle)
+	if err := collection.FindOneAndDelete(ctx, filter).Decode(subtitle); err != nil {
 		return nil, failedResponse
 	}
 
+	if subtitle.ObjectKey != "" {
+		if err := storage.Client.Delete(storage.Buckets.Subtitles, subtitle.ObjectKey); err != nil {
+			log.Println(err)
+		}
+	}
+
 	return &proto.Response{
 		Status:  "success",
 		Code:    http.StatusOK,
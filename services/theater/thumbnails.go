@@ -0,0 +1,150 @@
+package theater
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"path"
+
+	"github.com/castyapp/grpc.server/config"
+	"github.com/castyapp/grpc.server/helpers"
+	"github.com/castyapp/grpc.server/models"
+	"github.com/castyapp/grpc.server/services/auth"
+	"github.com/castyapp/grpc.server/storage"
+	"github.com/castyapp/grpc.server/thumbnails"
+	"github.com/castyapp/libcasty-protocol-go/proto"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ThumbnailTrack is the WebVTT thumbnail track of a media source, its cues point at the
+// presigned urls of the sprite sheets, which expire with the urls of the stored media.
+type ThumbnailTrack struct {
+	WebVTT string
+	// Interval between two previews in seconds
+	Interval float64
+	Width    int
+	Height   int
+}
+
+type ThumbnailsResponse struct {
+	Status string
+	Code   int64
+	Result *ThumbnailTrack
+}
+
+// findSharedMediaSource finds the media source of the request when it's shared with
+// the user, media sources are shared with their owners and with the members of the
+// theaters that are playing them.
+func (s *Service) findSharedMediaSource(ctx context.Context, db *mongo.Database, req *proto.MediaSourceAuthRequest) (*models.MediaSource, error) {
+
+	mediaSource := new(models.MediaSource)
+
+	user, err := auth.Authenticate(s.Context, req.AuthRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Media == nil {
+		return nil, status.Error(codes.InvalidArgument, "Media source is required!")
+	}
+
+	mediaSourceObjectID, err := primitive.ObjectIDFromHex(req.Media.Id)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, "Could not parse media source id!")
+	}
+
+	if err := db.Collection("media_sources").FindOne(ctx, bson.M{"_id": mediaSourceObjectID}).Decode(mediaSource); err != nil {
+		return nil, status.Error(codes.NotFound, "Could not find media source!")
+	}
+
+	if mediaSource.UserID.Hex() == user.ID.Hex() {
+		return mediaSource, nil
+	}
+
+	cursor, err := db.Collection("theaters").Find(ctx, bson.M{"media_source_id": mediaSource.ID})
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Could not find media source, Please try again later!")
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		theater := new(models.Theater)
+		if err := cursor.Decode(theater); err != nil {
+			continue
+		}
+		if theater.UserID.Hex() == user.ID.Hex() {
+			return mediaSource, nil
+		}
+		if theater.Privacy == proto.PRIVACY_PRIVATE {
+			continue
+		}
+		if blocked, err := helpers.IsBlocked(ctx, db, user.ID, theater.UserID); err != nil || blocked {
+			continue
+		}
+		if member, err := helpers.IsTheaterMember(ctx, db, theater, user.ID); err == nil && member {
+			return mediaSource, nil
+		}
+	}
+
+	return nil, status.Error(codes.NotFound, "Could not find media source!")
+}
+
+// GetThumbnails returns the seek previews of a media source, to its owner and to the
+// members of the theaters that are playing it
+func (s *Service) GetThumbnails(ctx context.Context, req *proto.MediaSourceAuthRequest) (*ThumbnailsResponse, error) {
+
+	dbConn, err := s.Get("db.mongo")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		db             = dbConn.(*mongo.Database)
+		cm             = s.MustGet("config.map").(*config.Map)
+		bucket         = cm.Uploads.GetBucket()
+		failedResponse = status.Error(codes.Internal, "Could not get the seek previews, Please try again later!")
+	)
+
+	mediaSource, err := s.findSharedMediaSource(ctx, db, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if mediaSource.Thumbnails == nil {
+		return nil, status.Error(codes.NotFound, "Media source has no seek previews yet!")
+	}
+
+	urls := make(map[string]string, len(mediaSource.Thumbnails.Sprites))
+	for _, sprite := range mediaSource.Thumbnails.Sprites {
+		url, err := storage.Client.Presign(http.MethodGet, bucket, sprite, storage.ReadURLExpiry)
+		if err == storage.ErrPresignNotSupported {
+			return nil, status.Error(codes.Unimplemented, "Seek previews are not supported by the storage!")
+		}
+		if err != nil {
+			log.Println(err)
+			return nil, failedResponse
+		}
+		urls[path.Base(sprite)] = url
+	}
+
+	track, err := readObject(bucket, mediaSource.Thumbnails.Track)
+	if err != nil {
+		log.Println(err)
+		return nil, failedResponse
+	}
+
+	return &ThumbnailsResponse{
+		Status: "success",
+		Code:   http.StatusOK,
+		Result: &ThumbnailTrack{
+			WebVTT:   string(thumbnails.ResolveSprites(track, urls)),
+			Interval: mediaSource.Thumbnails.Interval,
+			Width:    mediaSource.Thumbnails.Width,
+			Height:   mediaSource.Thumbnails.Height,
+		},
+	}, nil
+}
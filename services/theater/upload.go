@@ -0,0 +1,427 @@
+package theater
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/castyapp/grpc.server/config"
+	"github.com/castyapp/grpc.server/helpers"
+	"github.com/castyapp/grpc.server/models"
+	"github.com/castyapp/grpc.server/services/auth"
+	"github.com/castyapp/grpc.server/storage"
+	"github.com/castyapp/grpc.server/subtitles"
+	"github.com/castyapp/grpc.server/uploads"
+	"github.com/castyapp/libcasty-protocol-go/proto"
+	"github.com/golang/protobuf/ptypes/any"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type CreateUploadRequest struct {
+	AuthRequest *proto.AuthenticateRequest
+	Kind        models.UploadKind
+	Filename    string
+	ContentType string
+	Size        int64
+	// MediaSourceId and Lang are required for subtitle uploads
+	MediaSourceId string
+	Lang          string
+}
+
+type UploadURL struct {
+	UploadId  string
+	URL       string
+	ObjectKey string
+	ExpiresAt time.Time
+}
+
+type CreateUploadResponse struct {
+	Status  string
+	Code    int64
+	Message string
+	Result  *UploadURL
+}
+
+type CompleteUploadRequest struct {
+	AuthRequest *proto.AuthenticateRequest
+	UploadId    string
+	// Title and Artist of the media source that is created for video and audio uploads
+	Title  string
+	Artist string
+}
+
+type CompleteUploadResponse struct {
+	Status      string
+	Code        int64
+	Message     string
+	MediaSource *proto.MediaSource
+	Subtitle    *proto.Subtitle
+}
+
+func (s *Service) CreateUpload(ctx context.Context, req *CreateUploadRequest) (*CreateUploadResponse, error) {
+
+	dbConn, err := s.Get("db.mongo")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		db               = dbConn.(*mongo.Database)
+		cm               = s.MustGet("config.map").(*config.Map)
+		validationErrors []*any.Any
+		mediaSourceID    *primitive.ObjectID
+		failedResponse   = status.Error(codes.Internal, "Could not create the upload, Please try again later!")
+	)
+
+	user, err := auth.Authenticate(s.Context, req.AuthRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	switch err := uploads.CheckContentType(req.Kind, req.ContentType); err {
+	case nil:
+	case uploads.ErrInvalidKind:
+		validationErrors = append(validationErrors, &any.Any{
+			TypeUrl: "kind",
+			Value:   []byte("Upload kind should be one of video, audio or subtitle!"),
+		})
+	default:
+		validationErrors = append(validationErrors, &any.Any{
+			TypeUrl: "content_type",
+			Value:   []byte("Content type is not allowed!"),
+		})
+	}
+
+	if req.Size <= 0 {
+		validationErrors = append(validationErrors, &any.Any{
+			TypeUrl: "size",
+			Value:   []byte("Size is required!"),
+		})
+	}
+
+	if maxFileSize := cm.Uploads.GetMaxFileSize(); req.Size > maxFileSize {
+		validationErrors = append(validationErrors, &any.Any{
+			TypeUrl: "size",
+			Value:   []byte(fmt.Sprintf("File can not be larger than %d MB!", maxFileSize>>20)),
+		})
+	}
+
+	if req.Kind == models.UploadKindSubtitle {
+		if strings.TrimSpace(req.Lang) == "" {
+			validationErrors = append(validationErrors, &any.Any{
+				TypeUrl: "lang",
+				Value:   []byte("Lang is required!"),
+			})
+		}
+		mediaSource, err := findControlledMediaSource(ctx, db, user, req.MediaSourceId)
+		if err != nil {
+			return nil, err
+		}
+		mediaSourceID = mediaSource.ID
+	}
+
+	if len(validationErrors) > 0 {
+		return nil, status.ErrorProto(&spb.Status{
+			Code:    int32(codes.InvalidArgument),
+			Message: "Validation Error!",
+			Details: validationErrors,
+		})
+	}
+
+	var (
+		now       = time.Now()
+		uploadID  = primitive.NewObjectID()
+		bucket    = cm.Uploads.GetBucket()
+		expiry    = cm.Uploads.GetURLExpiry()
+		objectKey = uploads.ObjectKey(user.ID, &uploadID, req.Kind, req.Filename)
+	)
+
+	presignedURL, err := storage.Client.Presign(http.MethodPut, bucket, objectKey, expiry)
+	if err == storage.ErrPresignNotSupported {
+		return nil, status.Error(codes.Unimplemented, "Direct uploads are not supported by the storage!")
+	}
+	if err != nil {
+		log.Println(err)
+		return nil, failedResponse
+	}
+
+	upload := &models.Upload{
+		ID:            &uploadID,
+		UserID:        user.ID,
+		Kind:          req.Kind,
+		Status:        models.UploadStatusPending,
+		Bucket:        bucket,
+		ObjectKey:     objectKey,
+		Filename:      req.Filename,
+		ContentType:   req.ContentType,
+		DeclaredSize:  req.Size,
+		MediaSourceID: mediaSourceID,
+		Lang:          req.Lang,
+		ExpiresAt:     now.Add(expiry),
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	switch err := uploads.Reserve(ctx, db, upload, cm.Uploads.GetUserQuota()); err {
+	case nil:
+	case uploads.ErrQuotaExceeded:
+		return nil, status.Error(codes.ResourceExhausted, "You have reached your upload quota!")
+	default:
+		log.Println(err)
+		return nil, failedResponse
+	}
+
+	return &CreateUploadResponse{
+		Status:  "success",
+		Code:    http.StatusOK,
+		Message: "Upload created successfully!",
+		Result: &UploadURL{
+			UploadId:  uploadID.Hex(),
+			URL:       presignedURL,
+			ObjectKey: objectKey,
+			ExpiresAt: upload.ExpiresAt,
+		},
+	}, nil
+}
+
+// rejectUpload removes the uploaded object and the upload, so it does not count toward the quota anymore.
+func rejectUpload(ctx context.Context, db *mongo.Database, upload *models.Upload) {
+	if err := storage.Client.Delete(upload.Bucket, upload.ObjectKey); err != nil {
+		log.Printf("could not remove rejected upload [%s]: %v", upload.ObjectKey, err)
+	}
+	if _, err := db.Collection("uploads").DeleteOne(ctx, bson.M{"_id": upload.ID}); err != nil {
+		log.Println(err)
+	}
+}
+
+// readObject reads a whole object, only used for small files like subtitles.
+func readObject(bucket, key string) ([]byte, error) {
+	reader, _, err := storage.Client.Get(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
+
+func (s *Service) CompleteUpload(ctx context.Context, req *CompleteUploadRequest) (*CompleteUploadResponse, error) {
+
+	dbConn, err := s.Get("db.mongo")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		db             = dbConn.(*mongo.Database)
+		cm             = s.MustGet("config.map").(*config.Map)
+		upload         = new(models.Upload)
+		now            = time.Now()
+		response       = &CompleteUploadResponse{Status: "success", Code: http.StatusOK, Message: "Upload completed successfully!"}
+		failedResponse = status.Error(codes.Internal, "Could not complete the upload, Please try again later!")
+	)
+
+	user, err := auth.Authenticate(s.Context, req.AuthRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	uploadID, err := primitive.ObjectIDFromHex(req.UploadId)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "Upload id is invalid!")
+	}
+
+	var (
+		filter = bson.M{
+			"_id":     uploadID,
+			"user_id": user.ID,
+			"status":  models.UploadStatusPending,
+		}
+		claim = bson.M{"$set": bson.M{"status": models.UploadStatusCompleting, "updated_at": now}}
+	)
+
+	// the upload is claimed first, so concurrent calls do not register the same object twice
+	if err := db.Collection("uploads").FindOneAndUpdate(ctx, filter, claim).Decode(upload); err != nil {
+		return nil, status.Error(codes.NotFound, "Could not find the upload!")
+	}
+
+	completed := false
+	defer func() {
+		if completed {
+			return
+		}
+		// a failed completion can be tried again, rejected uploads are already removed
+		release := bson.M{"$set": bson.M{"status": models.UploadStatusPending}}
+		if _, err := db.Collection("uploads").UpdateOne(ctx, bson.M{"_id": upload.ID, "status": models.UploadStatusCompleting}, release); err != nil {
+			log.Println(err)
+		}
+	}()
+
+	info, err := storage.Client.Stat(upload.Bucket, upload.ObjectKey)
+	if err == storage.ErrNotFound {
+		return nil, status.Error(codes.FailedPrecondition, "The file is not uploaded yet!")
+	}
+	if err != nil {
+		return nil, failedResponse
+	}
+
+	if info.Size > upload.DeclaredSize || info.Size > cm.Uploads.GetMaxFileSize() {
+		rejectUpload(ctx, db, upload)
+		return nil, status.Error(codes.InvalidArgument, "Uploaded file is larger than the declared size!")
+	}
+
+	if err := uploads.CheckContentType(upload.Kind, info.ContentType); err != nil {
+		rejectUpload(ctx, db, upload)
+		return nil, status.Error(codes.InvalidArgument, "Content type of the uploaded file is not allowed!")
+	}
+
+	var mediaProbe *models.MediaProbe
+	if upload.Kind != models.UploadKindSubtitle {
+		// ffprobe reads the object with a short-lived url, backends without presigning are not probed
+		readURL, err := storage.Client.Presign(http.MethodGet, upload.Bucket, upload.ObjectKey, 10*time.Minute)
+		if err == nil {
+			mediaProbe, err = s.probeMediaSource(ctx, proto.MediaSource_DOWNLOAD_URI, readURL, true)
+			if err != nil {
+				if status.Code(err) == codes.InvalidArgument {
+					rejectUpload(ctx, db, upload)
+				}
+				return nil, err
+			}
+		}
+	}
+
+	uri := storage.ObjectURI(upload.Bucket, upload.ObjectKey)
+	update := bson.M{
+		"status":     models.UploadStatusCompleted,
+		"size":       info.Size,
+		"updated_at": now,
+	}
+
+	switch upload.Kind {
+	case models.UploadKindSubtitle:
+		if info.Size > subtitles.MaxSize {
+			rejectUpload(ctx, db, upload)
+			return nil, status.Error(codes.InvalidArgument, "Subtitle file is too large!")
+		}
+		data, err := readObject(upload.Bucket, upload.ObjectKey)
+		if err != nil {
+			log.Println(err)
+			return nil, failedResponse
+		}
+		var (
+			subtitleID = primitive.NewObjectID()
+			objectKey  = subtitles.ObjectKey(upload.MediaSourceID, &subtitleID, 1)
+		)
+		_, size, err := storeSubtitle(objectKey, data, upload.Filename, upload.Lang)
+		if err != nil {
+			if status.Code(err) == codes.InvalidArgument {
+				rejectUpload(ctx, db, upload)
+			}
+			return nil, err
+		}
+		subtitle := &models.Subtitle{
+			ID:            &subtitleID,
+			MediaSourceID: upload.MediaSourceID,
+			Lang:          upload.Lang,
+			File:          storage.ObjectURI(storage.Buckets.Subtitles, objectKey),
+			ObjectKey:     objectKey,
+			Size:          size,
+			Version:       1,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+		_, err = db.Collection("subtitles").InsertOne(ctx, bson.M{
+			"_id":             subtitleID,
+			"user_id":         user.ID,
+			"media_source_id": subtitle.MediaSourceID,
+			"file":            subtitle.File,
+			"lang":            subtitle.Lang,
+			"object_key":      subtitle.ObjectKey,
+			"size":            subtitle.Size,
+			"version":         subtitle.Version,
+			"created_at":      now,
+			"updated_at":      now,
+		})
+		if err != nil {
+			if err := storage.Client.Delete(storage.Buckets.Subtitles, objectKey); err != nil {
+				log.Println(err)
+			}
+			return nil, failedResponse
+		}
+		// the original file is not needed anymore, the subtitle is served from the WebVTT copy
+		if err := storage.Client.Delete(upload.Bucket, upload.ObjectKey); err != nil {
+			log.Println(err)
+		}
+		update["subtitle_id"] = subtitleID
+		response.Subtitle, _ = helpers.NewSubtitleProto(subtitle)
+	default:
+		title := strings.TrimSpace(req.Title)
+		if title == "" {
+			title = upload.Filename
+		}
+		mediaSource := &models.MediaSource{
+			UserID:    user.ID,
+			Title:     title,
+			Type:      proto.MediaSource_DOWNLOAD_URI,
+			Banner:    "default",
+			URI:       uri,
+			Artist:    req.Artist,
+			ObjectKey: upload.ObjectKey,
+			Size:      info.Size,
+			Probe:     mediaProbe,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if mediaProbe != nil {
+			mediaSource.Length = int64(mediaProbe.Duration)
+		}
+		document := bson.M{
+			"title":      mediaSource.Title,
+			"type":       mediaSource.Type,
+			"banner":     mediaSource.Banner,
+			"uri":        mediaSource.URI,
+			"artist":     mediaSource.Artist,
+			"object_key": mediaSource.ObjectKey,
+			"size":       mediaSource.Size,
+			"length":     mediaSource.Length,
+			"user_id":    user.ID,
+			"created_at": now,
+			"updated_at": now,
+		}
+		if mediaProbe != nil {
+			document["probe"] = mediaProbe
+		}
+		result, err := db.Collection("media_sources").InsertOne(ctx, document)
+		if err != nil {
+			return nil, failedResponse
+		}
+		mediaSourceID := result.InsertedID.(primitive.ObjectID)
+		mediaSource.ID = &mediaSourceID
+		update["media_source_id"] = mediaSourceID
+		// the media source works without its tracks and previews, so a failed enqueue only gets logged
+		if err := enqueueMediaJob(ctx, db, mediaSource, models.MediaJobExtractTracks); err != nil {
+			log.Println(err)
+		}
+		if upload.Kind == models.UploadKindVideo {
+			if err := enqueueMediaJob(ctx, db, mediaSource, models.MediaJobThumbnails); err != nil {
+				log.Println(err)
+			}
+		}
+		response.MediaSource = helpers.NewMediaSourceProto(mediaSource)
+	}
+
+	if _, err := db.Collection("uploads").UpdateOne(ctx, bson.M{"_id": upload.ID}, bson.M{"$set": update}); err != nil {
+		log.Println(err)
+	}
+
+	completed = true
+	return response, nil
+}
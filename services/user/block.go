@@ -0,0 +1,172 @@
+package user
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/castyapp/grpc.server/helpers"
+	"github.com/castyapp/grpc.server/models"
+	"github.com/castyapp/grpc.server/services/auth"
+	"github.com/castyapp/libcasty-protocol-go/proto"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *Service) findUserByIDOrUsername(ctx context.Context, db *mongo.Database, idOrUsername string) (*models.User, error) {
+
+	objectID, err := primitive.ObjectIDFromHex(idOrUsername)
+	if err != nil {
+		return helpers.FindUserByUsername(ctx, db, idOrUsername)
+	}
+
+	dbUser := new(models.User)
+	if err := db.Collection("users").FindOne(ctx, bson.M{"_id": objectID}).Decode(dbUser); err != nil {
+		return nil, err
+	}
+
+	return dbUser, nil
+}
+
+func (s *Service) BlockUser(ctx context.Context, req *proto.FriendRequest) (*proto.Response, error) {
+
+	dbConn, err := s.Get("db.mongo")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		db               = dbConn.(*mongo.Database)
+		blocksCollection = db.Collection("blocks")
+		failedResponse   = status.Error(codes.Internal, "Could not block the user, Please try again later!")
+	)
+
+	user, err := auth.Authenticate(s.Context, req.AuthRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	blockedUser, err := s.findUserByIDOrUsername(ctx, db, req.FriendId)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, "Could not find the user!")
+	}
+
+	if blockedUser.ID.Hex() == user.ID.Hex() {
+		return nil, status.Error(codes.InvalidArgument, "You can not block yourself!")
+	}
+
+	block := bson.M{
+		"user_id":         user.ID,
+		"blocked_user_id": blockedUser.ID,
+		"created_at":      time.Now(),
+	}
+
+	// blocks are unique per user, blocking the user again runs into the block
+	result, err := blocksCollection.InsertOne(ctx, block)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, status.Error(codes.Aborted, "User is blocked already!")
+		}
+		return nil, failedResponse
+	}
+
+	// a block never leaves the friendship in place, the block is taken back when it could not be removed
+	if err := s.removeFriendship(ctx, db, user, blockedUser); err != nil {
+		log.Println(err)
+		if _, err := blocksCollection.DeleteOne(ctx, bson.M{"_id": result.InsertedID}); err != nil {
+			log.Println(err)
+		}
+		return nil, failedResponse
+	}
+
+	return &proto.Response{
+		Status:  "success",
+		Code:    http.StatusOK,
+		Message: "User blocked successfully!",
+	}, nil
+}
+
+func (s *Service) UnblockUser(ctx context.Context, req *proto.FriendRequest) (*proto.Response, error) {
+
+	dbConn, err := s.Get("db.mongo")
+	if err != nil {
+		return nil, err
+	}
+
+	db := dbConn.(*mongo.Database)
+
+	user, err := auth.Authenticate(s.Context, req.AuthRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	blockedUser, err := s.findUserByIDOrUsername(ctx, db, req.FriendId)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, "Could not find the user!")
+	}
+
+	filter := bson.M{
+		"user_id":         user.ID,
+		"blocked_user_id": blockedUser.ID,
+	}
+
+	result, err := db.Collection("blocks").DeleteOne(ctx, filter)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Could not unblock the user, Please try again later!")
+	}
+
+	if result.DeletedCount == 0 {
+		return nil, status.Error(codes.NotFound, "User is not blocked!")
+	}
+
+	return &proto.Response{
+		Status:  "success",
+		Code:    http.StatusOK,
+		Message: "User unblocked successfully!",
+	}, nil
+}
+
+func (s *Service) GetBlockedUsers(ctx context.Context, req *proto.AuthenticateRequest) (*proto.FriendsResponse, error) {
+
+	dbConn, err := s.Get("db.mongo")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		db           = dbConn.(*mongo.Database)
+		blockedUsers = make([]*proto.User, 0)
+	)
+
+	user, err := auth.Authenticate(s.Context, req)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := db.Collection("blocks").Find(ctx, bson.M{"user_id": user.ID})
+	if err != nil {
+		return nil, status.Error(codes.NotFound, "Could not find blocked users!")
+	}
+
+	for cursor.Next(ctx) {
+		block := new(models.Block)
+		if err := cursor.Decode(block); err != nil {
+			continue
+		}
+		blockedUser := new(models.User)
+		if err := db.Collection("users").FindOne(ctx, bson.M{"_id": block.BlockedUserID}).Decode(blockedUser); err != nil {
+			continue
+		}
+		blockedUsers = append(blockedUsers, helpers.NewProtoUser(blockedUser, models.RelationStranger))
+	}
+
+	return &proto.FriendsResponse{
+		Status: "success",
+		Code:   http.StatusOK,
+		Result: blockedUsers,
+	}, nil
+}
@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/castyapp/grpc.server/helpers"
 	"github.com/castyapp/grpc.server/jwt"
 	"github.com/castyapp/grpc.server/models"
 	"github.com/castyapp/grpc.server/services"
@@ -22,21 +23,6 @@ import (
 	"google.golang.org/grpc/status"
 )
 
-var invalidUsernames = []string{
-	"login",
-	"logout",
-	"register",
-	"iforgot",
-	"settings",
-	"messages",
-	"home",
-	"me",
-	"profile",
-	"callback",
-	"oauth",
-	"terms",
-}
-
 func (s *Service) CreateUser(ctx context.Context, req *proto.CreateUserRequest) (*proto.AuthResponse, error) {
 
 	dbConn, err := s.Get("db.mongo")
@@ -53,32 +39,17 @@ func (s *Service) CreateUser(ctx context.Context, req *proto.CreateUserRequest)
 		thCollection     = db.Collection("theaters")
 	)
 
-	for _, invalid := range invalidUsernames {
-		if req.User.Username == invalid {
-			return nil, status.ErrorProto(&spb.Status{
-				Code:    int32(codes.InvalidArgument),
-				Message: "Validation Error!",
-				Details: []*any.Any{
-					{
-						TypeUrl: "username",
-						Value:   []byte("Username is not available!"),
-					},
-				},
-			})
-		}
+	if err := validateUsername(user.Username); err != nil {
+		return nil, err
 	}
 
-	if strings.Contains(user.Username, "/") {
-		return nil, status.ErrorProto(&spb.Status{
-			Code:    int32(codes.InvalidArgument),
-			Message: "Validation Error!",
-			Details: []*any.Any{
-				{
-					TypeUrl: "username",
-					Value:   []byte("Username is not available!"),
-				},
-			},
-		})
+	reserved, err := helpers.IsUsernameReserved(ctx, db, user.Username, nil)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Could not create the user, Please try again later!")
+	}
+
+	if reserved {
+		return nil, usernameValidationError("Username is not available!")
 	}
 
 	if err := collection.FindOne(ctx, bson.M{"username": user.Username}).Decode(existsUser); err != nil {
@@ -133,6 +104,10 @@ func (s *Service) CreateUser(ctx context.Context, req *proto.CreateUserRequest)
 
 	result, err := collection.InsertOne(ctx, dbUser)
 	if err != nil {
+		// the username was taken by another registration in the meantime
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, usernameValidationError("Username already exists!")
+		}
 		log.Println(err)
 		return nil, status.Error(codes.Internal, "Could not create the user, Please try again later!")
 	}
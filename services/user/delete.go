@@ -0,0 +1,169 @@
+package user
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/castyapp/grpc.server/config"
+	"github.com/castyapp/grpc.server/helpers"
+	"github.com/castyapp/grpc.server/images"
+	"github.com/castyapp/grpc.server/models"
+	"github.com/castyapp/grpc.server/services"
+	"github.com/castyapp/grpc.server/services/auth"
+	"github.com/castyapp/grpc.server/storage"
+	"github.com/castyapp/grpc.server/uploads"
+	"github.com/castyapp/libcasty-protocol-go/proto"
+	"github.com/castyapp/libcasty-protocol-go/protocol"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type DeleteUserRequest struct {
+	AuthRequest *proto.AuthenticateRequest
+	// Password of the user, to confirm the deletion
+	Password string
+}
+
+// deleteUserDocuments deletes everything that belongs to or points at the user in a single transaction.
+// The theaters and then the user are deleted last, so without transactions a failed deletion
+// can be retried and still finds what is left.
+func deleteUserDocuments(ctx context.Context, db *mongo.Database, userID *primitive.ObjectID) error {
+
+	_, err := helpers.WithTransaction(ctx, db, func(sc context.Context) (interface{}, error) {
+
+		theaterIDs, err := db.Collection("theaters").Distinct(sc, "_id", bson.M{"user_id": userID})
+		if err != nil {
+			return nil, err
+		}
+
+		var (
+			byUser       = bson.M{"user_id": userID}
+			byTheaterIDs = bson.M{"$or": []interface{}{
+				bson.M{"theater_id": bson.M{"$in": theaterIDs}},
+				byUser,
+			}}
+			deletes = []struct {
+				collection string
+				filter     bson.M
+			}{
+				{"follows", byTheaterIDs},
+				{"theater_members", byTheaterIDs},
+				{"theater_bans", byTheaterIDs},
+				{"playback_states", bson.M{"_id": bson.M{"$in": theaterIDs}}},
+				{"friends", bson.M{"$or": []interface{}{byUser, bson.M{"friend_id": userID}}}},
+				{"notifications", bson.M{"$or": []interface{}{bson.M{"from_user_id": userID}, bson.M{"to_user_id": userID}}}},
+				{"messages", bson.M{"$or": []interface{}{bson.M{"sender_id": userID}, bson.M{"receiver_id": userID}}}},
+				{"blocks", bson.M{"$or": []interface{}{byUser, bson.M{"blocked_user_id": userID}}}},
+				{"connections", byUser},
+				{"refreshed_tokens", byUser},
+				{"username_history", byUser},
+				{"uploads", byUser},
+				{"media_jobs", byUser},
+				{"media_collections", byUser},
+				{"theaters", byUser},
+				{"users", bson.M{"_id": userID}},
+			}
+		)
+
+		// the user does not control the video players of other theaters anymore
+		pull := bson.M{"$pull": bson.M{"video_player_user_ids": userID}}
+		if _, err := db.Collection("theaters").UpdateMany(sc, bson.M{"video_player_user_ids": userID}, pull); err != nil {
+			return nil, err
+		}
+
+		for _, d := range deletes {
+			if _, err := db.Collection(d.collection).DeleteMany(sc, d.filter); err != nil {
+				return nil, err
+			}
+		}
+
+		return nil, nil
+	})
+
+	return err
+}
+
+// removeUserFiles removes the images of the user and whatever is left of their uploads.
+func removeUserFiles(user *models.User, uploadsBucket string) {
+
+	services.RemoveImage(storage.Buckets.Avatars, user.Avatar, images.Avatar)
+	services.RemoveImage(storage.Buckets.Banners, user.Profile.Banner, images.Banner)
+
+	objects, err := storage.Client.List(uploadsBucket, uploads.UserPrefix(user.ID))
+	if err != nil {
+		log.Printf("could not list uploads of user [%s]: %v", user.ID.Hex(), err)
+		return
+	}
+
+	for _, object := range objects {
+		if err := storage.Client.Delete(uploadsBucket, object.Key); err != nil {
+			log.Printf("could not remove object [%s/%s]: %v", uploadsBucket, object.Key, err)
+		}
+	}
+}
+
+// DeleteUser deletes the account of the user, media sources are removed with the
+// same cascade rules as RemoveMediaSource.
+func (s *Service) DeleteUser(ctx context.Context, req *DeleteUserRequest) (*proto.Response, error) {
+
+	dbConn, err := s.Get("db.mongo")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		db             = dbConn.(*mongo.Database)
+		cm             = s.MustGet("config.map").(*config.Map)
+		failedResponse = status.Error(codes.Internal, "Could not delete the account, Please try again later!")
+	)
+
+	user, err := auth.Authenticate(s.Context, req.AuthRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	if !auth.ValidatePassword(user, req.Password) {
+		return nil, status.Error(codes.PermissionDenied, "Password is invalid!")
+	}
+
+	friendIDs, err := helpers.GetFriendIDs(ctx, db, user.ID)
+	if err != nil {
+		return nil, failedResponse
+	}
+
+	removal, err := helpers.RemoveMediaSources(ctx, db, bson.M{"user_id": user.ID})
+	if err != nil {
+		log.Println(err)
+		return nil, failedResponse
+	}
+
+	helpers.RemoveMediaSourceFiles(removal, cm.Uploads.GetBucket())
+	helpers.SendTheaterMediaChangedEvents(s.Context, removal.Theaters)
+
+	if err := deleteUserDocuments(ctx, db, user.ID); err != nil {
+		log.Println(err)
+		return nil, failedResponse
+	}
+
+	removeUserFiles(user, cm.Uploads.GetBucket())
+
+	// friends drop the deleted user from their friend lists
+	protoUser := helpers.NewProtoUser(user, models.RelationStranger)
+	if buffer, err := protocol.NewMsgProtobuf(proto.EMSG_REMOVED_FRIEND, protoUser); err == nil {
+		friends := make([]*proto.User, 0, len(friendIDs))
+		for _, friendID := range friendIDs {
+			friends = append(friends, &proto.User{Id: friendID.Hex()})
+		}
+		helpers.SendEventToUsers(s.Context, buffer.Bytes(), friends)
+	}
+
+	return &proto.Response{
+		Status:  "success",
+		Code:    http.StatusOK,
+		Message: "Account deleted successfully!",
+	}, nil
+}
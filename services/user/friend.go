@@ -2,12 +2,14 @@ package user
 
 import (
 	"context"
+	"log"
 	"net/http"
 
 	"github.com/castyapp/grpc.server/helpers"
 	"github.com/castyapp/grpc.server/models"
 	"github.com/castyapp/grpc.server/services/auth"
 	"github.com/castyapp/libcasty-protocol-go/proto"
+	"github.com/castyapp/libcasty-protocol-go/protocol"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -23,11 +25,9 @@ func (s *Service) GetFriend(ctx context.Context, req *proto.FriendRequest) (*pro
 	}
 
 	var (
-		db                 = dbConn.(*mongo.Database)
-		dbFriend           = new(models.Friend)
-		dbFriendUserObject = new(models.User)
-		userCollection     = db.Collection("users")
-		friendsCollection  = db.Collection("friends")
+		db                = dbConn.(*mongo.Database)
+		dbFriend          = new(models.Friend)
+		friendsCollection = db.Collection("friends")
 	)
 
 	user, err := auth.Authenticate(s.Context, req.AuthRequest)
@@ -35,14 +35,8 @@ func (s *Service) GetFriend(ctx context.Context, req *proto.FriendRequest) (*pro
 		return nil, err
 	}
 
-	findFriendFilter := bson.M{"username": req.FriendId}
-
-	friendObjectID, err := primitive.ObjectIDFromHex(req.FriendId)
-	if err == nil {
-		findFriendFilter = bson.M{"_id": friendObjectID}
-	}
-
-	if err := userCollection.FindOne(ctx, findFriendFilter).Decode(dbFriendUserObject); err != nil {
+	dbFriendUserObject, err := s.findUserByIDOrUsername(ctx, db, req.FriendId)
+	if err != nil {
 		return nil, status.Error(codes.NotFound, "Could not find friend!")
 	}
 
@@ -67,7 +61,7 @@ func (s *Service) GetFriend(ctx context.Context, req *proto.FriendRequest) (*pro
 	return &proto.FriendResponse{
 		Status: "success",
 		Code:   http.StatusOK,
-		Result: helpers.NewProtoUser(dbFriendUserObject),
+		Result: helpers.NewProtoUser(dbFriendUserObject, models.RelationFriend),
 	}, nil
 }
 
@@ -106,3 +100,151 @@ func (s *Service) GetFriendRequest(ctx context.Context, req *proto.FriendRequest
 
 	return friendUser, nil
 }
+
+func (s *Service) RemoveFriend(ctx context.Context, req *proto.FriendRequest) (*proto.Response, error) {
+
+	dbConn, err := s.Get("db.mongo")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		db                = dbConn.(*mongo.Database)
+		friendsCollection = db.Collection("friends")
+		failedResponse    = status.Error(codes.Internal, "Could not remove friend, Please try again later!")
+	)
+
+	user, err := auth.Authenticate(s.Context, req.AuthRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	friend, err := s.findUserByIDOrUsername(ctx, db, req.FriendId)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, "Could not find friend!")
+	}
+
+	filter := bson.M{
+		"accepted": true,
+		"$or": []interface{}{
+			bson.M{
+				"friend_id": user.ID,
+				"user_id":   friend.ID,
+			},
+			bson.M{
+				"user_id":   user.ID,
+				"friend_id": friend.ID,
+			},
+		},
+	}
+
+	count, err := friendsCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, failedResponse
+	}
+
+	if count == 0 {
+		return nil, status.Error(codes.NotFound, "Could not find friend!")
+	}
+
+	if err := s.removeFriendship(ctx, db, user, friend); err != nil {
+		return nil, failedResponse
+	}
+
+	return &proto.Response{
+		Status:  "success",
+		Code:    http.StatusOK,
+		Message: "Friend removed successfully!",
+	}, nil
+}
+
+// removeFriendship deletes every friends row between the user and the friend,
+// pending or accepted, along with the notifications that were created for them.
+// Both parties are notified when they were friends, so their clients drop the friend,
+// when the request was pending they are told to refresh their notifications.
+func (s *Service) removeFriendship(ctx context.Context, db *mongo.Database, user, friend *models.User) error {
+
+	var (
+		friendsCollection = db.Collection("friends")
+		notifsCollection  = db.Collection("notifications")
+		friendRowIDs      = make([]*primitive.ObjectID, 0)
+		wereFriends       = false
+		filter            = bson.M{
+			"$or": []interface{}{
+				bson.M{
+					"friend_id": user.ID,
+					"user_id":   friend.ID,
+				},
+				bson.M{
+					"user_id":   user.ID,
+					"friend_id": friend.ID,
+				},
+			},
+		}
+	)
+
+	cursor, err := friendsCollection.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	for cursor.Next(ctx) {
+		dbFriend := new(models.Friend)
+		if err := cursor.Decode(dbFriend); err != nil {
+			continue
+		}
+		if dbFriend.Accepted {
+			wereFriends = true
+		}
+		friendRowIDs = append(friendRowIDs, dbFriend.ID)
+	}
+
+	if len(friendRowIDs) == 0 {
+		return nil
+	}
+
+	if _, err := friendsCollection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": friendRowIDs}}); err != nil {
+		return err
+	}
+
+	notifsFilter := bson.M{
+		"type":  int64(proto.Notification_NEW_FRIEND),
+		"extra": bson.M{"$in": friendRowIDs},
+	}
+	if _, err := notifsCollection.DeleteMany(ctx, notifsFilter); err != nil {
+		log.Println(err)
+	}
+
+	// the request is gone with its notification, both users refresh their notifications
+	if !wereFriends {
+		if buffer, err := protocol.NewMsgProtobuf(proto.EMSG_NEW_NOTIFICATION, &proto.NotificationMsgEvent{}); err == nil {
+			for _, u := range []*models.User{user, friend} {
+				if err := helpers.SendEventToUser(s.Context, buffer.Bytes(), &proto.User{Id: u.ID.Hex()}); err != nil {
+					log.Println(err)
+				}
+			}
+		}
+		return nil
+	}
+
+	var (
+		protoUser   = helpers.NewProtoUser(user, models.RelationStranger)
+		protoFriend = helpers.NewProtoUser(friend, models.RelationStranger)
+	)
+
+	// sending removed friend to current user
+	if buffer, err := protocol.NewMsgProtobuf(proto.EMSG_REMOVED_FRIEND, protoFriend); err == nil {
+		if err := helpers.SendEventToUser(s.Context, buffer.Bytes(), protoUser); err != nil {
+			log.Println(err)
+		}
+	}
+
+	// sending current user to removed friend
+	if buffer, err := protocol.NewMsgProtobuf(proto.EMSG_REMOVED_FRIEND, protoUser); err == nil {
+		if err := helpers.SendEventToUser(s.Context, buffer.Bytes(), protoFriend); err != nil {
+			log.Println(err)
+		}
+	}
+
+	return nil
+}
@@ -63,7 +63,7 @@ func (s *Service) GetPendingFriendRequests(ctx context.Context, req *proto.Authe
 
 		friendRequests = append(friendRequests, &proto.FriendRequest{
 			RequestId: friend.ID.Hex(),
-			Friend:    helpers.NewProtoUser(dbFriend),
+			Friend:    helpers.NewProtoUser(dbFriend, models.RelationStranger),
 		})
 	}
 
@@ -94,7 +94,7 @@ func (s *Service) AcceptFriendRequest(ctx context.Context, req *proto.FriendRequ
 	if err != nil {
 		return nil, err
 	}
-	protoUser := helpers.NewProtoUser(user)
+	protoUser := helpers.NewProtoUser(user, models.RelationFriend)
 
 	frObjectID, err := primitive.ObjectIDFromHex(req.RequestId)
 	if err != nil {
@@ -127,7 +127,7 @@ func (s *Service) AcceptFriendRequest(ctx context.Context, req *proto.FriendRequ
 	if err := usersCollection.FindOne(ctx, bson.M{"_id": friendID}).Decode(&friendObj); err != nil {
 		return nil, err
 	}
-	protoFriend := helpers.NewProtoUser(friendObj)
+	protoFriend := helpers.NewProtoUser(friendObj, models.RelationFriend)
 
 	findNotif := bson.M{
 		"extra":      friendRequest.ID,
@@ -211,6 +211,15 @@ func (s *Service) SendFriendRequest(ctx context.Context, req *proto.FriendReques
 		return nil, status.Error(codes.InvalidArgument, "Invalid friend id!")
 	}
 
+	blocked, err := helpers.IsBlocked(ctx, db, user.ID, &friendObjectID)
+	if err != nil {
+		return nil, failedResponse
+	}
+
+	if blocked {
+		return nil, status.Error(codes.PermissionDenied, "You can not send a friend request to this user!")
+	}
+
 	var (
 		filterFr = bson.M{
 			"$or": []interface{}{
@@ -281,3 +290,69 @@ func (s *Service) SendFriendRequest(ctx context.Context, req *proto.FriendReques
 		Message: "Friend request added successfully!",
 	}, nil
 }
+
+func (s *Service) DeclineFriendRequest(ctx context.Context, req *proto.FriendRequest) (*proto.Response, error) {
+	return s.removeFriendRequest(ctx, req, "friend_id", "Friend request declined successfully!")
+}
+
+func (s *Service) CancelFriendRequest(ctx context.Context, req *proto.FriendRequest) (*proto.Response, error) {
+	return s.removeFriendRequest(ctx, req, "user_id", "Friend request canceled successfully!")
+}
+
+// removeFriendRequest removes a pending friend request where the current user
+// is on the given side of the request. Incoming requests are matched by
+// friend_id and outgoing ones by user_id.
+func (s *Service) removeFriendRequest(ctx context.Context, req *proto.FriendRequest, side, message string) (*proto.Response, error) {
+
+	dbConn, err := s.Get("db.mongo")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		db                = dbConn.(*mongo.Database)
+		friendRequest     = new(models.Friend)
+		friend            = new(models.User)
+		friendsCollection = db.Collection("friends")
+		failedResponse    = status.Error(codes.Internal, "Could not remove friend request, Please try again later!")
+	)
+
+	user, err := auth.Authenticate(s.Context, req.AuthRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	frObjectID, err := primitive.ObjectIDFromHex(req.RequestId)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "Invalid friend request id!")
+	}
+
+	filter := bson.M{
+		"_id":      frObjectID,
+		"accepted": false,
+		side:       user.ID,
+	}
+
+	if err := friendsCollection.FindOne(ctx, filter).Decode(friendRequest); err != nil {
+		return nil, status.Error(codes.NotFound, "Could not find friend request!")
+	}
+
+	friendID := friendRequest.FriendID
+	if friendRequest.FriendID.Hex() == user.ID.Hex() {
+		friendID = friendRequest.UserID
+	}
+
+	if err := db.Collection("users").FindOne(ctx, bson.M{"_id": friendID}).Decode(friend); err != nil {
+		return nil, failedResponse
+	}
+
+	if err := s.removeFriendship(ctx, db, user, friend); err != nil {
+		return nil, failedResponse
+	}
+
+	return &proto.Response{
+		Status:  "success",
+		Code:    http.StatusOK,
+		Message: message,
+	}, nil
+}
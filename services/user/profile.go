@@ -0,0 +1,293 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/castyapp/grpc.server/helpers"
+	"github.com/castyapp/grpc.server/images"
+	"github.com/castyapp/grpc.server/models"
+	"github.com/castyapp/grpc.server/services"
+	"github.com/castyapp/grpc.server/services/auth"
+	"github.com/castyapp/grpc.server/storage"
+	"github.com/castyapp/libcasty-protocol-go/proto"
+	"github.com/castyapp/libcasty-protocol-go/protocol"
+	"github.com/getsentry/sentry-go"
+	"github.com/golang/protobuf/ptypes/any"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	maxBioLength            = 300
+	maxLocationLength       = 100
+	maxProfileLinks         = 5
+	maxFavouriteMedia       = 10
+	maxFavouriteMediaLength = 100
+)
+
+type UserProfile struct {
+	User       *proto.User
+	Profile    models.Profile
+	Visibility *models.ProfileVisibility
+}
+
+type ProfileResponse struct {
+	Status  string
+	Code    int64
+	Message string
+	Result  *UserProfile
+}
+
+type UpdateProfileRequest struct {
+	AuthRequest *proto.AuthenticateRequest
+	// Profile replaces the profile fields of the user, Banner is a url
+	// that the new banner image is fetched from.
+	Profile *models.Profile
+	// Visibility updates the visibility of the fields that are set.
+	Visibility *models.ProfileVisibility
+}
+
+func newUserProfile(u *models.User, relation models.Relation) *UserProfile {
+	profile := &UserProfile{
+		User:    helpers.NewProtoUser(u, relation),
+		Profile: helpers.NewVisibleProfile(u, relation),
+	}
+	if relation == models.RelationSelf {
+		visibility := u.Visibility
+		profile.Visibility = &visibility
+	}
+	return profile
+}
+
+func validateProfile(p *models.Profile) (validationErrors []*any.Any) {
+
+	if utf8.RuneCountInString(p.Bio) > maxBioLength {
+		validationErrors = append(validationErrors, &any.Any{
+			TypeUrl: "bio",
+			Value:   []byte(fmt.Sprintf("Bio can not be longer than %d characters!", maxBioLength)),
+		})
+	}
+
+	if utf8.RuneCountInString(p.Location) > maxLocationLength {
+		validationErrors = append(validationErrors, &any.Any{
+			TypeUrl: "location",
+			Value:   []byte(fmt.Sprintf("Location can not be longer than %d characters!", maxLocationLength)),
+		})
+	}
+
+	if len(p.Links) > maxProfileLinks {
+		validationErrors = append(validationErrors, &any.Any{
+			TypeUrl: "links",
+			Value:   []byte(fmt.Sprintf("You can not add more than %d links!", maxProfileLinks)),
+		})
+	}
+
+	for _, link := range p.Links {
+		u, err := url.Parse(link)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			validationErrors = append(validationErrors, &any.Any{
+				TypeUrl: "links",
+				Value:   []byte(fmt.Sprintf("Link [%s] is not a valid url!", link)),
+			})
+		}
+	}
+
+	if len(p.FavouriteMedia) > maxFavouriteMedia {
+		validationErrors = append(validationErrors, &any.Any{
+			TypeUrl: "favourite_media",
+			Value:   []byte(fmt.Sprintf("You can not add more than %d favourite media!", maxFavouriteMedia)),
+		})
+	}
+
+	for _, media := range p.FavouriteMedia {
+		if strings.TrimSpace(media) == "" || utf8.RuneCountInString(media) > maxFavouriteMediaLength {
+			validationErrors = append(validationErrors, &any.Any{
+				TypeUrl: "favourite_media",
+				Value:   []byte("Favourite media is not valid!"),
+			})
+			break
+		}
+	}
+
+	if p.Timezone != "" {
+		if _, err := time.LoadLocation(p.Timezone); err != nil {
+			validationErrors = append(validationErrors, &any.Any{
+				TypeUrl: "timezone",
+				Value:   []byte("Timezone is not valid!"),
+			})
+		}
+	}
+
+	return
+}
+
+// visibilityFields maps the visibility settings to their document fields.
+func visibilityFields(v *models.ProfileVisibility) map[string]models.Visibility {
+	return map[string]models.Visibility{
+		"visibility.email":           v.Email,
+		"visibility.bio":             v.Bio,
+		"visibility.location":        v.Location,
+		"visibility.links":           v.Links,
+		"visibility.favourite_media": v.FavouriteMedia,
+		"visibility.timezone":        v.Timezone,
+	}
+}
+
+func validateVisibility(v *models.ProfileVisibility) (validationErrors []*any.Any) {
+	for field, visibility := range visibilityFields(v) {
+		if visibility != "" && !visibility.IsValid() {
+			validationErrors = append(validationErrors, &any.Any{
+				TypeUrl: field,
+				Value:   []byte("Visibility should be one of public, friends or only_me!"),
+			})
+		}
+	}
+	return
+}
+
+func (s *Service) GetProfile(ctx context.Context, req *proto.FriendRequest) (*ProfileResponse, error) {
+
+	dbConn, err := s.Get("db.mongo")
+	if err != nil {
+		return nil, err
+	}
+
+	db := dbConn.(*mongo.Database)
+
+	user, err := auth.Authenticate(s.Context, req.AuthRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	profileUser := user
+	if req.FriendId != "" {
+		profileUser, err = s.findUserByIDOrUsername(ctx, db, req.FriendId)
+		if err != nil {
+			return nil, status.Error(codes.NotFound, "Could not find the user!")
+		}
+	}
+
+	if blocked, err := helpers.IsBlocked(ctx, db, user.ID, profileUser.ID); err != nil || blocked {
+		return nil, status.Error(codes.NotFound, "Could not find the user!")
+	}
+
+	return &ProfileResponse{
+		Status: "success",
+		Code:   http.StatusOK,
+		Result: newUserProfile(profileUser, helpers.GetRelation(ctx, db, user.ID, profileUser.ID)),
+	}, nil
+}
+
+func (s *Service) UpdateProfile(ctx context.Context, req *UpdateProfileRequest) (*ProfileResponse, error) {
+
+	dbConn, err := s.Get("db.mongo")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		db               = dbConn.(*mongo.Database)
+		collection       = db.Collection("users")
+		setUpdate        = bson.M{}
+		validationErrors []*any.Any
+		failedResponse   = status.Error(codes.Internal, "Could not update the profile, Please try again later!")
+	)
+
+	user, err := auth.Authenticate(s.Context, req.AuthRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Profile != nil {
+		validationErrors = append(validationErrors, validateProfile(req.Profile)...)
+	}
+
+	if req.Visibility != nil {
+		validationErrors = append(validationErrors, validateVisibility(req.Visibility)...)
+	}
+
+	if len(validationErrors) > 0 {
+		return nil, status.ErrorProto(&spb.Status{
+			Code:    int32(codes.InvalidArgument),
+			Message: "Validation Error!",
+			Details: validationErrors,
+		})
+	}
+
+	if req.Profile != nil {
+		setUpdate["profile.bio"] = strings.TrimSpace(req.Profile.Bio)
+		setUpdate["profile.location"] = strings.TrimSpace(req.Profile.Location)
+		setUpdate["profile.links"] = req.Profile.Links
+		setUpdate["profile.favourite_media"] = req.Profile.FavouriteMedia
+		setUpdate["profile.timezone"] = req.Profile.Timezone
+		if req.Profile.Banner != "" && req.Profile.Banner != user.Profile.Banner {
+			banner, err := services.SaveBannerFromURL(req.Profile.Banner)
+			if err != nil {
+				sentry.CaptureException(fmt.Errorf("could not upload banner %v", err))
+				return nil, status.Error(codes.InvalidArgument, "Could not save the banner image!")
+			}
+			setUpdate["profile.banner"] = banner
+		}
+	}
+
+	if req.Visibility != nil {
+		for field, visibility := range visibilityFields(req.Visibility) {
+			if visibility != "" {
+				setUpdate[field] = visibility
+			}
+		}
+	}
+
+	filter := bson.M{"_id": user.ID}
+
+	if len(setUpdate) > 0 {
+		setUpdate["updated_at"] = time.Now()
+		if _, err := collection.UpdateOne(ctx, filter, bson.M{"$set": setUpdate}); err != nil {
+			return nil, failedResponse
+		}
+		if _, ok := setUpdate["profile.banner"]; ok {
+			services.RemoveImage(storage.Buckets.Banners, user.Profile.Banner, images.Banner)
+		}
+	}
+
+	dbUpdatedUser := new(models.User)
+	if err := collection.FindOne(ctx, filter).Decode(dbUpdatedUser); err != nil {
+		return nil, failedResponse
+	}
+
+	if len(setUpdate) > 0 {
+
+		// update self user with new profile to other clients
+		protoUser := helpers.NewProtoUser(dbUpdatedUser, models.RelationSelf)
+		if buffer, err := protocol.NewMsgProtobuf(proto.EMSG_SELF_USER_UPDATED, protoUser); err == nil {
+			if err := helpers.SendEventToUser(s.Context, buffer.Bytes(), protoUser); err != nil {
+				log.Println(err)
+			}
+		}
+
+		// update friends with new profile of user
+		protoFriend := helpers.NewProtoUser(dbUpdatedUser, models.RelationFriend)
+		if buffer, err := protocol.NewMsgProtobuf(proto.EMSG_USER_UPDATED, protoFriend); err == nil {
+			if err := helpers.SendEventToFriends(s.Context, buffer.Bytes(), dbUpdatedUser); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+
+	return &ProfileResponse{
+		Status:  "success",
+		Code:    http.StatusOK,
+		Message: "Profile updated successfully!",
+		Result:  newUserProfile(dbUpdatedUser, models.RelationSelf),
+	}, nil
+}
@@ -6,30 +6,54 @@ import (
 
 	"github.com/castyapp/grpc.server/helpers"
 	"github.com/castyapp/grpc.server/models"
+	"github.com/castyapp/grpc.server/search"
 	"github.com/castyapp/grpc.server/services/auth"
 	"github.com/castyapp/libcasty-protocol-go/proto"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
+type SearchUsersRequest struct {
+	AuthRequest      *proto.AuthenticateRequest
+	Keyword          string
+	Cursor           string
+	Limit            int64
+	FriendsOfFriends bool
+}
+
+type SearchUsersResponse struct {
+	Status     string
+	Code       int64
+	Result     []*proto.User
+	NextCursor string
+}
+
 func (s *Service) Search(ctx context.Context, req *proto.SearchUserRequest) (*proto.SearchUserResponse, error) {
 
+	resp, err := s.SearchUsers(ctx, &SearchUsersRequest{
+		AuthRequest: req.AuthRequest,
+		Keyword:     req.Keyword,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &proto.SearchUserResponse{
+		Status: resp.Status,
+		Code:   resp.Code,
+		Result: resp.Result,
+	}, nil
+}
+
+func (s *Service) SearchUsers(ctx context.Context, req *SearchUsersRequest) (*SearchUsersResponse, error) {
+
 	dbConn, err := s.Get("db.mongo")
 	if err != nil {
 		return nil, err
 	}
 
-	var (
-		db            = dbConn.(*mongo.Database)
-		collection    = db.Collection("users")
-		emptyResponse = &proto.SearchUserResponse{
-			Status: "success",
-			Code:   http.StatusOK,
-			Result: make([]*proto.User, 0),
-		}
-	)
+	db := dbConn.(*mongo.Database)
 
 	user, err := auth.Authenticate(s.Context, req.AuthRequest)
 	if err != nil {
@@ -40,41 +64,32 @@ func (s *Service) Search(ctx context.Context, req *proto.SearchUserRequest) (*pr
 		return nil, status.Error(codes.InvalidArgument, "keyword is required")
 	}
 
-	filter := bson.M{
-		"_id": bson.M{"$ne": user.ID},
-		"$or": []interface{}{
-			bson.M{
-				"username": bson.M{
-					"$regex":   req.Keyword,
-					"$options": "i",
-				},
-			},
-			bson.M{
-				"fullname": bson.M{
-					"$regex":   req.Keyword,
-					"$options": "i",
-				},
-			},
-		},
+	page, err := search.Users(ctx, db, user, search.Query{
+		Keyword:          req.Keyword,
+		Cursor:           req.Cursor,
+		Limit:            req.Limit,
+		FriendsOfFriends: req.FriendsOfFriends,
+	})
+	if err == search.ErrInvalidCursor {
+		return nil, status.Error(codes.InvalidArgument, "Search cursor is invalid!")
 	}
-
-	cursor, err := collection.Find(ctx, filter)
 	if err != nil {
-		return emptyResponse, nil
+		return nil, status.Error(codes.Internal, "Could not search users, Please try again later!")
 	}
 
-	var protoUsers []*proto.User
-	for cursor.Next(ctx) {
-		var dbUser = new(models.User)
-		if err := cursor.Decode(dbUser); err != nil {
-			continue
+	protoUsers := make([]*proto.User, 0, len(page.Results))
+	for _, result := range page.Results {
+		relation := models.RelationStranger
+		if result.Friend {
+			relation = models.RelationFriend
 		}
-		protoUsers = append(protoUsers, helpers.NewProtoUser(dbUser))
+		protoUsers = append(protoUsers, helpers.NewProtoUser(result.User, relation))
 	}
 
-	return &proto.SearchUserResponse{
-		Status: "success",
-		Code:   http.StatusOK,
-		Result: protoUsers,
+	return &SearchUsersResponse{
+		Status:     "success",
+		Code:       http.StatusOK,
+		Result:     protoUsers,
+		NextCursor: page.NextCursor,
 	}, nil
 }
@@ -0,0 +1,107 @@
+package user
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/castyapp/grpc.server/helpers"
+	"github.com/castyapp/grpc.server/models"
+	"github.com/castyapp/grpc.server/services/auth"
+	"github.com/castyapp/libcasty-protocol-go/proto"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// suggestionsTTL is used when suggestions are computed on demand for a user
+// that the background job did not reach yet.
+const suggestionsTTL = 2 * time.Hour
+
+func (s *Service) GetFriendSuggestions(ctx context.Context, req *proto.AuthenticateRequest) (*proto.FriendsResponse, error) {
+
+	dbConn, err := s.Get("db.mongo")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		db             = dbConn.(*mongo.Database)
+		suggestions    = make([]*proto.User, 0)
+		failedResponse = status.Error(codes.Internal, "Could not get friend suggestions, Please try again later!")
+	)
+
+	user, err := auth.Authenticate(s.Context, req)
+	if err != nil {
+		return nil, err
+	}
+
+	userIDs, cached, err := helpers.GetCachedFriendSuggestions(s.Context, user.ID, helpers.MaxFriendSuggestions)
+	if err != nil {
+		log.Println(err)
+	}
+
+	if !cached {
+		computed, err := helpers.ComputeFriendSuggestions(ctx, db, user.ID)
+		if err != nil {
+			return nil, failedResponse
+		}
+		if err := helpers.StoreFriendSuggestions(s.Context, user.ID, computed, suggestionsTTL); err != nil {
+			log.Println(err)
+		}
+		userIDs = make([]*primitive.ObjectID, 0, len(computed))
+		for _, suggestion := range computed {
+			userIDs = append(userIDs, suggestion.UserID)
+		}
+	}
+
+	// cached suggestions may be stale, friends and blocks can change between runs
+	excluded, err := helpers.GetFriendSuggestionExclusions(ctx, db, user.ID)
+	if err != nil {
+		return nil, failedResponse
+	}
+
+	candidateIDs := make([]*primitive.ObjectID, 0, len(userIDs))
+	for _, id := range userIDs {
+		if !excluded[id.Hex()] {
+			candidateIDs = append(candidateIDs, id)
+		}
+	}
+
+	if len(candidateIDs) == 0 {
+		return &proto.FriendsResponse{
+			Status: "success",
+			Code:   http.StatusOK,
+			Result: suggestions,
+		}, nil
+	}
+
+	cursor, err := db.Collection("users").Find(ctx, bson.M{"_id": bson.M{"$in": candidateIDs}})
+	if err != nil {
+		return nil, failedResponse
+	}
+
+	users := make(map[string]*models.User, len(candidateIDs))
+	for cursor.Next(ctx) {
+		dbUser := new(models.User)
+		if err := cursor.Decode(dbUser); err != nil {
+			continue
+		}
+		users[dbUser.ID.Hex()] = dbUser
+	}
+
+	for _, id := range candidateIDs {
+		if dbUser, ok := users[id.Hex()]; ok {
+			suggestions = append(suggestions, helpers.NewProtoUser(dbUser, models.RelationStranger))
+		}
+	}
+
+	return &proto.FriendsResponse{
+		Status: "success",
+		Code:   http.StatusOK,
+		Result: suggestions,
+	}, nil
+}
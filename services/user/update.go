@@ -33,7 +33,7 @@ func (s *Service) UpdateUser(ctx context.Context, req *proto.UpdateUserRequest)
 	if err != nil {
 		return nil, err
 	}
-	protoUser := helpers.NewProtoUser(user)
+	protoUser := helpers.NewProtoUser(user, models.RelationSelf)
 
 	filter := bson.M{"_id": user.ID}
 	setUpdate := bson.M{}
@@ -51,7 +51,7 @@ func (s *Service) UpdateUser(ctx context.Context, req *proto.UpdateUserRequest)
 			Status:  "success",
 			Code:    http.StatusOK,
 			Message: "User updated successfully!",
-			Result:  helpers.NewProtoUser(user),
+			Result:  helpers.NewProtoUser(user, models.RelationSelf),
 		}, nil
 	}
 
@@ -77,7 +77,7 @@ func (s *Service) UpdateUser(ctx context.Context, req *proto.UpdateUserRequest)
 		}
 
 		// update friends with new activity of user
-		if buffer, err := protocol.NewMsgProtobuf(proto.EMSG_USER_UPDATED, protoUser); err == nil {
+		if buffer, err := protocol.NewMsgProtobuf(proto.EMSG_USER_UPDATED, helpers.NewProtoUser(user, models.RelationFriend)); err == nil {
 			if err := helpers.SendEventToFriends(s.Context, buffer.Bytes(), user); err != nil {
 				return nil, err
 			}
@@ -87,7 +87,7 @@ func (s *Service) UpdateUser(ctx context.Context, req *proto.UpdateUserRequest)
 			Status:  "success",
 			Code:    http.StatusOK,
 			Message: "User updated successfully!",
-			Result:  helpers.NewProtoUser(dbUpdatedUser),
+			Result:  helpers.NewProtoUser(dbUpdatedUser, models.RelationSelf),
 		}, nil
 	}
 
@@ -0,0 +1,176 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/castyapp/grpc.server/helpers"
+	"github.com/castyapp/grpc.server/images"
+	"github.com/castyapp/grpc.server/models"
+	"github.com/castyapp/grpc.server/services"
+	"github.com/castyapp/grpc.server/services/auth"
+	"github.com/castyapp/grpc.server/storage"
+	"github.com/castyapp/libcasty-protocol-go/proto"
+	"github.com/castyapp/libcasty-protocol-go/protocol"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type ImageKind int
+
+const (
+	ImageKindAvatar ImageKind = iota
+	ImageKindBanner
+)
+
+// UploadImageChunk is a piece of an uploaded image, the auth request and
+// the kind of the image are only read from the first chunk.
+type UploadImageChunk struct {
+	AuthRequest *proto.AuthenticateRequest
+	Kind        ImageKind
+	Data        []byte
+}
+
+// UserService_UploadImageServer is the server side of the client-streaming
+// upload rpc, it has the same shape as the generated grpc stream servers.
+type UserService_UploadImageServer interface {
+	SendAndClose(*proto.GetUserResponse) error
+	Recv() (*UploadImageChunk, error)
+	Context() context.Context
+}
+
+type imageTarget struct {
+	bucket func() string
+	field  string
+	spec   images.Spec
+}
+
+// buckets are resolved when used, they are configurable in the s3 config block
+var imageTargets = map[ImageKind]imageTarget{
+	ImageKindAvatar: {
+		bucket: func() string { return storage.Buckets.Avatars },
+		field:  "avatar",
+		spec:   images.Avatar,
+	},
+	ImageKindBanner: {
+		bucket: func() string { return storage.Buckets.Banners },
+		field:  "profile.banner",
+		spec:   images.Banner,
+	},
+}
+
+func (s *Service) UploadImage(stream UserService_UploadImageServer) error {
+
+	dbConn, err := s.Get("db.mongo")
+	if err != nil {
+		return err
+	}
+
+	var (
+		ctx            = stream.Context()
+		db             = dbConn.(*mongo.Database)
+		collection     = db.Collection("users")
+		buffer         = new(bytes.Buffer)
+		failedResponse = status.Error(codes.Internal, "Could not upload the image, Please try again later!")
+	)
+
+	first, err := stream.Recv()
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "Image is required!")
+	}
+
+	user, err := auth.Authenticate(s.Context, first.AuthRequest)
+	if err != nil {
+		return err
+	}
+
+	target, ok := imageTargets[first.Kind]
+	if !ok {
+		return status.Error(codes.InvalidArgument, "Image kind is invalid!")
+	}
+
+	bucket := target.bucket()
+	buffer.Write(first.Data)
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if int64(buffer.Len()+len(chunk.Data)) > target.spec.MaxBytes {
+			return status.Errorf(codes.InvalidArgument, "Image can not be larger than %d MB!", target.spec.MaxBytes>>20)
+		}
+		buffer.Write(chunk.Data)
+	}
+
+	imageName, err := services.SaveImage(bucket, target.spec, buffer.Bytes())
+	switch err {
+	case nil:
+	case images.ErrTooLarge:
+		return status.Error(codes.InvalidArgument, "Image is too large!")
+	case images.ErrUnsupportedFormat:
+		return status.Error(codes.InvalidArgument, "Image format is not supported, use png, jpeg, gif or webp!")
+	case images.ErrInvalidImage:
+		return status.Error(codes.InvalidArgument, "Image is invalid!")
+	default:
+		log.Println(err)
+		return failedResponse
+	}
+
+	var (
+		filter = bson.M{"_id": user.ID}
+		update = bson.M{
+			"$set": bson.M{
+				target.field: imageName,
+				"updated_at": time.Now(),
+			},
+		}
+	)
+
+	if _, err := collection.UpdateOne(ctx, filter, update); err != nil {
+		services.RemoveImage(bucket, imageName, target.spec)
+		return failedResponse
+	}
+
+	// the old image is not referenced anymore
+	oldImageName := user.Avatar
+	if first.Kind == ImageKindBanner {
+		oldImageName = user.Profile.Banner
+	}
+	services.RemoveImage(bucket, oldImageName, target.spec)
+
+	dbUpdatedUser := new(models.User)
+	if err := collection.FindOne(ctx, filter).Decode(dbUpdatedUser); err != nil {
+		return failedResponse
+	}
+	protoUser := helpers.NewProtoUser(dbUpdatedUser, models.RelationSelf)
+
+	// update self user with new image to other clients
+	if buffer, err := protocol.NewMsgProtobuf(proto.EMSG_SELF_USER_UPDATED, protoUser); err == nil {
+		if err := helpers.SendEventToUser(s.Context, buffer.Bytes(), protoUser); err != nil {
+			log.Println(err)
+		}
+	}
+
+	// update friends with new image of user
+	if buffer, err := protocol.NewMsgProtobuf(proto.EMSG_USER_UPDATED, helpers.NewProtoUser(dbUpdatedUser, models.RelationFriend)); err == nil {
+		if err := helpers.SendEventToFriends(s.Context, buffer.Bytes(), dbUpdatedUser); err != nil {
+			log.Println(err)
+		}
+	}
+
+	return stream.SendAndClose(&proto.GetUserResponse{
+		Status:  "success",
+		Code:    http.StatusOK,
+		Message: "Image uploaded successfully!",
+		Result:  protoUser,
+	})
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/castyapp/grpc.server/core"
 	"github.com/castyapp/grpc.server/helpers"
+	"github.com/castyapp/grpc.server/models"
 	"github.com/castyapp/grpc.server/services/auth"
 	"github.com/castyapp/libcasty-protocol-go/proto"
 	"github.com/castyapp/libcasty-protocol-go/protocol"
@@ -40,7 +41,7 @@ func (s *Service) UpdateState(ctx context.Context, req *proto.UpdateStateRequest
 	if err != nil {
 		return nil, err
 	}
-	protoUser := helpers.NewProtoUser(user)
+	protoUser := helpers.NewProtoUser(user, models.RelationSelf)
 
 	var (
 		filter = bson.M{"_id": user.ID}
@@ -61,7 +62,8 @@ func (s *Service) UpdateState(ctx context.Context, req *proto.UpdateStateRequest
 		}
 	}
 
-	// update friends with new state of user
+	// update friends with new state of user, they are the only ones who get it so they see the friend view
+	pms = &proto.PersonalStateMsgEvent{State: req.State, User: helpers.NewProtoUser(user, models.RelationFriend)}
 	if buffer, err := protocol.NewMsgProtobuf(proto.EMSG_PERSONAL_STATE_CHANGED, pms); err == nil {
 		if err := helpers.SendEventToFriends(s.Context, buffer.Bytes(), user); err != nil {
 			return nil, err
@@ -88,7 +90,7 @@ func (s *Service) RemoveActivity(ctx context.Context, req *proto.AuthenticateReq
 	if err != nil {
 		return nil, err
 	}
-	protoUser := helpers.NewProtoUser(user)
+	protoUser := helpers.NewProtoUser(user, models.RelationSelf)
 
 	var (
 		filter = bson.M{"_id": user.ID}
@@ -113,7 +115,8 @@ func (s *Service) RemoveActivity(ctx context.Context, req *proto.AuthenticateReq
 		}
 	}
 
-	// update friends with new activity of user
+	// update friends with new activity of user, they are the only ones who get it so they see the friend view
+	pms = &proto.PersonalActivityMsgEvent{Activity: pms.Activity, User: helpers.NewProtoUser(user, models.RelationFriend)}
 	if buffer, err := protocol.NewMsgProtobuf(proto.EMSG_PERSONAL_ACTIVITY_CHANGED, pms); err == nil {
 		if err := helpers.SendEventToFriends(s.Context, buffer.Bytes(), user); err != nil {
 			return nil, err
@@ -140,7 +143,7 @@ func (s *Service) UpdateActivity(ctx context.Context, req *proto.UpdateActivityR
 	if err != nil {
 		return nil, err
 	}
-	protoUser := helpers.NewProtoUser(user)
+	protoUser := helpers.NewProtoUser(user, models.RelationSelf)
 
 	activityObjectID, err := primitive.ObjectIDFromHex(req.Activity.Id)
 	if err != nil {
@@ -178,7 +181,8 @@ func (s *Service) UpdateActivity(ctx context.Context, req *proto.UpdateActivityR
 		}
 	}
 
-	// update friends with new activity of user
+	// update friends with new activity of user, they are the only ones who get it so they see the friend view
+	pms = &proto.PersonalActivityMsgEvent{Activity: pms.Activity, User: helpers.NewProtoUser(user, models.RelationFriend)}
 	if buffer, err := protocol.NewMsgProtobuf(proto.EMSG_PERSONAL_ACTIVITY_CHANGED, pms); err == nil {
 		if err := helpers.SendEventToFriends(s.Context, buffer.Bytes(), user); err != nil {
 			return nil, err
@@ -198,7 +202,7 @@ func (s *Service) GetUser(_ context.Context, req *proto.AuthenticateRequest) (*p
 		return nil, err
 	}
 	return &proto.GetUserResponse{
-		Result: helpers.NewProtoUser(user),
+		Result: helpers.NewProtoUser(user, models.RelationSelf),
 		Status: "success",
 		Code:   http.StatusOK,
 	}, nil
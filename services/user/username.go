@@ -0,0 +1,203 @@
+package user
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/castyapp/grpc.server/config"
+	"github.com/castyapp/grpc.server/helpers"
+	"github.com/castyapp/grpc.server/models"
+	"github.com/castyapp/grpc.server/services/auth"
+	"github.com/castyapp/libcasty-protocol-go/proto"
+	"github.com/castyapp/libcasty-protocol-go/protocol"
+	"github.com/golang/protobuf/ptypes/any"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var invalidUsernames = []string{
+	"login",
+	"logout",
+	"register",
+	"iforgot",
+	"settings",
+	"messages",
+	"home",
+	"me",
+	"profile",
+	"callback",
+	"oauth",
+	"terms",
+}
+
+func usernameValidationError(message string) error {
+	return status.ErrorProto(&spb.Status{
+		Code:    int32(codes.InvalidArgument),
+		Message: "Validation Error!",
+		Details: []*any.Any{
+			{
+				TypeUrl: "username",
+				Value:   []byte(message),
+			},
+		},
+	})
+}
+
+// validateUsername applies the rules that every username has to follow,
+// both at registration and when a user changes the username.
+func validateUsername(username string) error {
+
+	if strings.TrimSpace(username) == "" {
+		return usernameValidationError("Username is required!")
+	}
+
+	for _, invalid := range invalidUsernames {
+		if strings.ToLower(username) == invalid {
+			return usernameValidationError("Username is not available!")
+		}
+	}
+
+	if strings.Contains(username, "/") {
+		return usernameValidationError("Username is not available!")
+	}
+
+	return nil
+}
+
+func (s *Service) ChangeUsername(ctx context.Context, req *proto.UpdateUserRequest) (*proto.GetUserResponse, error) {
+
+	dbConn, err := s.Get("db.mongo")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		db                = dbConn.(*mongo.Database)
+		cm                = s.MustGet("config.map").(*config.Map)
+		collection        = db.Collection("users")
+		historyCollection = db.Collection("username_history")
+		failedResponse    = status.Error(codes.Internal, "Could not change the username, Please try again later!")
+	)
+
+	user, err := auth.Authenticate(s.Context, req.AuthRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Result == nil {
+		return nil, status.Error(codes.InvalidArgument, "Validation error, User entry not exists!")
+	}
+
+	if err := validateUsername(req.Result.Username); err != nil {
+		return nil, err
+	}
+
+	username := strings.ToLower(req.Result.Username)
+	if username == user.Username {
+		return nil, usernameValidationError("This is your current username!")
+	}
+
+	cooldown := cm.Users.GetUsernameChangeCooldown()
+	if !user.UsernameChangedAt.IsZero() && time.Since(user.UsernameChangedAt) < cooldown {
+		nextChange := user.UsernameChangedAt.Add(cooldown).Format(time.RFC1123)
+		return nil, status.Errorf(codes.FailedPrecondition, "You can change your username again after %s!", nextChange)
+	}
+
+	count, err := collection.CountDocuments(ctx, bson.M{"username": username})
+	if err != nil {
+		return nil, failedResponse
+	}
+
+	if count != 0 {
+		return nil, usernameValidationError("Username already exists!")
+	}
+
+	reserved, err := helpers.IsUsernameReserved(ctx, db, username, user.ID)
+	if err != nil {
+		return nil, failedResponse
+	}
+
+	if reserved {
+		return nil, usernameValidationError("Username is not available!")
+	}
+
+	var (
+		now = time.Now()
+		// the username is changed only if it was not changed since the user was authenticated
+		filter = bson.M{"_id": user.ID, "username": user.Username}
+		update = bson.M{
+			"$set": bson.M{
+				"username":            username,
+				"username_changed_at": now,
+				"updated_at":          now,
+			},
+		}
+	)
+
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, usernameValidationError("Username already exists!")
+		}
+		return nil, failedResponse
+	}
+
+	if result.MatchedCount == 0 {
+		return nil, status.Error(codes.Aborted, "Your username was changed meanwhile, Please try again!")
+	}
+
+	// the old username is kept once it's not the username of the user anymore, rows of the
+	// old username that were reclaimed already are replaced
+	if _, err := historyCollection.DeleteMany(ctx, bson.M{"username": user.Username, "reclaimable_at": bson.M{"$lte": now}}); err != nil {
+		log.Println(err)
+	}
+
+	history := bson.M{
+		"user_id":        user.ID,
+		"username":       user.Username,
+		"changed_at":     now,
+		"reclaimable_at": now.Add(cm.Users.GetUsernameReclaimAfter()),
+	}
+
+	if _, err := historyCollection.InsertOne(ctx, history); err != nil {
+		log.Printf("could not keep the old username [%s] of user [%s]: %v", user.Username, user.ID.Hex(), err)
+	}
+
+	// the user took back one of the old usernames, it does not redirect anymore
+	if _, err := historyCollection.DeleteMany(ctx, bson.M{"user_id": user.ID, "username": username}); err != nil {
+		log.Println(err)
+	}
+
+	dbUpdatedUser := new(models.User)
+	if err := collection.FindOne(ctx, bson.M{"_id": user.ID}).Decode(dbUpdatedUser); err != nil {
+		return nil, failedResponse
+	}
+	protoUser := helpers.NewProtoUser(dbUpdatedUser, models.RelationSelf)
+
+	// update self user with new username to other clients
+	if buffer, err := protocol.NewMsgProtobuf(proto.EMSG_SELF_USER_UPDATED, protoUser); err == nil {
+		if err := helpers.SendEventToUser(s.Context, buffer.Bytes(), protoUser); err != nil {
+			log.Println(err)
+		}
+	}
+
+	// update friends with new username of user
+	if buffer, err := protocol.NewMsgProtobuf(proto.EMSG_USER_UPDATED, helpers.NewProtoUser(dbUpdatedUser, models.RelationFriend)); err == nil {
+		if err := helpers.SendEventToFriends(s.Context, buffer.Bytes(), dbUpdatedUser); err != nil {
+			log.Println(err)
+		}
+	}
+
+	return &proto.GetUserResponse{
+		Status:  "success",
+		Code:    http.StatusOK,
+		Message: "Username changed successfully!",
+		Result:  protoUser,
+	}, nil
+}
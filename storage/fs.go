@@ -0,0 +1,210 @@
+package storage
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// metaDir keeps the content types of the objects, next to the buckets.
+const metaDir = ".meta"
+
+// FilesystemBackend stores objects as files under a root directory, every
+// bucket is a directory and keys are paths inside of it.
+type FilesystemBackend struct {
+	root string
+}
+
+func NewFilesystemBackend(root string) (*FilesystemBackend, error) {
+	if root == "" {
+		root = "./storage"
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	return &FilesystemBackend{root: root}, nil
+}
+
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." && name != metaDir && !strings.ContainsAny(name, `/\`)
+}
+
+func validKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, `\`) || path.Clean(key) != key {
+		return false
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == ".." || segment == "." {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *FilesystemBackend) paths(bucket, key string) (string, string, error) {
+	if !validName(bucket) || !validKey(key) {
+		return "", "", ErrInvalidKey
+	}
+	var (
+		objectPath = filepath.Join(b.root, bucket, filepath.FromSlash(key))
+		metaPath   = filepath.Join(b.root, metaDir, bucket, filepath.FromSlash(key))
+	)
+	return objectPath, metaPath, nil
+}
+
+func (b *FilesystemBackend) stat(objectPath, metaPath, key string) (*Object, error) {
+	info, err := os.Stat(objectPath)
+	if os.IsNotExist(err) || (err == nil && info.IsDir()) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	contentType, _ := ioutil.ReadFile(metaPath)
+	return &Object{
+		Key:          key,
+		Size:         info.Size(),
+		ContentType:  string(contentType),
+		LastModified: info.ModTime(),
+	}, nil
+}
+
+func (b *FilesystemBackend) Put(bucket, key string, reader io.Reader, size int64, contentType string) error {
+
+	objectPath, metaPath, err := b.paths(bucket, key)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(filepath.Join(b.root, bucket)); os.IsNotExist(err) {
+		return ErrNotFound
+	}
+
+	for _, dir := range []string{filepath.Dir(objectPath), filepath.Dir(metaPath)} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+
+	// write to a temp file first, so readers never see half written objects
+	tmp, err := ioutil.TempFile(filepath.Dir(objectPath), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, reader); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(metaPath, []byte(contentType), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), objectPath)
+}
+
+func (b *FilesystemBackend) Get(bucket, key string) (io.ReadCloser, *Object, error) {
+	objectPath, metaPath, err := b.paths(bucket, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	object, err := b.stat(objectPath, metaPath, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	file, err := os.Open(objectPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, object, nil
+}
+
+func (b *FilesystemBackend) Delete(bucket, key string) error {
+	objectPath, metaPath, err := b.paths(bucket, key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(objectPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Remove(metaPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (b *FilesystemBackend) Stat(bucket, key string) (*Object, error) {
+	objectPath, metaPath, err := b.paths(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	return b.stat(objectPath, metaPath, key)
+}
+
+// Presign is not supported, there is no http server in front of the files.
+func (b *FilesystemBackend) Presign(method, bucket, key string, expiry time.Duration) (string, error) {
+	return "", ErrPresignNotSupported
+}
+
+func (b *FilesystemBackend) List(bucket, prefix string) ([]*Object, error) {
+
+	if !validName(bucket) {
+		return nil, ErrInvalidKey
+	}
+
+	bucketPath := filepath.Join(b.root, bucket)
+	if _, err := os.Stat(bucketPath); os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+
+	objects := make([]*Object, 0)
+	err := filepath.Walk(bucketPath, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".upload-") {
+			return nil
+		}
+		rel, err := filepath.Rel(bucketPath, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		object, err := b.Stat(bucket, key)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, object)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+
+	return objects, nil
+}
+
+func (b *FilesystemBackend) EnsureBucket(bucket string) error {
+	if !validName(bucket) {
+		return ErrInvalidKey
+	}
+	return os.MkdirAll(filepath.Join(b.root, bucket), 0755)
+}
@@ -0,0 +1,17 @@
+package storage
+
+import "time"
+
+// Orphans returns the objects that are not referenced anymore and were last
+// modified before the cutoff, newer objects may still be waiting for their
+// references to be written.
+func Orphans(objects []*Object, referenced func(key string) bool, cutoff time.Time) []*Object {
+	orphans := make([]*Object, 0)
+	for _, object := range objects {
+		if referenced(object.Key) || object.LastModified.After(cutoff) {
+			continue
+		}
+		orphans = append(orphans, object)
+	}
+	return orphans
+}
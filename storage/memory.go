@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type memoryObject struct {
+	data         []byte
+	contentType  string
+	lastModified time.Time
+}
+
+// MemoryBackend keeps every object in memory, it's meant for tests and
+// local development, nothing survives a restart.
+type MemoryBackend struct {
+	mu      sync.RWMutex
+	buckets map[string]map[string]*memoryObject
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{buckets: make(map[string]map[string]*memoryObject)}
+}
+
+func (o *memoryObject) object(key string) *Object {
+	return &Object{
+		Key:          key,
+		Size:         int64(len(o.data)),
+		ContentType:  o.contentType,
+		LastModified: o.lastModified,
+	}
+}
+
+func (b *MemoryBackend) Put(bucket, key string, reader io.Reader, size int64, contentType string) error {
+	if key == "" {
+		return ErrInvalidKey
+	}
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	if size >= 0 && int64(len(data)) != size {
+		return fmt.Errorf("storage: expected %d bytes, got %d", size, len(data))
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	objects, ok := b.buckets[bucket]
+	if !ok {
+		return ErrNotFound
+	}
+	objects[key] = &memoryObject{data: data, contentType: contentType, lastModified: time.Now()}
+	return nil
+}
+
+func (b *MemoryBackend) Get(bucket, key string) (io.ReadCloser, *Object, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	o, ok := b.buckets[bucket][key]
+	if !ok {
+		return nil, nil, ErrNotFound
+	}
+	return ioutil.NopCloser(bytes.NewReader(o.data)), o.object(key), nil
+}
+
+func (b *MemoryBackend) Delete(bucket, key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.buckets[bucket], key)
+	return nil
+}
+
+func (b *MemoryBackend) Stat(bucket, key string) (*Object, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	o, ok := b.buckets[bucket][key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return o.object(key), nil
+}
+
+// Presign is not supported, the objects are only reachable from the process.
+func (b *MemoryBackend) Presign(method, bucket, key string, expiry time.Duration) (string, error) {
+	return "", ErrPresignNotSupported
+}
+
+func (b *MemoryBackend) List(bucket, prefix string) ([]*Object, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	objects, ok := b.buckets[bucket]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	result := make([]*Object, 0)
+	for key, o := range objects {
+		if strings.HasPrefix(key, prefix) {
+			result = append(result, o.object(key))
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Key < result[j].Key
+	})
+	return result, nil
+}
+
+func (b *MemoryBackend) EnsureBucket(bucket string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.buckets[bucket]; !ok {
+		b.buckets[bucket] = make(map[string]*memoryObject)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/castyapp/grpc.server/config"
+	"github.com/minio/minio-go"
+)
+
+// MinioBackend stores objects in minio or any other s3 compatible storage.
+type MinioBackend struct {
+	client *minio.Client
+	region string
+}
+
+func NewMinioBackend(c config.S3Map) (*MinioBackend, error) {
+	client, err := minio.NewWithRegion(c.Endpoint, c.AccessKey, c.SecretKey, c.UseTLS, c.Region)
+	if err != nil {
+		return nil, err
+	}
+	return &MinioBackend{client: client, region: c.Region}, nil
+}
+
+func minioError(err error) error {
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchKey", "NoSuchBucket":
+		return ErrNotFound
+	}
+	return err
+}
+
+func newMinioObject(info minio.ObjectInfo) *Object {
+	return &Object{
+		Key:          info.Key,
+		Size:         info.Size,
+		ContentType:  info.ContentType,
+		LastModified: info.LastModified,
+	}
+}
+
+func (b *MinioBackend) Put(bucket, key string, reader io.Reader, size int64, contentType string) error {
+	opts := minio.PutObjectOptions{ContentType: contentType}
+	_, err := b.client.PutObject(bucket, key, reader, size, opts)
+	return err
+}
+
+func (b *MinioBackend) Get(bucket, key string) (io.ReadCloser, *Object, error) {
+	object, err := b.client.GetObject(bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, nil, minioError(err)
+	}
+	info, err := object.Stat()
+	if err != nil {
+		object.Close()
+		return nil, nil, minioError(err)
+	}
+	return object, newMinioObject(info), nil
+}
+
+func (b *MinioBackend) Delete(bucket, key string) error {
+	return b.client.RemoveObject(bucket, key)
+}
+
+func (b *MinioBackend) Stat(bucket, key string) (*Object, error) {
+	info, err := b.client.StatObject(bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, minioError(err)
+	}
+	return newMinioObject(info), nil
+}
+
+func (b *MinioBackend) Presign(method, bucket, key string, expiry time.Duration) (string, error) {
+	switch method {
+	case http.MethodPut:
+		u, err := b.client.PresignedPutObject(bucket, key, expiry)
+		if err != nil {
+			return "", err
+		}
+		return u.String(), nil
+	case http.MethodGet:
+		u, err := b.client.PresignedGetObject(bucket, key, expiry, nil)
+		if err != nil {
+			return "", err
+		}
+		return u.String(), nil
+	}
+	return "", ErrPresignNotSupported
+}
+
+func (b *MinioBackend) List(bucket, prefix string) ([]*Object, error) {
+	done := make(chan struct{})
+	defer close(done)
+	objects := make([]*Object, 0)
+	for info := range b.client.ListObjectsV2(bucket, prefix, true, done) {
+		if info.Err != nil {
+			return nil, minioError(info.Err)
+		}
+		objects = append(objects, newMinioObject(info))
+	}
+	return objects, nil
+}
+
+func (b *MinioBackend) EnsureBucket(bucket string) error {
+	exists, err := b.client.BucketExists(bucket)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	return b.client.MakeBucket(bucket, b.region)
+}
@@ -1,16 +1,138 @@
 package storage
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
 	"github.com/castyapp/grpc.server/config"
-	"github.com/minio/minio-go"
 )
 
-var Client *minio.Client
+var (
+	ErrNotFound            = errors.New("storage: object not found")
+	ErrInvalidKey          = errors.New("storage: object key is invalid")
+	ErrPresignNotSupported = errors.New("storage: presigned urls are not supported by this backend")
+)
+
+type Object struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	LastModified time.Time
+}
+
+// Backend is where the files of users are stored, buckets are created with
+// EnsureBucket before anything is put in them.
+type Backend interface {
+	Put(bucket, key string, reader io.Reader, size int64, contentType string) error
+	Get(bucket, key string) (io.ReadCloser, *Object, error)
+	Delete(bucket, key string) error
+	Stat(bucket, key string) (*Object, error)
+	// Presign returns a url that the object can be accessed with the given http method until it expires
+	Presign(method, bucket, key string, expiry time.Duration) (string, error)
+	List(bucket, prefix string) ([]*Object, error)
+	EnsureBucket(bucket string) error
+}
+
+var (
+	Client  Backend
+	Buckets = config.BucketsMap{
+		Avatars:   "avatars",
+		Banners:   "banners",
+		Posters:   "posters",
+		Subtitles: "subtitles",
+	}
+	// ReadURLExpiry is how long the urls that clients load stored media and subtitles with last
+	ReadURLExpiry = time.Hour
+)
+
+func NewBackend(c config.S3Map) (Backend, error) {
+	switch c.Driver {
+	case "", "minio", "s3":
+		return NewMinioBackend(c)
+	case "fs":
+		return NewFilesystemBackend(c.Path)
+	case "memory":
+		return NewMemoryBackend(), nil
+	}
+	return nil, fmt.Errorf("storage driver [%s] is not supported", c.Driver)
+}
 
 func Configure(c *config.Map) (err error) {
-	Client, err = minio.NewV4(c.S3.Endpoint, c.S3.AccessKey, c.S3.SecretKey, false)
+
+	Client, err = NewBackend(c.S3)
 	if err != nil {
 		return err
 	}
+
+	if c.S3.Buckets.Avatars != "" {
+		Buckets.Avatars = c.S3.Buckets.Avatars
+	}
+
+	if c.S3.Buckets.Banners != "" {
+		Buckets.Banners = c.S3.Buckets.Banners
+	}
+
+	if c.S3.Buckets.Posters != "" {
+		Buckets.Posters = c.S3.Buckets.Posters
+	}
+
+	if c.S3.Buckets.Subtitles != "" {
+		Buckets.Subtitles = c.S3.Buckets.Subtitles
+	}
+
+	ReadURLExpiry = c.Uploads.GetURLExpiry()
+
+	if c.S3.AutoCreateBuckets {
+		buckets := []string{Buckets.Avatars, Buckets.Banners, Buckets.Posters, Buckets.Subtitles, c.Uploads.GetBucket()}
+		for _, bucket := range buckets {
+			if err := Client.EnsureBucket(bucket); err != nil {
+				return fmt.Errorf("could not create bucket [%s]: %v", bucket, err)
+			}
+		}
+	}
+
 	return nil
 }
+
+// ObjectURI is the uri that media sources and subtitles stored in our own buckets are saved with.
+func ObjectURI(bucket, key string) string {
+	return fmt.Sprintf("s3://%s/%s", bucket, key)
+}
+
+// ParseObjectURI returns the bucket and the key of an uri made with ObjectURI.
+func ParseObjectURI(uri string) (bucket, key string, ok bool) {
+	if !strings.HasPrefix(uri, "s3://") {
+		return "", "", false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(uri, "s3://"), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// ReadURL returns the url that clients load the uri with. Objects of our own buckets get a
+// presigned url that expires after ReadURLExpiry, they have no url when the backend can not
+// presign them. Other uris are returned as they are.
+func ReadURL(uri string) string {
+	bucket, key, ok := ParseObjectURI(uri)
+	if !ok {
+		return uri
+	}
+	if Client == nil {
+		return ""
+	}
+	url, err := Client.Presign(http.MethodGet, bucket, key, ReadURLExpiry)
+	if err != nil {
+		if err != ErrPresignNotSupported {
+			log.Printf("could not presign object [%s/%s]: %v", bucket, key, err)
+		}
+		return ""
+	}
+	return url
+}
@@ -0,0 +1,141 @@
+package subtitles
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+const (
+	EncodingUTF8        = "utf-8"
+	EncodingUTF16LE     = "utf-16le"
+	EncodingUTF16BE     = "utf-16be"
+	EncodingWindows1256 = "windows-1256"
+	EncodingWindows1251 = "windows-1251"
+	EncodingWindows1252 = "windows-1252"
+)
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// legacyEncoding is a single byte encoding that subtitle files are commonly saved with.
+type legacyEncoding struct {
+	name     string
+	encoding encoding.Encoding
+	// frequent are the most frequent letters of the languages that use the encoding
+	frequent string
+	langs    []string
+}
+
+var legacyEncodings = []*legacyEncoding{
+	{
+		name:     EncodingWindows1256,
+		encoding: charmap.Windows1256,
+		frequent: "اليمنوربهدتسعفكقی",
+		langs:    []string{"fa", "ar", "ur", "ps", "ku"},
+	},
+	{
+		name:     EncodingWindows1251,
+		encoding: charmap.Windows1251,
+		frequent: "оеаинтсрвлкмдпу",
+		langs:    []string{"ru", "uk", "bg", "sr", "be", "mk"},
+	},
+}
+
+func decodeWith(e encoding.Encoding, data []byte) (string, error) {
+	decoded, err := e.NewDecoder().Bytes(data)
+	if err != nil {
+		return "", err
+	}
+	return string(decoded), nil
+}
+
+// score is the share of the non-ascii letters that are frequent letters of the encoding's languages.
+func (l *legacyEncoding) score(data []byte) float64 {
+	decoded, err := decodeWith(l.encoding, data)
+	if err != nil {
+		return 0
+	}
+	var total, frequent int
+	for _, r := range decoded {
+		if r < utf8.RuneSelf {
+			continue
+		}
+		total++
+		if strings.ContainsRune(l.frequent, r) {
+			frequent++
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(frequent) / float64(total)
+}
+
+// highByteRatio is the share of the non-ascii bytes among the letters, latin
+// text only has a few of them while other scripts consist of them entirely.
+func highByteRatio(data []byte) float64 {
+	var high, letters int
+	for _, b := range data {
+		switch {
+		case b >= 0x80:
+			high++
+		case (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z'):
+			letters++
+		}
+	}
+	if high+letters == 0 {
+		return 0
+	}
+	return float64(high) / float64(high+letters)
+}
+
+// Decode detects the encoding of the subtitle file and converts it to utf-8,
+// the language of the subtitle helps with telling legacy encodings apart.
+func Decode(data []byte, lang string) (text string, encodingName string, err error) {
+
+	switch {
+	case bytes.HasPrefix(data, bomUTF8):
+		return string(data[len(bomUTF8):]), EncodingUTF8, nil
+	case bytes.HasPrefix(data, bomUTF16LE):
+		text, err = decodeWith(unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM), data)
+		return text, EncodingUTF16LE, err
+	case bytes.HasPrefix(data, bomUTF16BE):
+		text, err = decodeWith(unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM), data)
+		return text, EncodingUTF16BE, err
+	case utf8.Valid(data):
+		return string(data), EncodingUTF8, nil
+	}
+
+	lang = strings.ToLower(lang)
+	for _, legacy := range legacyEncodings {
+		for _, l := range legacy.langs {
+			if lang == l || strings.HasPrefix(lang, l+"-") {
+				text, err = decodeWith(legacy.encoding, data)
+				return text, legacy.name, err
+			}
+		}
+	}
+
+	if highByteRatio(data) < 0.25 {
+		text, err = decodeWith(charmap.Windows1252, data)
+		return text, EncodingWindows1252, err
+	}
+
+	best, bestScore := legacyEncodings[0], -1.0
+	for _, legacy := range legacyEncodings {
+		if score := legacy.score(data); score > bestScore {
+			best, bestScore = legacy, score
+		}
+	}
+
+	text, err = decodeWith(best.encoding, data)
+	return text, best.name, err
+}
@@ -0,0 +1,441 @@
+package subtitles
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Format string
+
+const (
+	FormatSRT     Format = "srt"
+	FormatVTT     Format = "vtt"
+	FormatASS     Format = "ass"
+	FormatSUB     Format = "sub"
+	FormatUnknown Format = ""
+)
+
+// MaxSize is the largest subtitle file that is accepted.
+const MaxSize = 5 << 20
+
+// defaultFrameRate is used for MicroDVD files that don't declare their frame rate.
+const defaultFrameRate = 23.976
+
+var ErrNoCues = errors.New("subtitle has no valid cues")
+
+type Cue struct {
+	Start time.Duration
+	End   time.Duration
+	Text  string
+}
+
+// ParseError is a problem with a single line of the subtitle file,
+// the cues that could be parsed are kept.
+type ParseError struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+type Result struct {
+	Format   Format
+	Encoding string
+	Cues     []*Cue
+	Errors   []*ParseError
+}
+
+var (
+	srtTimingRegex  = regexp.MustCompile(`^\s*(\d+:\d{1,2}:\d{1,2}[,.]\d{1,3})\s*-->\s*(\d+:\d{1,2}:\d{1,2}[,.]\d{1,3})`)
+	vttTimingRegex  = regexp.MustCompile(`^\s*((?:\d+:)?\d{1,2}:\d{1,2}\.\d{1,3})\s*-->\s*((?:\d+:)?\d{1,2}:\d{1,2}\.\d{1,3})`)
+	subLineRegex    = regexp.MustCompile(`^\{(\d+)\}\{(\d+)\}(.*)$`)
+	assOverrideTags = regexp.MustCompile(`\{[^}]*\}`)
+	subStyleTags    = regexp.MustCompile(`\{[a-zA-Z]:[^}]*\}`)
+	htmlTags        = regexp.MustCompile(`</?([a-zA-Z]+)[^>]*>`)
+)
+
+// ObjectKey is the key that the WebVTT file of a subtitle is stored with,
+// later versions get a unique suffix so concurrent syncs never write the same object.
+func ObjectKey(mediaSourceID, subtitleID *primitive.ObjectID, version int) string {
+	if version <= 1 {
+		return fmt.Sprintf("%s/%s.vtt", mediaSourceID.Hex(), subtitleID.Hex())
+	}
+	return fmt.Sprintf("%s/%s.v%d-%s.vtt", mediaSourceID.Hex(), subtitleID.Hex(), version, primitive.NewObjectID().Hex())
+}
+
+// Detect detects the format of the subtitle from its content, the extension
+// of the file name is used when the content is not conclusive.
+func Detect(text, filename string) Format {
+	trimmed := strings.TrimSpace(text)
+	switch {
+	case strings.HasPrefix(trimmed, "WEBVTT"):
+		return FormatVTT
+	case strings.Contains(trimmed, "[Script Info]") || strings.Contains(trimmed, "[Events]"):
+		return FormatASS
+	case subLineRegex.MatchString(firstLine(trimmed)):
+		return FormatSUB
+	case srtTimingRegex.MatchString(trimmed) || strings.Contains(trimmed, " --> "):
+		return FormatSRT
+	}
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".srt":
+		return FormatSRT
+	case ".vtt":
+		return FormatVTT
+	case ".ass", ".ssa":
+		return FormatASS
+	case ".sub":
+		return FormatSUB
+	}
+	return FormatUnknown
+}
+
+func firstLine(text string) string {
+	if i := strings.IndexByte(text, '\n'); i != -1 {
+		return strings.TrimSpace(text[:i])
+	}
+	return text
+}
+
+// parseTimestamp parses timestamps like 01:02:03,456 or 02:03.456, the
+// fraction is scaled by its number of digits, so ass centiseconds work too.
+func parseTimestamp(value string) (time.Duration, error) {
+
+	value = strings.Replace(strings.TrimSpace(value), ",", ".", 1)
+
+	var fraction time.Duration
+	if i := strings.IndexByte(value, '.'); i != -1 {
+		digits := value[i+1:]
+		n, err := strconv.Atoi(digits)
+		if err != nil {
+			return 0, err
+		}
+		fraction = time.Duration(n) * time.Second
+		for range digits {
+			fraction /= 10
+		}
+		value = value[:i]
+	}
+
+	parts := strings.Split(value, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid timestamp [%s]", value)
+	}
+
+	var total time.Duration
+	for _, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid timestamp [%s]", value)
+		}
+		total = total*60 + time.Duration(n)*time.Second
+	}
+
+	return total + fraction, nil
+}
+
+type lineScanner struct {
+	*bufio.Scanner
+	line int
+}
+
+func newLineScanner(text string) *lineScanner {
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	return &lineScanner{Scanner: scanner}
+}
+
+func (s *lineScanner) Next() (string, bool) {
+	if !s.Scan() {
+		return "", false
+	}
+	s.line++
+	return strings.TrimRight(s.Text(), "\r"), true
+}
+
+// parseTimedBlocks parses srt and vtt, both are blank line separated blocks
+// with an optional identifier, a timing line and the text.
+func parseTimedBlocks(text string, timing *regexp.Regexp, vtt bool) ([]*Cue, []*ParseError) {
+
+	var (
+		cues    = make([]*Cue, 0)
+		errs    = make([]*ParseError, 0)
+		scanner = newLineScanner(text)
+		cue     *Cue
+		skip    bool
+		lines   []string
+	)
+
+	flush := func() {
+		if cue != nil {
+			cue.Text = strings.Join(lines, "\n")
+			if strings.TrimSpace(cue.Text) != "" {
+				cues = append(cues, cue)
+			}
+		}
+		cue, lines, skip = nil, nil, false
+	}
+
+	for {
+		line, ok := scanner.Next()
+		if !ok {
+			break
+		}
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		if skip {
+			continue
+		}
+		if cue != nil {
+			lines = append(lines, line)
+			continue
+		}
+		if vtt && (strings.HasPrefix(line, "WEBVTT") || strings.HasPrefix(line, "NOTE") ||
+			strings.HasPrefix(line, "STYLE") || strings.HasPrefix(line, "REGION")) {
+			skip = true
+			continue
+		}
+		matches := timing.FindStringSubmatch(line)
+		if matches == nil {
+			// cue identifiers and srt indexes come right before the timing line
+			if _, err := strconv.Atoi(strings.TrimSpace(line)); err == nil || vtt {
+				continue
+			}
+			errs = append(errs, &ParseError{Line: scanner.line, Message: "expected a timing line"})
+			skip = true
+			continue
+		}
+		start, err1 := parseTimestamp(matches[1])
+		end, err2 := parseTimestamp(matches[2])
+		if err1 != nil || err2 != nil || end < start {
+			errs = append(errs, &ParseError{Line: scanner.line, Message: "invalid timing"})
+			skip = true
+			continue
+		}
+		cue = &Cue{Start: start, End: end}
+	}
+	flush()
+
+	return cues, errs
+}
+
+func ParseSRT(text string) ([]*Cue, []*ParseError) {
+	return parseTimedBlocks(text, srtTimingRegex, false)
+}
+
+func ParseVTT(text string) ([]*Cue, []*ParseError) {
+	return parseTimedBlocks(text, vttTimingRegex, true)
+}
+
+func cleanASSText(text string) string {
+	text = assOverrideTags.ReplaceAllString(text, "")
+	text = strings.NewReplacer(`\N`, "\n", `\n`, "\n", `\h`, " ").Replace(text)
+	return strings.TrimSpace(text)
+}
+
+// ParseASS parses the dialogue lines of the events section of ass and ssa files.
+func ParseASS(text string) ([]*Cue, []*ParseError) {
+
+	var (
+		cues    = make([]*Cue, 0)
+		errs    = make([]*ParseError, 0)
+		scanner = newLineScanner(text)
+		events  bool
+		columns = []string{"layer", "start", "end", "style", "name", "marginl", "marginr", "marginv", "effect", "text"}
+	)
+
+	for {
+		line, ok := scanner.Next()
+		if !ok {
+			break
+		}
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			events = strings.EqualFold(line, "[Events]")
+			continue
+		}
+		if !events {
+			continue
+		}
+		key, value := line, ""
+		if i := strings.IndexByte(line, ':'); i != -1 {
+			key, value = line[:i], strings.TrimSpace(line[i+1:])
+		}
+		switch key {
+		case "Format":
+			columns = columns[:0]
+			for _, column := range strings.Split(value, ",") {
+				columns = append(columns, strings.ToLower(strings.TrimSpace(column)))
+			}
+		case "Dialogue":
+			// the text is the last column and may contain commas
+			fields := strings.SplitN(value, ",", len(columns))
+			if len(fields) != len(columns) {
+				errs = append(errs, &ParseError{Line: scanner.line, Message: "dialogue has missing fields"})
+				continue
+			}
+			cue := new(Cue)
+			var err1, err2 error
+			for i, column := range columns {
+				switch column {
+				case "start":
+					cue.Start, err1 = parseTimestamp(fields[i])
+				case "end":
+					cue.End, err2 = parseTimestamp(fields[i])
+				case "text":
+					cue.Text = cleanASSText(fields[i])
+				}
+			}
+			if err1 != nil || err2 != nil || cue.End < cue.Start {
+				errs = append(errs, &ParseError{Line: scanner.line, Message: "invalid timing"})
+				continue
+			}
+			if cue.Text != "" {
+				cues = append(cues, cue)
+			}
+		}
+	}
+
+	return cues, errs
+}
+
+// ParseSUB parses MicroDVD subtitles, their timings are frame numbers.
+func ParseSUB(text string) ([]*Cue, []*ParseError) {
+
+	var (
+		cues      = make([]*Cue, 0)
+		errs      = make([]*ParseError, 0)
+		scanner   = newLineScanner(text)
+		frameRate = defaultFrameRate
+	)
+
+	frame := func(value string) time.Duration {
+		n, _ := strconv.ParseFloat(value, 64)
+		return time.Duration(n / frameRate * float64(time.Second))
+	}
+
+	for {
+		line, ok := scanner.Next()
+		if !ok {
+			break
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		matches := subLineRegex.FindStringSubmatch(strings.TrimSpace(line))
+		if matches == nil {
+			errs = append(errs, &ParseError{Line: scanner.line, Message: "expected {start}{end}text"})
+			continue
+		}
+		// the first line may declare the frame rate like {1}{1}25.000
+		if len(cues) == 0 && matches[1] == "1" && matches[2] == "1" {
+			if rate, err := strconv.ParseFloat(strings.TrimSpace(matches[3]), 64); err == nil && rate > 0 {
+				frameRate = rate
+				continue
+			}
+		}
+		cue := &Cue{
+			Start: frame(matches[1]),
+			End:   frame(matches[2]),
+			Text:  strings.TrimSpace(strings.ReplaceAll(subStyleTags.ReplaceAllString(matches[3], ""), "|", "\n")),
+		}
+		if cue.End < cue.Start {
+			errs = append(errs, &ParseError{Line: scanner.line, Message: "invalid timing"})
+			continue
+		}
+		if cue.Text != "" {
+			cues = append(cues, cue)
+		}
+	}
+
+	return cues, errs
+}
+
+// Process decodes and parses the subtitle file, the cues can be written as WebVTT.
+func Process(data []byte, filename, lang string) (*Result, error) {
+
+	text, encodingName, err := Decode(data, lang)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode subtitle: %v", err)
+	}
+
+	result := &Result{
+		Format:   Detect(text, filename),
+		Encoding: encodingName,
+	}
+
+	switch result.Format {
+	case FormatSRT:
+		result.Cues, result.Errors = ParseSRT(text)
+	case FormatVTT:
+		result.Cues, result.Errors = ParseVTT(text)
+	case FormatASS:
+		result.Cues, result.Errors = ParseASS(text)
+	case FormatSUB:
+		result.Cues, result.Errors = ParseSUB(text)
+	default:
+		return result, errors.New("subtitle format is not supported, use srt, vtt, ass, ssa or sub")
+	}
+
+	if len(result.Cues) == 0 {
+		return result, ErrNoCues
+	}
+
+	return result, nil
+}
+
+func formatTimestamp(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// cleanCueText keeps the tags that WebVTT supports and escapes the rest of the text.
+func cleanCueText(text string) string {
+	text = htmlTags.ReplaceAllStringFunc(text, func(tag string) string {
+		name := strings.ToLower(htmlTags.FindStringSubmatch(tag)[1])
+		switch name {
+		case "i", "b", "u":
+			if strings.HasPrefix(tag, "</") {
+				return "\x00/" + name + "\x01"
+			}
+			return "\x00" + name + "\x01"
+		}
+		return ""
+	})
+	text = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+	text = strings.NewReplacer("\x00", "<", "\x01", ">").Replace(text)
+	lines := make([]string, 0)
+	for _, line := range strings.Split(text, "\n") {
+		// blank lines would end the cue
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// WebVTT writes the cues as a WebVTT file.
+func WebVTT(cues []*Cue) []byte {
+	builder := new(strings.Builder)
+	builder.WriteString("WEBVTT\n")
+	for _, cue := range cues {
+		text := cleanCueText(cue.Text)
+		if text == "" {
+			continue
+		}
+		fmt.Fprintf(builder, "\n%s --> %s\n%s\n", formatTimestamp(cue.Start), formatTimestamp(cue.End), text)
+	}
+	return []byte(builder.String())
+}
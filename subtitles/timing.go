@@ -0,0 +1,52 @@
+package subtitles
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrInvalidAnchors = errors.New("subtitle anchors should be two different points in increasing order")
+
+// Anchor maps a time of the subtitle file to the time it should be shown at.
+type Anchor struct {
+	From time.Duration
+	To   time.Duration
+}
+
+// retime maps the cue timings, cues that would end before the start of the
+// media are dropped and the others start at zero at the earliest.
+func retime(cues []*Cue, mapTime func(time.Duration) time.Duration) []*Cue {
+	result := make([]*Cue, 0, len(cues))
+	for _, cue := range cues {
+		start, end := mapTime(cue.Start), mapTime(cue.End)
+		if end <= 0 {
+			continue
+		}
+		if start < 0 {
+			start = 0
+		}
+		result = append(result, &Cue{Start: start, End: end, Text: cue.Text})
+	}
+	return result
+}
+
+// Shift moves all the cues by the offset, negative offsets show them earlier.
+func Shift(cues []*Cue, offset time.Duration) []*Cue {
+	return retime(cues, func(d time.Duration) time.Duration {
+		return d + offset
+	})
+}
+
+// Stretch maps the cues linearly so the first and second anchors land on
+// their new times, which fixes subtitles made for a different frame rate or cut.
+func Stretch(cues []*Cue, first, second Anchor) ([]*Cue, error) {
+
+	if second.From <= first.From || second.To <= first.To {
+		return nil, ErrInvalidAnchors
+	}
+
+	scale := float64(second.To-first.To) / float64(second.From-first.From)
+	return retime(cues, func(d time.Duration) time.Duration {
+		return first.To + time.Duration(float64(d-first.From)*scale)
+	}), nil
+}
@@ -62,9 +62,20 @@ var defaultConfig = &config.Map{
 		},
 	},
 	S3: config.S3Map{
-		Endpoint:  "127.0.0.1:9000",
-		AccessKey: "secret-access-key",
-		SecretKey: "secret-key",
+		Driver:            "minio",
+		Endpoint:          "127.0.0.1:9000",
+		AccessKey:         "secret-access-key",
+		SecretKey:         "secret-key",
+		UseTLS:            false,
+		Region:            "",
+		Path:              "./storage",
+		AutoCreateBuckets: true,
+		Buckets: config.BucketsMap{
+			Avatars:   "avatars",
+			Banners:   "banners",
+			Posters:   "posters",
+			Subtitles: "subtitles",
+		},
 	},
 	Sentry: config.SentryMap{
 		Enabled: false,
@@ -75,6 +86,70 @@ var defaultConfig = &config.Map{
 		Type:    "hcaptcha",
 		Secret:  "hcaptcha-secret-token",
 	},
+	Jobs: config.JobsMap{
+		FriendSuggestions: config.JobMap{
+			Enabled:  true,
+			Interval: "1h",
+		},
+		StorageGC: config.StorageGCJobMap{
+			JobMap: config.JobMap{
+				Enabled:  true,
+				Interval: "6h",
+			},
+			GracePeriod: "24h",
+			DryRun:      true,
+		},
+		TrackExtraction: config.MediaJobMap{
+			JobMap: config.JobMap{
+				Enabled:  true,
+				Interval: "30s",
+			},
+			Timeout:     "30m",
+			MaxAttempts: 3,
+		},
+		Thumbnails: config.MediaJobMap{
+			JobMap: config.JobMap{
+				Enabled:  true,
+				Interval: "30s",
+			},
+			Timeout:     "1h",
+			MaxAttempts: 3,
+		},
+	},
+	Users: config.UsersMap{
+		UsernameChangeCooldown: "720h",
+		UsernameReclaimAfter:   "2160h",
+	},
+	Uploads: config.UploadsMap{
+		Bucket:        "uploads",
+		MaxFileSizeMB: 2048,
+		UserQuotaMB:   10240,
+		URLExpiry:     "1h",
+	},
+	Probe: config.ProbeMap{
+		FFprobePath:      "ffprobe",
+		FFmpegPath:       "ffmpeg",
+		Timeout:          "30s",
+		RejectUnplayable: true,
+	},
+	Metadata: config.MetadataMap{
+		Enabled:      false,
+		Provider:     "tmdb",
+		BaseURL:      "https://api.themoviedb.org/3",
+		ImageBaseURL: "https://image.tmdb.org/t/p/w500",
+		APIKey:       "",
+		Language:     "en-US",
+		Timeout:      "10s",
+		CacheTTL:     "168h",
+	},
+	MediaURIs: config.MediaURIsMap{
+		AllowedHosts:      []string{},
+		DeniedHosts:       []string{},
+		CheckReachability: true,
+		Timeout:           "10s",
+		RequireRanges:     false,
+		CORSOrigin:        "https://casty.ir",
+	},
 }
 
 func TestLoadConfig(t *testing.T) {
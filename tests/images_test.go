@@ -0,0 +1,80 @@
+package tests
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/castyapp/grpc.server/images"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessImage(t *testing.T) {
+
+	src := image.NewRGBA(image.Rect(0, 0, 800, 400))
+	for x := 0; x < 800; x++ {
+		for y := 0; y < 400; y++ {
+			src.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 100, A: 255})
+		}
+	}
+
+	buffer := new(bytes.Buffer)
+	if err := jpeg.Encode(buffer, src, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	variants, err := images.Process(buffer.Bytes(), images.Avatar)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Len(t, variants, len(images.Avatar.Sizes))
+	for i, variant := range variants {
+		img, err := png.Decode(bytes.NewReader(variant.Data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		size := images.Avatar.Sizes[i]
+		assert.Equal(t, size.Width, img.Bounds().Dx())
+		assert.Equal(t, size.Height, img.Bounds().Dy())
+	}
+
+	t.Run("Unsupported", func(t *testing.T) {
+		_, err := images.Process([]byte("<svg xmlns=\"http://www.w3.org/2000/svg\"></svg>"), images.Avatar)
+		assert.Equal(t, images.ErrUnsupportedFormat, err)
+	})
+
+	t.Run("TooLarge", func(t *testing.T) {
+		spec := images.Avatar
+		spec.MaxBytes = 10
+		_, err := images.Process(buffer.Bytes(), spec)
+		assert.Equal(t, images.ErrTooLarge, err)
+	})
+}
+
+func TestConvertImage(t *testing.T) {
+
+	src := image.NewRGBA(image.Rect(0, 0, 300, 450))
+	buffer := new(bytes.Buffer)
+	if err := jpeg.Encode(buffer, src, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := images.Convert(buffer.Bytes(), 10<<20, images.PNG)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 300, img.Bounds().Dx())
+	assert.Equal(t, 450, img.Bounds().Dy())
+
+	_, err = images.Convert(buffer.Bytes(), 10, images.PNG)
+	assert.Equal(t, images.ErrTooLarge, err)
+}
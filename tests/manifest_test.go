@@ -0,0 +1,136 @@
+package tests
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/castyapp/grpc.server/manifest"
+	"github.com/stretchr/testify/assert"
+)
+
+const masterPlaylist = `#EXTM3U
+#EXT-X-VERSION:6
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",LANGUAGE="en",DEFAULT=YES,AUTOSELECT=YES,URI="audio/en.m3u8"
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="Deutsch, forced",LANGUAGE="de",FORCED=YES,URI="subs/de.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=2500000,RESOLUTION=1280x720,CODECS="avc1.4d401f,mp4a.40.2",FRAME-RATE=29.970,AUDIO="aac",SUBTITLES="subs"
+720p/index.m3u8
+#EXT-X-I-FRAME-STREAM-INF:BANDWIDTH=90000,URI="720p/iframes.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360,CODECS="avc1.4d401e,mp4a.40.2"
+https://cdn.example.com/360p/index.m3u8
+`
+
+const mediaPlaylist = `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXTINF:9.009,
+segment0.ts
+#EXTINF:9.009,
+segment1.ts
+#EXTINF:3.003,
+segment2.ts
+#EXT-X-ENDLIST
+`
+
+const dashManifest = `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" type="static" mediaPresentationDuration="PT1H2M3.5S">
+  <Period>
+    <AdaptationSet id="1" mimeType="video/mp4" codecs="avc1.640028" frameRate="30000/1001">
+      <Representation id="1080p" bandwidth="5000000" width="1920" height="1080"/>
+      <Representation id="480p" bandwidth="1000000" width="854" height="480"/>
+    </AdaptationSet>
+    <AdaptationSet id="2" mimeType="audio/mp4" lang="fr">
+      <Role schemeIdUri="urn:mpeg:dash:role:2011" value="main"/>
+      <Representation id="audio" bandwidth="128000" codecs="mp4a.40.2"/>
+    </AdaptationSet>
+    <AdaptationSet id="3" mimeType="text/vtt" lang="en">
+      <Label>English</Label>
+      <Representation id="subs" bandwidth="256">
+        <BaseURL>subs/en.vtt</BaseURL>
+      </Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>`
+
+func TestManifestHLS(t *testing.T) {
+
+	base, _ := url.Parse("https://example.com/movie/master.m3u8")
+
+	master, err := manifest.Parse([]byte(masterPlaylist), base)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, manifest.FormatHLS, master.Format)
+	assert.Len(t, master.Variants, 2)
+	assert.Equal(t, int64(2500000), master.Variants[0].Bandwidth)
+	assert.Equal(t, 1280, master.Variants[0].Width)
+	assert.Equal(t, 720, master.Variants[0].Height)
+	assert.Equal(t, "avc1.4d401f,mp4a.40.2", master.Variants[0].Codecs)
+	assert.Equal(t, 29.97, master.Variants[0].FrameRate)
+	assert.Equal(t, "aac", master.Variants[0].AudioGroup)
+	assert.Equal(t, "https://example.com/movie/720p/index.m3u8", master.Variants[0].URI)
+	assert.Equal(t, "https://cdn.example.com/360p/index.m3u8", master.Variants[1].URI)
+	assert.Len(t, master.AudioRenditions, 1)
+	assert.True(t, master.AudioRenditions[0].Default)
+	assert.Len(t, master.SubtitleRenditions, 1)
+	assert.Equal(t, "Deutsch, forced", master.SubtitleRenditions[0].Name)
+	assert.True(t, master.SubtitleRenditions[0].Forced)
+	assert.Equal(t, "https://example.com/movie/subs/de.m3u8", master.SubtitleRenditions[0].URI)
+
+	playlist, err := manifest.Parse([]byte(mediaPlaylist), base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, playlist.Live)
+	assert.Equal(t, 21.021, playlist.Duration)
+
+	live, err := manifest.Parse([]byte("#EXTM3U\n#EXTINF:6.0,\nsegment100.ts\n#EXTINF:6.0,\nsegment101.ts\n"), base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, live.Live)
+	assert.Zero(t, live.Duration)
+
+	_, err = manifest.Parse([]byte("#EXTM3U\n#EXT-X-ENDLIST\n"), base)
+	assert.Equal(t, manifest.ErrEmpty, err)
+
+	_, err = manifest.Parse([]byte("<html></html>"), base)
+	assert.Equal(t, manifest.ErrNotManifest, err)
+
+	assert.Equal(t, manifest.FormatHLS, manifest.Detect("https://example.com/live/index.M3U8?token=1"))
+	assert.Equal(t, manifest.FormatDASH, manifest.Detect("https://example.com/movie.mpd"))
+	assert.Equal(t, "", manifest.Detect("https://example.com/movie.mp4"))
+}
+
+func TestManifestDASH(t *testing.T) {
+
+	base, _ := url.Parse("https://example.com/movie/manifest.mpd")
+
+	result, err := manifest.Parse([]byte(dashManifest), base)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, manifest.FormatDASH, result.Format)
+	assert.False(t, result.Live)
+	assert.Equal(t, 3723.5, result.Duration)
+	assert.Len(t, result.Variants, 2)
+	assert.Equal(t, 1920, result.Variants[0].Width)
+	assert.Equal(t, "avc1.640028", result.Variants[0].Codecs)
+	assert.Equal(t, 29.97, result.Variants[0].FrameRate)
+	assert.Len(t, result.AudioRenditions, 1)
+	assert.Equal(t, "fr", result.AudioRenditions[0].Language)
+	assert.Equal(t, "mp4a.40.2", result.AudioRenditions[0].Codecs)
+	assert.True(t, result.AudioRenditions[0].Default)
+	assert.Len(t, result.SubtitleRenditions, 1)
+	assert.Equal(t, "English", result.SubtitleRenditions[0].Name)
+	assert.Equal(t, "https://example.com/movie/subs/en.vtt", result.SubtitleRenditions[0].URI)
+
+	live, err := manifest.Parse([]byte(`<MPD type="dynamic"><Period><AdaptationSet contentType="video"><Representation bandwidth="1"/></AdaptationSet></Period></MPD>`), base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, live.Live)
+
+	_, err = manifest.Parse([]byte(`<MPD mediaPresentationDuration="P1Y"><Period><AdaptationSet contentType="video"><Representation bandwidth="1"/></AdaptationSet></Period></MPD>`), base)
+	assert.Equal(t, manifest.ErrInvalid, err)
+}
@@ -0,0 +1,100 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/castyapp/grpc.server/config"
+	"github.com/castyapp/grpc.server/metadata"
+	"github.com/castyapp/grpc.server/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetadataParseFilename(t *testing.T) {
+
+	tests := map[string]metadata.Query{
+		"Show.Name.S01E02.1080p.WEB-DL.x264.mkv":    {Title: "Show Name", Season: 1, Episode: 2},
+		"show_name_1x05_hdtv.avi":                   {Title: "show name", Season: 1, Episode: 5},
+		"The.Matrix.1999.1080p.BluRay.x264-GRP.mp4": {Title: "The Matrix", Year: 1999},
+		"Inception (2010) [1080p] [YTS].mp4":        {Title: "Inception", Year: 2010},
+		"2001.A.Space.Odyssey.1968.720p.mkv":        {Title: "2001 A Space Odyssey", Year: 1968},
+		"/home/user/videos/Heat.1995.mkv":           {Title: "Heat", Year: 1995},
+		"Spirited Away":                             {Title: "Spirited Away"},
+	}
+
+	for filename, expected := range tests {
+		assert.Equal(t, expected, metadata.ParseFilename(filename), filename)
+	}
+}
+
+func TestMetadataTMDB(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("api_key") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/search/movie":
+			assert.Equal(t, "the matrix", r.URL.Query().Get("query"))
+			assert.Equal(t, "1999", r.URL.Query().Get("year"))
+			w.Write([]byte(`{"results":[{"id":603,"title":"The Matrix","release_date":"1999-03-30","overview":"Neo","poster_path":"/matrix.jpg"}]}`))
+		case "/search/tv":
+			w.Write([]byte(`{"results":[{"id":1399,"name":"Game of Thrones","first_air_date":"2011-04-17"}]}`))
+		case "/tv/1399":
+			w.Write([]byte(`{"id":1399,"name":"Game of Thrones","first_air_date":"2011-04-17","overview":"Seven kingdoms","genres":[{"name":"Drama"}],"episode_run_time":[60]}`))
+		case "/tv/1399/season/1/episode/2":
+			w.Write([]byte(`{"name":"The Kingsroad","overview":"The king rides north","runtime":56}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	provider, err := metadata.NewProvider(config.MetadataMap{
+		Provider:     "tmdb",
+		BaseURL:      server.URL,
+		ImageBaseURL: "https://images.example.com/w500/",
+		APIKey:       "secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	movies, err := provider.Search(ctx, metadata.Query{Title: "the matrix", Year: 1999})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, movies, 1)
+	assert.Equal(t, "movie:603", movies[0].ID)
+	assert.Equal(t, 1999, movies[0].Year)
+	assert.Equal(t, "https://images.example.com/w500/matrix.jpg", movies[0].Poster)
+	assert.Equal(t, "The Matrix (1999)", metadata.DisplayTitle(movies[0]))
+
+	shows, err := provider.Search(ctx, metadata.Query{Title: "game of thrones", Season: 1, Episode: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, shows, 1)
+	assert.Equal(t, "tv:1399:1:2", shows[0].ID)
+
+	episode, err := provider.Get(ctx, shows[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, models.MediaMetadataEpisode, episode.Kind)
+	assert.Equal(t, "The king rides north", episode.Synopsis)
+	assert.Equal(t, 56, episode.Runtime)
+	assert.Equal(t, []string{"Drama"}, episode.Genres)
+	assert.Equal(t, "Game of Thrones S01E02 - The Kingsroad", metadata.DisplayTitle(episode))
+
+	_, err = provider.Get(ctx, "movie:404")
+	assert.Equal(t, metadata.ErrNotFound, err)
+
+	_, err = provider.Get(ctx, "movie:../../account")
+	assert.Equal(t, metadata.ErrInvalidID, err)
+}
@@ -0,0 +1,54 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/castyapp/grpc.server/models"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestPlaybackState(t *testing.T) {
+
+	var (
+		theaterID     = primitive.NewObjectID()
+		mediaSourceID = primitive.NewObjectID()
+		userID        = primitive.NewObjectID()
+		start         = time.Date(2020, 1, 1, 20, 0, 0, 0, time.UTC)
+		state         = models.NewPlaybackState(&theaterID, &mediaSourceID, 600, start)
+	)
+
+	// paused media stays where it is
+	assert.Equal(t, 0.0, state.PositionAt(start.Add(time.Minute)))
+
+	state.Play(&userID, start.Add(10*time.Second))
+	assert.False(t, state.Paused)
+	assert.Equal(t, &userID, state.UpdatedBy)
+	assert.Equal(t, 30.0, state.PositionAt(start.Add(40*time.Second)))
+
+	assert.NoError(t, state.SetRate(&userID, 2, start.Add(40*time.Second)))
+	assert.Equal(t, 30.0, state.Position)
+	assert.Equal(t, 50.0, state.PositionAt(start.Add(50*time.Second)))
+
+	state.Pause(&userID, start.Add(50*time.Second))
+	assert.True(t, state.Paused)
+	assert.Equal(t, 50.0, state.PositionAt(start.Add(time.Hour)))
+
+	assert.NoError(t, state.Seek(&userID, 590, start.Add(time.Minute)))
+	state.Play(&userID, start.Add(time.Minute))
+	// the position stops at the end of the media
+	assert.Equal(t, 600.0, state.PositionAt(start.Add(time.Hour)))
+	assert.Equal(t, int64(5), state.Version)
+
+	assert.Equal(t, models.ErrInvalidPosition, state.Seek(&userID, 601, start))
+	assert.Equal(t, models.ErrInvalidPosition, state.Seek(&userID, -1, start))
+	assert.Equal(t, models.ErrInvalidPlaybackRate, state.SetRate(&userID, 0, start))
+	assert.Equal(t, int64(5), state.Version)
+
+	// media that was read again with a shorter length moves the position to its new end
+	state.SetLength(300, start.Add(2*time.Minute))
+	assert.Equal(t, 300.0, state.Position)
+	assert.Equal(t, 300.0, state.PositionAt(start.Add(time.Hour)))
+	assert.Equal(t, int64(6), state.Version)
+}
@@ -0,0 +1,52 @@
+package tests
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/castyapp/grpc.server/models"
+	"github.com/castyapp/grpc.server/probe"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProbeParse(t *testing.T) {
+
+	data, err := ioutil.ReadFile("ffprobe_test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := probe.Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 5.013, result.Duration)
+	assert.Equal(t, int64(259390), result.Bitrate)
+	assert.Equal(t, "h264", result.VideoCodec)
+	assert.Equal(t, "aac", result.AudioCodec)
+	assert.Equal(t, 1280, result.Width)
+	assert.Equal(t, 720, result.Height)
+	assert.Len(t, result.AudioTracks, 2)
+	assert.Equal(t, "eng", result.AudioTracks[0].Language)
+	assert.True(t, result.AudioTracks[0].Default)
+	assert.Len(t, result.SubtitleTracks, 1)
+	assert.True(t, probe.IsTextSubtitle(result.SubtitleTracks[0]))
+	assert.False(t, probe.IsTextSubtitle(&models.MediaTrack{Codec: "hdmv_pgs_subtitle"}))
+	assert.NoError(t, probe.CheckPlayable(result))
+
+	t.Run("Unplayable", func(t *testing.T) {
+		hevc := *result
+		hevc.Container = "matroska,webm"
+		hevc.VideoCodec = "hevc"
+		assert.IsType(t, &probe.UnplayableError{}, probe.CheckPlayable(&hevc))
+
+		avi := &models.MediaProbe{Container: "avi", VideoCodec: "h264"}
+		assert.IsType(t, &probe.UnplayableError{}, probe.CheckPlayable(avi))
+	})
+
+	t.Run("NoStreams", func(t *testing.T) {
+		_, err := probe.Parse([]byte(`{"streams": [], "format": {"format_name": "mp4"}}`))
+		assert.Equal(t, probe.ErrNoStreams, err)
+	})
+}
@@ -0,0 +1,98 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/castyapp/grpc.server/models"
+	"github.com/castyapp/grpc.server/search"
+	"github.com/castyapp/libcasty-protocol-go/proto"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func mockSearchUser(username, fullname string) *models.User {
+	id := primitive.NewObjectID()
+	return &models.User{ID: &id, Username: username, Fullname: fullname}
+}
+
+func TestSearchRanking(t *testing.T) {
+
+	var (
+		exact    = mockSearchUser("mosi", "Mostafa")
+		prefix   = mockSearchUser("mosiman", "Someone Else")
+		friend   = mockSearchUser("mosizadeh", "Ali")
+		fullname = mockSearchUser("ali", "Ali Mosi")
+		stranger = mockSearchUser("john", "John Doe")
+	)
+
+	friends := map[string]bool{friend.ID.Hex(): true}
+	candidates := []*models.User{stranger, fullname, prefix, friend, exact}
+
+	results := search.Rank(candidates, "Mosi", friends)
+	usernames := make([]string, 0)
+	for _, result := range results {
+		usernames = append(usernames, result.User.Username)
+	}
+
+	assert.Equal(t, []string{"mosi", "mosizadeh", "mosiman", "ali"}, usernames)
+
+	t.Run("Paginate", func(t *testing.T) {
+
+		first, err := search.Paginate(results, "", 2)
+		assert.NoError(t, err)
+		assert.Len(t, first.Results, 2)
+		assert.NotEmpty(t, first.NextCursor)
+
+		second, err := search.Paginate(results, first.NextCursor, 2)
+		assert.NoError(t, err)
+		assert.Len(t, second.Results, 2)
+		assert.Equal(t, "mosiman", second.Results[0].User.Username)
+		assert.Empty(t, second.NextCursor)
+
+		_, err = search.Paginate(results, "not a cursor", 2)
+		assert.Equal(t, search.ErrInvalidCursor, err)
+	})
+
+	t.Run("LiteralKeyword", func(t *testing.T) {
+		results := search.Rank([]*models.User{mockSearchUser("a.b", "A B")}, ".*", nil)
+		assert.Empty(t, results)
+	})
+}
+
+func TestSearchMediaFilter(t *testing.T) {
+
+	tags, err := search.NormalizeTags([]string{" Anime ", "anime", "Watch  Later", ""})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"anime", "watch later"}, tags)
+
+	_, err = search.NormalizeTags([]string{"$where"})
+	assert.Equal(t, search.ErrInvalidTag, err)
+
+	var (
+		userID       = primitive.NewObjectID()
+		collectionID = primitive.NewObjectID()
+	)
+
+	filter, err := search.MediaFilter(&userID, search.MediaQuery{
+		Keyword:      "a.*b",
+		Type:         proto.MediaSource_M3U8,
+		CollectionID: &collectionID,
+		Tags:         []string{"Anime"},
+		Series:       "Show",
+		Season:       2,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, &userID, filter["user_id"])
+	assert.Equal(t, proto.MediaSource_M3U8, filter["type"])
+	assert.Equal(t, &collectionID, filter["collection_id"])
+	assert.Equal(t, bson.M{"$all": []string{"anime"}}, filter["tags"])
+	assert.Equal(t, 2, filter["series.season"])
+	// keywords are matched literally
+	assert.Contains(t, filter["$or"], bson.M{"title": bson.M{"$regex": `a\.\*b`, "$options": "i"}})
+
+	filter, err = search.MediaFilter(&userID, search.MediaQuery{Unfiled: true, Sort: search.SortEpisode})
+	assert.NoError(t, err)
+	assert.Equal(t, bson.M{"$exists": false}, filter["collection_id"])
+	assert.Equal(t, bson.M{"$exists": true}, filter["series"])
+}
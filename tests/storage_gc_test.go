@@ -0,0 +1,66 @@
+package tests
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/castyapp/grpc.server/config"
+	"github.com/castyapp/grpc.server/jobs"
+	"github.com/castyapp/grpc.server/models"
+	"github.com/castyapp/grpc.server/storage"
+	"github.com/castyapp/grpc.server/uploads"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestStorageGCKeepsSprites(t *testing.T) {
+
+	mockConext, err := newContext()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dropDatabase(t)
+	defer dropDatabase(t)
+
+	previous := storage.Client
+	storage.Client = storage.NewMemoryBackend()
+	defer func() { storage.Client = previous }()
+
+	var (
+		db            = mockConext.MustGet("db.mongo").(*mongo.Database)
+		bucket        = mockConext.MustGet("config.map").(*config.Map).Uploads.GetBucket()
+		userID        = primitive.NewObjectID()
+		mediaSourceID = primitive.NewObjectID()
+		prefix        = uploads.MediaAssetsPrefix(&userID, &mediaSourceID)
+		sprite        = prefix + "thumbnails/sprite-0.jpg"
+		orphan        = prefix + "thumbnails/sprite-removed.jpg"
+	)
+
+	for _, b := range []string{storage.Buckets.Avatars, storage.Buckets.Banners, storage.Buckets.Posters, storage.Buckets.Subtitles, bucket} {
+		assert.NoError(t, storage.Client.EnsureBucket(b))
+	}
+
+	for _, key := range []string{sprite, orphan} {
+		assert.NoError(t, storage.Client.Put(bucket, key, strings.NewReader("jpg"), 3, "image/jpeg"))
+	}
+
+	_, err = db.Collection("media_sources").InsertOne(context.TODO(), &models.MediaSource{
+		ID:         &mediaSourceID,
+		UserID:     &userID,
+		Thumbnails: &models.MediaThumbnails{Sprites: []string{sprite}},
+	})
+	assert.NoError(t, err)
+
+	if _, err := jobs.NewStorageGC(0, false).Reconcile(mockConext); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = storage.Client.Stat(bucket, sprite)
+	assert.NoError(t, err)
+
+	_, err = storage.Client.Stat(bucket, orphan)
+	assert.Equal(t, storage.ErrNotFound, err)
+}
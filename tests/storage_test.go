@@ -0,0 +1,163 @@
+package tests
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/castyapp/grpc.server/helpers"
+	"github.com/castyapp/grpc.server/models"
+	"github.com/castyapp/grpc.server/services"
+	"github.com/castyapp/grpc.server/storage"
+	"github.com/castyapp/grpc.server/uploads"
+	"github.com/castyapp/libcasty-protocol-go/proto"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func testStorageBackend(t *testing.T, backend storage.Backend) {
+
+	if err := backend.EnsureBucket("posters"); err != nil {
+		t.Fatal(err)
+	}
+
+	err := backend.Put("posters", "users/1/poster.png", strings.NewReader("poster"), 6, "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	object, err := backend.Stat("posters", "users/1/poster.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, int64(6), object.Size)
+	assert.Equal(t, "image/png", object.ContentType)
+
+	reader, _, err := backend.Get("posters", "users/1/poster.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(reader)
+	reader.Close()
+	assert.Equal(t, "poster", string(data))
+
+	_ = backend.Put("posters", "users/2/poster.png", strings.NewReader("other"), 5, "image/png")
+	objects, err := backend.List("posters", "users/1/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, objects, 1)
+	assert.Equal(t, "users/1/poster.png", objects[0].Key)
+
+	assert.NoError(t, backend.Delete("posters", "users/1/poster.png"))
+	_, err = backend.Stat("posters", "users/1/poster.png")
+	assert.Equal(t, storage.ErrNotFound, err)
+}
+
+func TestMemoryStorageBackend(t *testing.T) {
+	testStorageBackend(t, storage.NewMemoryBackend())
+}
+
+func TestFilesystemStorageBackend(t *testing.T) {
+
+	root, err := ioutil.TempDir("", "casty-storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	backend, err := storage.NewFilesystemBackend(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testStorageBackend(t, backend)
+
+	t.Run("InvalidKeys", func(t *testing.T) {
+		for _, key := range []string{"../secret", "/etc/passwd", "a/../../b", ""} {
+			err := backend.Put("posters", key, strings.NewReader("x"), 1, "text/plain")
+			assert.Equal(t, storage.ErrInvalidKey, err, key)
+		}
+	})
+}
+
+func TestStorageOrphans(t *testing.T) {
+
+	var (
+		now     = time.Now()
+		cutoff  = now.Add(-time.Hour)
+		objects = []*storage.Object{
+			{Key: "1234.png", LastModified: now.Add(-2 * time.Hour)},
+			{Key: "1234_256x256.png", LastModified: now.Add(-2 * time.Hour)},
+			{Key: "5678.png", LastModified: now.Add(-2 * time.Hour)},
+			{Key: "5678_64x64.png", LastModified: now.Add(-2 * time.Hour)},
+			{Key: "9999.png", LastModified: now},
+		}
+		referenced = map[string]bool{"1234": true}
+	)
+
+	orphans := storage.Orphans(objects, func(key string) bool {
+		return referenced[services.ImageNameFromObject(key)]
+	}, cutoff)
+
+	keys := make([]string, 0)
+	for _, orphan := range orphans {
+		keys = append(keys, orphan.Key)
+	}
+
+	assert.Equal(t, []string{"5678.png", "5678_64x64.png"}, keys)
+	assert.Equal(t, "my_avatar", services.ImageNameFromObject("my_avatar.png"))
+}
+
+func TestStorageObjectURI(t *testing.T) {
+
+	bucket, key, ok := storage.ParseObjectURI(storage.ObjectURI("uploads", "users/1/video.mp4"))
+	assert.True(t, ok)
+	assert.Equal(t, "uploads", bucket)
+	assert.Equal(t, "users/1/video.mp4", key)
+
+	for _, uri := range []string{"https://casty.ir/video.mp4", "s3://uploads", "s3:///key"} {
+		_, _, ok := storage.ParseObjectURI(uri)
+		assert.False(t, ok, uri)
+	}
+
+	assert.Equal(t, "https://casty.ir/video.mp4", storage.ReadURL("https://casty.ir/video.mp4"))
+}
+
+// presignBackend presigns every object so the urls that clients get can be told apart.
+type presignBackend struct {
+	storage.Backend
+}
+
+func (presignBackend) Presign(method, bucket, key string, expiry time.Duration) (string, error) {
+	return "https://storage.casty.ir/" + bucket + "/" + key, nil
+}
+
+func TestMediaSourceObjectURL(t *testing.T) {
+
+	previous := storage.Client
+	storage.Client = presignBackend{storage.NewMemoryBackend()}
+	defer func() { storage.Client = previous }()
+
+	var (
+		id     = primitive.NewObjectID()
+		userID = primitive.NewObjectID()
+		other  = primitive.NewObjectID()
+		own    = uploads.UserPrefix(&userID) + "video/1.mp4"
+		stolen = uploads.UserPrefix(&other) + "video/2.mp4"
+	)
+
+	uploaded := &models.MediaSource{ID: &id, UserID: &userID, URI: storage.ObjectURI("uploads", own), ObjectKey: own}
+	assert.Equal(t, "https://storage.casty.ir/uploads/"+own, helpers.NewMediaSourceProto(uploaded).Uri)
+
+	// an object uri that is not the upload of the media source is never presigned
+	for _, mediaSource := range []*models.MediaSource{
+		{ID: &id, UserID: &userID, URI: storage.ObjectURI("uploads", stolen), Type: proto.MediaSource_LOCAL_PATH},
+		{ID: &id, UserID: &userID, URI: storage.ObjectURI("uploads", stolen), ObjectKey: own},
+		{ID: &id, UserID: &userID, URI: storage.ObjectURI("uploads", stolen), ObjectKey: stolen},
+	} {
+		assert.Empty(t, helpers.NewMediaSourceProto(mediaSource).Uri, mediaSource.URI)
+	}
+}
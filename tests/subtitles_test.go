@@ -0,0 +1,128 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/castyapp/grpc.server/subtitles"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/encoding/charmap"
+)
+
+func TestSubtitlesProcess(t *testing.T) {
+
+	t.Run("SRT", func(t *testing.T) {
+		srt := "1\r\n00:00:01,000 --> 00:00:02,500\r\n<i>Hello</i> <font color=\"red\">there</font>\r\n\r\n" +
+			"2\r\nbroken timing\r\n\r\n" +
+			"3\r\n00:01:00.000 --> 00:01:03,000\r\nSecond line\r\nwith --> arrow\r\n"
+
+		result, err := subtitles.Process([]byte(srt), "movie.srt", "en")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, subtitles.FormatSRT, result.Format)
+		assert.Equal(t, subtitles.EncodingUTF8, result.Encoding)
+		assert.Len(t, result.Cues, 2)
+		assert.Len(t, result.Errors, 1)
+		assert.Equal(t, 6, result.Errors[0].Line)
+		assert.Equal(t, time.Minute+3*time.Second, result.Cues[1].End)
+		assert.Equal(t, "WEBVTT\n\n"+
+			"00:00:01.000 --> 00:00:02.500\n<i>Hello</i> there\n\n"+
+			"00:01:00.000 --> 00:01:03.000\nSecond line\nwith --&gt; arrow\n", string(subtitles.WebVTT(result.Cues)))
+	})
+
+	t.Run("ASS", func(t *testing.T) {
+		ass := "[Script Info]\nTitle: test\n\n[Events]\n" +
+			"Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\n" +
+			"Dialogue: 0,0:00:01.50,0:00:03.00,Default,,0,0,0,,{\\an8}First, with comma\\NSecond\n"
+
+		result, err := subtitles.Process([]byte(ass), "movie.ass", "en")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, subtitles.FormatASS, result.Format)
+		assert.Len(t, result.Cues, 1)
+		assert.Equal(t, 1500*time.Millisecond, result.Cues[0].Start)
+		assert.Equal(t, "First, with comma\nSecond", result.Cues[0].Text)
+	})
+
+	t.Run("SUB", func(t *testing.T) {
+		sub := "{1}{1}25.000\n{25}{50}First|Second\n"
+
+		result, err := subtitles.Process([]byte(sub), "movie.sub", "en")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, subtitles.FormatSUB, result.Format)
+		assert.Len(t, result.Cues, 1)
+		assert.Equal(t, time.Second, result.Cues[0].Start)
+		assert.Equal(t, 2*time.Second, result.Cues[0].End)
+		assert.Equal(t, "First\nSecond", result.Cues[0].Text)
+	})
+
+	t.Run("VTT", func(t *testing.T) {
+		vtt := "WEBVTT\n\nNOTE a comment\n\nintro\n00:05.000 --> 00:06.000 align:start\nHi\n"
+
+		result, err := subtitles.Process([]byte(vtt), "movie.vtt", "en")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, subtitles.FormatVTT, result.Format)
+		assert.Len(t, result.Cues, 1)
+		assert.Equal(t, 5*time.Second, result.Cues[0].Start)
+		assert.Equal(t, "Hi", result.Cues[0].Text)
+	})
+
+	t.Run("Windows1256", func(t *testing.T) {
+		text := "1\n00:00:01,000 --> 00:00:02,000\nمرحبا بالعالم، هذه ترجمة للفيلم\n"
+		data, err := charmap.Windows1256.NewEncoder().Bytes([]byte(text))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result, err := subtitles.Process(data, "movie.srt", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, subtitles.EncodingWindows1256, result.Encoding)
+		assert.Equal(t, "مرحبا بالعالم، هذه ترجمة للفيلم", result.Cues[0].Text)
+	})
+
+	t.Run("NoCues", func(t *testing.T) {
+		_, err := subtitles.Process([]byte("1\nnot a subtitle\n"), "movie.srt", "en")
+		assert.Equal(t, subtitles.ErrNoCues, err)
+	})
+}
+
+func TestSubtitlesRetime(t *testing.T) {
+
+	cues := []*subtitles.Cue{
+		{Start: time.Second, End: 2 * time.Second, Text: "first"},
+		{Start: 10 * time.Second, End: 12 * time.Second, Text: "second"},
+	}
+
+	shifted := subtitles.Shift(cues, -1500*time.Millisecond)
+	assert.Len(t, shifted, 2)
+	assert.Equal(t, time.Duration(0), shifted[0].Start)
+	assert.Equal(t, 500*time.Millisecond, shifted[0].End)
+	assert.Len(t, subtitles.Shift(cues, -3*time.Second), 1)
+
+	stretched, err := subtitles.Stretch(cues,
+		subtitles.Anchor{From: time.Second, To: 2 * time.Second},
+		subtitles.Anchor{From: 10 * time.Second, To: 20 * time.Second},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 2*time.Second, stretched[0].Start)
+	assert.Equal(t, 20*time.Second, stretched[1].Start)
+	assert.Equal(t, 24*time.Second, stretched[1].End)
+
+	_, err = subtitles.Stretch(cues, subtitles.Anchor{From: time.Second}, subtitles.Anchor{From: time.Second})
+	assert.Equal(t, subtitles.ErrInvalidAnchors, err)
+}
@@ -0,0 +1,47 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/castyapp/grpc.server/helpers"
+	"github.com/castyapp/grpc.server/models"
+	"github.com/castyapp/libcasty-protocol-go/proto"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// the access modes that are decided without looking up the friends and members
+func TestVideoPlayerAccess(t *testing.T) {
+
+	var (
+		ownerID   = primitive.NewObjectID()
+		memberID  = primitive.NewObjectID()
+		owner     = &models.User{ID: &ownerID}
+		member    = &models.User{ID: &memberID}
+		theaterID = primitive.NewObjectID()
+		theater   = &models.Theater{ID: &theaterID, UserID: &ownerID}
+	)
+
+	for _, access := range []proto.VIDEO_PLAYER_ACCESS{
+		proto.VIDEO_PLAYER_ACCESS_ACCESS_UNKNOWN,
+		proto.VIDEO_PLAYER_ACCESS_ACCESS_BY_USER,
+		proto.VIDEO_PLAYER_ACCESS_ACCESS_BY_CHOOSEN_FRIENDS,
+	} {
+		theater.VideoPlayerAccess = access
+
+		allowed, err := helpers.HasVideoPlayerAccess(context.Background(), nil, theater, owner)
+		assert.NoError(t, err)
+		assert.True(t, allowed, access.String())
+
+		allowed, err = helpers.HasVideoPlayerAccess(context.Background(), nil, theater, member)
+		assert.NoError(t, err)
+		assert.False(t, allowed, access.String())
+	}
+
+	// the membership is checked apart from the access mode
+	theater.VideoPlayerAccess = proto.VIDEO_PLAYER_ACCESS_ACCESS_BY_EVERYONE
+	allowed, err := helpers.HasVideoPlayerAccess(context.Background(), nil, theater, member)
+	assert.NoError(t, err)
+	assert.True(t, allowed)
+}
@@ -0,0 +1,24 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/castyapp/grpc.server/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTheaterBan(t *testing.T) {
+
+	var (
+		now       = time.Now()
+		expiresAt = now.Add(time.Hour)
+		permanent = &models.TheaterBan{CreatedAt: now}
+		temporary = &models.TheaterBan{CreatedAt: now, ExpiresAt: &expiresAt}
+	)
+
+	assert.True(t, permanent.IsActive(now.Add(24*365*time.Hour)))
+	assert.True(t, temporary.IsActive(now))
+	assert.False(t, temporary.IsActive(expiresAt))
+	assert.False(t, temporary.IsActive(expiresAt.Add(time.Second)))
+}
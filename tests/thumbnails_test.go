@@ -0,0 +1,40 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/castyapp/grpc.server/thumbnails"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThumbnails(t *testing.T) {
+
+	layout := thumbnails.NewLayout(1005 * time.Second)
+	assert.Equal(t, thumbnails.DefaultInterval, layout.Interval)
+	assert.Equal(t, 101, layout.Count)
+	assert.Equal(t, 2, layout.Sheets())
+
+	track := string(thumbnails.WebVTT(layout, 1005*time.Second))
+	assert.True(t, strings.HasPrefix(track, "WEBVTT\n\n00:00:00.000 --> 00:00:10.000\nsprite_000.jpg#xywh=0,0,160,90\n"))
+	assert.Contains(t, track, "00:01:50.000 --> 00:02:00.000\nsprite_000.jpg#xywh=160,90,160,90\n")
+	assert.True(t, strings.HasSuffix(track, "00:16:40.000 --> 00:16:45.000\nsprite_001.jpg#xywh=0,0,160,90\n"))
+
+	resolved := string(thumbnails.ResolveSprites([]byte(track), map[string]string{
+		"sprite_000.jpg": "https://s3.casty.ir/uploads/sprite_000.jpg?X-Amz-Signature=1",
+		"sprite_001.jpg": "https://s3.casty.ir/uploads/sprite_001.jpg?X-Amz-Signature=2",
+	}))
+	assert.Contains(t, resolved, "\nhttps://s3.casty.ir/uploads/sprite_000.jpg?X-Amz-Signature=1#xywh=0,0,160,90\n")
+	assert.True(t, strings.HasSuffix(resolved, "\nhttps://s3.casty.ir/uploads/sprite_001.jpg?X-Amz-Signature=2#xywh=0,0,160,90\n"))
+
+	// long media gets fewer previews instead of more sheets
+	long := thumbnails.NewLayout(10 * time.Hour)
+	assert.Equal(t, 90*time.Second, long.Interval)
+	assert.Equal(t, thumbnails.MaxCount, long.Count)
+
+	assert.Equal(t, 5*time.Second, thumbnails.PosterOffset(10*time.Second))
+	assert.Equal(t, 10*time.Second, thumbnails.PosterOffset(time.Minute))
+	assert.Equal(t, 36*time.Second, thumbnails.PosterOffset(6*time.Minute))
+	assert.Equal(t, 5*time.Minute, thumbnails.PosterOffset(2*time.Hour))
+}
@@ -0,0 +1,34 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/castyapp/grpc.server/models"
+	"github.com/castyapp/grpc.server/uploads"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestUploadObjectKey(t *testing.T) {
+
+	var (
+		userID   = primitive.NewObjectID()
+		uploadID = primitive.NewObjectID()
+	)
+
+	key := uploads.ObjectKey(&userID, &uploadID, models.UploadKindVideo, "../../Movie.MP4")
+	assert.Equal(t, "users/"+userID.Hex()+"/video/"+uploadID.Hex()+".mp4", key)
+	assert.True(t, strings.HasPrefix(key, uploads.UserPrefix(&userID)))
+
+	key = uploads.ObjectKey(&userID, &uploadID, models.UploadKindSubtitle, "subtitle.srt/../x")
+	assert.Equal(t, "users/"+userID.Hex()+"/subtitle/"+uploadID.Hex(), key)
+}
+
+func TestUploadContentTypes(t *testing.T) {
+	assert.NoError(t, uploads.CheckContentType(models.UploadKindVideo, "video/mp4"))
+	assert.NoError(t, uploads.CheckContentType(models.UploadKindSubtitle, "text/vtt; charset=utf-8"))
+	assert.Equal(t, uploads.ErrContentNotAllowed, uploads.CheckContentType(models.UploadKindAudio, "video/mp4"))
+	assert.Equal(t, uploads.ErrContentNotAllowed, uploads.CheckContentType(models.UploadKindVideo, "text/html"))
+	assert.Equal(t, uploads.ErrInvalidKind, uploads.CheckContentType("image", "image/png"))
+}
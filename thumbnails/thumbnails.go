@@ -0,0 +1,127 @@
+package thumbnails
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/castyapp/grpc.server/subtitles"
+)
+
+const (
+	// DefaultInterval is the time between two seek previews
+	DefaultInterval = 10 * time.Second
+	// MaxCount bounds the seek previews of long media, the interval grows instead
+	MaxCount = 400
+
+	Width   = 160
+	Height  = 90
+	Columns = 10
+	Rows    = 10
+
+	// PosterWidth is the widest poster frame that is stored
+	PosterWidth = 1280
+
+	TrackName = "thumbnails.vtt"
+)
+
+// Layout is how the seek previews of a media are tiled into sprite sheets.
+type Layout struct {
+	Interval time.Duration
+	Count    int
+	Width    int
+	Height   int
+	Columns  int
+	Rows     int
+}
+
+// NewLayout lays out a preview every DefaultInterval of the duration, or
+// fewer previews when the media is too long for MaxCount of them.
+func NewLayout(duration time.Duration) Layout {
+	interval := DefaultInterval
+	if duration > interval*MaxCount {
+		interval = (duration/MaxCount + time.Second - 1).Truncate(time.Second)
+	}
+	count := int((duration + interval - 1) / interval)
+	if count < 1 {
+		count = 1
+	}
+	return Layout{
+		Interval: interval,
+		Count:    count,
+		Width:    Width,
+		Height:   Height,
+		Columns:  Columns,
+		Rows:     Rows,
+	}
+}
+
+// Sheets is the number of sprite sheets of the layout.
+func (l Layout) Sheets() int {
+	perSheet := l.Columns * l.Rows
+	return (l.Count + perSheet - 1) / perSheet
+}
+
+// SpriteName is the name of the sheet at index, it matches the files ffmpeg writes.
+func SpriteName(index int) string {
+	return fmt.Sprintf("sprite_%03d.jpg", index)
+}
+
+// WebVTT writes the thumbnail track of the layout, every cue points at its
+// preview with a media fragment of the sprite sheet, relative to the track.
+func WebVTT(l Layout, duration time.Duration) []byte {
+	var (
+		perSheet = l.Columns * l.Rows
+		cues     = make([]*subtitles.Cue, 0, l.Count)
+	)
+	for i := 0; i < l.Count; i++ {
+		var (
+			start    = time.Duration(i) * l.Interval
+			end      = start + l.Interval
+			position = i % perSheet
+		)
+		if end > duration && duration > start {
+			end = duration
+		}
+		cues = append(cues, &subtitles.Cue{
+			Start: start,
+			End:   end,
+			Text: fmt.Sprintf("%s#xywh=%d,%d,%d,%d",
+				SpriteName(i/perSheet),
+				position%l.Columns*l.Width,
+				position/l.Columns*l.Height,
+				l.Width,
+				l.Height,
+			),
+		})
+	}
+	return subtitles.WebVTT(cues)
+}
+
+// PosterOffset is where the poster frame is taken from, far enough in to skip
+// logos and black intros but not so far that it spoils the media.
+func PosterOffset(duration time.Duration) time.Duration {
+	switch {
+	case duration <= 0:
+		return 0
+	case duration < 20*time.Second:
+		return duration / 2
+	}
+	offset := duration / 10
+	if offset < 10*time.Second {
+		offset = 10 * time.Second
+	}
+	if offset > 5*time.Minute {
+		offset = 5 * time.Minute
+	}
+	return offset
+}
+
+// ResolveSprites points the cues of a thumbnail track at the urls of their sprite sheets
+// instead of the sheets next to the track, urls are keyed by the sprite names.
+func ResolveSprites(track []byte, urls map[string]string) []byte {
+	for name, url := range urls {
+		track = bytes.ReplaceAll(track, []byte(name+"#xywh="), []byte(url+"#xywh="))
+	}
+	return track
+}
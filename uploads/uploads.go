@@ -0,0 +1,161 @@
+package uploads
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/castyapp/grpc.server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrInvalidKind       = errors.New("upload kind is invalid")
+	ErrContentNotAllowed = errors.New("content type is not allowed for this kind of upload")
+	ErrTooLarge          = errors.New("file is too large")
+	ErrQuotaExceeded     = errors.New("upload quota exceeded")
+	extensionRegex       = regexp.MustCompile(`^\.[a-z0-9]{1,5}$`)
+	allowedContentTypes  = map[models.UploadKind][]string{
+		models.UploadKindVideo: {
+			"video/mp4",
+			"video/webm",
+			"video/ogg",
+			"video/x-matroska",
+			"video/quicktime",
+		},
+		models.UploadKindAudio: {
+			"audio/mpeg",
+			"audio/mp4",
+			"audio/aac",
+			"audio/ogg",
+			"audio/webm",
+			"audio/wav",
+			"audio/flac",
+		},
+		models.UploadKindSubtitle: {
+			"text/vtt",
+			"application/x-subrip",
+			"text/x-ssa",
+			"text/plain",
+		},
+	}
+)
+
+// CheckContentType checks that the media type of the content type is allowed for the kind.
+func CheckContentType(kind models.UploadKind, contentType string) error {
+	allowed, ok := allowedContentTypes[kind]
+	if !ok {
+		return ErrInvalidKind
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ErrContentNotAllowed
+	}
+	for _, t := range allowed {
+		if t == mediaType {
+			return nil
+		}
+	}
+	return ErrContentNotAllowed
+}
+
+// ObjectKey returns the key that the upload is stored with, every user has
+// their own namespace so keys can never collide or point at other users' files.
+func ObjectKey(userID, uploadID *primitive.ObjectID, kind models.UploadKind, filename string) string {
+	ext := strings.ToLower(path.Ext(filename))
+	if !extensionRegex.MatchString(ext) {
+		ext = ""
+	}
+	return fmt.Sprintf("%s%s/%s%s", UserPrefix(userID), kind, uploadID.Hex(), ext)
+}
+
+// UserPrefix is the prefix of all of the object keys of the user.
+func UserPrefix(userID *primitive.ObjectID) string {
+	return fmt.Sprintf("users/%s/", userID.Hex())
+}
+
+// MediaAssetsPrefix is the prefix of the files that are generated for a media
+// source, like its seek previews, they are kept next to the uploads of the user.
+func MediaAssetsPrefix(userID, mediaSourceID *primitive.ObjectID) string {
+	return fmt.Sprintf("%smedia/%s/", UserPrefix(userID), mediaSourceID.Hex())
+}
+
+// Usage returns the bytes used by the user, completed uploads count with
+// their actual size and unfinished ones with their declared size until they expire.
+func Usage(ctx context.Context, db *mongo.Database, userID *primitive.ObjectID) (int64, error) {
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"user_id": userID,
+			"$or": []interface{}{
+				bson.M{"status": models.UploadStatusCompleted},
+				bson.M{"status": bson.M{"$in": models.UnfinishedUploadStatuses}, "expires_at": bson.M{"$gt": time.Now()}},
+			},
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id": nil,
+			"total": bson.M{"$sum": bson.M{
+				"$cond": []interface{}{
+					bson.M{"$eq": []interface{}{"$status", models.UploadStatusCompleted}},
+					"$size",
+					"$declared_size",
+				},
+			}},
+		}}},
+	}
+
+	cursor, err := db.Collection("uploads").Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	result := struct {
+		Total int64 `bson:"total"`
+	}{}
+
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&result); err != nil {
+			return 0, err
+		}
+	}
+
+	return result.Total, nil
+}
+
+// Reserve inserts the upload when its declared size fits into the quota of the user. The upload
+// is inserted before the usage is read, so concurrent uploads of the user always see each other
+// and can not go over the quota together, an upload that does not fit is removed again.
+// Reservations are released with their upload, when it's rejected, removed or expired.
+func Reserve(ctx context.Context, db *mongo.Database, upload *models.Upload, quota int64) error {
+
+	if upload.DeclaredSize > quota {
+		return ErrQuotaExceeded
+	}
+
+	collection := db.Collection("uploads")
+	if _, err := collection.InsertOne(ctx, upload); err != nil {
+		return err
+	}
+
+	usage, usageErr := Usage(ctx, db, upload.UserID)
+	if usageErr == nil && usage <= quota {
+		return nil
+	}
+
+	if _, err := collection.DeleteOne(ctx, bson.M{"_id": upload.ID}); err != nil {
+		return err
+	}
+
+	if usageErr != nil {
+		return usageErr
+	}
+	return ErrQuotaExceeded
+}